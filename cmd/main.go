@@ -2,14 +2,24 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"github.com/holmes89/book-organizer/internal/backups"
 	"github.com/holmes89/book-organizer/internal/books"
+	"github.com/holmes89/book-organizer/internal/calibre"
 	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/covers"
 	"github.com/holmes89/book-organizer/internal/database"
 	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/files"
+	"github.com/holmes89/book-organizer/internal/goodreads"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"github.com/holmes89/book-organizer/internal/opds"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"github.com/holmes89/book-organizer/internal/search"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/holmes89/book-organizer/internal/users"
 	"github.com/sirupsen/logrus"
 	"go.uber.org/fx"
 	"net/http"
@@ -18,44 +28,135 @@ import (
 )
 
 func main() {
+	if len(os.Args) == 3 && os.Args[1] == "restore" {
+		restoreBackup(os.Args[2])
+		return
+	}
 	app := NewApp()
 	app.Run()
 }
 
+// NewRepository provides the database selected by DB_TYPE.
+func NewRepository(config common.Config) fx.Option {
+	repository := fx.Provide(
+		config.LoadPostgresDatabaseConfig,
+		database.NewPostgresDatabase,
+	)
+	switch config.DatabaseType {
+	case common.MemoryDatabaseType:
+		repository = fx.Provide(database.NewMemoryDatabase)
+	case common.SQLiteDatabaseType:
+		repository = fx.Provide(
+			config.LoadSQLiteDatabaseConfig,
+			database.NewSQLiteDatabase,
+		)
+	}
+	return repository
+}
+
 func NewApp() *fx.App {
 
 	config := common.LoadConfig()
 
 	return fx.New(
+		NewRepository(config),
 		fx.Provide(
-			config.LoadPostgresDatabaseConfig,
-			database.NewPostgresDatabase,
+			database.NewDocumentRepository,
+			database.NewScanRepository,
+			database.NewTagRepository,
+			database.NewSearchRepository,
+			database.NewJobRepository,
+			database.NewBackupRepository,
+			database.NewProgressRepository,
+			database.NewAnnotationRepository,
+			database.NewUserRepository,
 			config.LoadBucketConfig,
-			common.NewGCPBucketStorage,
+			common.NewBucketStorage,
 			common.NewBucketDocumentStorage,
 			common.NewBackupStorage,
+			backups.NewBackupService,
+			config.LoadCoverConfig,
+			covers.NewCoverGenerator,
+			config.LoadJobConfig,
+			config.LoadTrashConfig,
+			jobs.NewJobService,
 			documents.NewDocumentService,
 			books.NewBookService,
+			tags.NewTagService,
+			search.NewSearchService,
+			progress.NewProgressService,
+			annotations.NewAnnotationService,
+			calibre.NewCalibreService,
+			goodreads.NewGoodreadsService,
+			opds.NewOPDSService,
+			config.LoadAuthConfig,
+			users.NewUserService,
 			NewMux,
 		),
 		fx.Invoke(documents.MakeDocumentHandler,
 			books.MakeBookHandler,
+			files.MakeFileHandler,
+			tags.MakeTagHandler,
+			search.MakeSearchHandler,
+			jobs.MakeJobHandler,
+			backups.MakeBackupHandler,
+			progress.MakeProgressHandler,
+			annotations.MakeAnnotationHandler,
+			calibre.MakeCalibreHandler,
+			goodreads.MakeGoodreadsHandler,
+			opds.MakeOPDSHandler,
+			users.MakeUserHandler,
+		),
+		fx.Logger(NewLogger()),
+	)
+}
+
+// restoreBackup rebuilds the catalog from a backup without starting the server.
+func restoreBackup(name string) {
+	config := common.LoadConfig()
+
+	var service backups.BackupService
+	app := fx.New(
+		NewRepository(config),
+		fx.Provide(
+			database.NewBackupRepository,
+			config.LoadBucketConfig,
+			common.NewBucketStorage,
+			common.NewBackupStorage,
+			backups.NewBackupService,
 		),
+		fx.Populate(&service),
 		fx.Logger(NewLogger()),
 	)
+
+	ctx := context.Background()
+	if err := app.Start(ctx); err != nil {
+		logrus.WithError(err).Fatal("unable to start")
+	}
+	defer app.Stop(ctx)
+
+	backup, err := service.Restore(ctx, name)
+	if err != nil {
+		logrus.WithError(err).WithField("name", name).Error("unable to restore backup")
+		app.Stop(ctx)
+		os.Exit(1)
+	}
+	logrus.WithFields(logrus.Fields{"documents": backup.Documents, "tags": backup.Tags}).Info("catalog restored")
 }
-func NewMux(lc fx.Lifecycle) *mux.Router {
+func NewMux(lc fx.Lifecycle, userService users.UserService) *mux.Router {
 	logrus.Info("creating mux")
 
 	router := mux.NewRouter()
 
-	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
+	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "Range"})
+	exposedOk := handlers.ExposedHeaders([]string{"Content-Range", "Content-Disposition", "Accept-Ranges", "ETag"})
 	originsOk := handlers.AllowedOrigins([]string{"*"})
 	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "PATCH", "OPTIONS", "DELETE"})
-	cors := handlers.CORS(originsOk, headersOk, methodsOk)
+	cors := handlers.CORS(originsOk, headersOk, methodsOk, exposedOk)
 
-	router.Use(cors, authenticate)
-	handler := (cors)((authenticate)(router))
+	auth := authenticate(userService)
+	router.Use(cors, auth)
+	handler := (cors)((auth)(router))
 
 	lc.Append(fx.Hook{
 		OnStart: func(context.Context) error {
@@ -89,46 +190,91 @@ func EndpointLogging(h http.Handler) http.Handler {
 	})
 }
 
-func authenticate(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+func authenticate(userService users.UserService) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		// Exclude auth
-		if strings.Contains(r.URL.Path, "auth") && r.Method == "GET" {
-			next.ServeHTTP(w, r) // call original
-			return
-		}
+			// Exclude auth
+			if strings.HasPrefix(r.URL.Path, "/auth/") {
+				next.ServeHTTP(w, r) // call original
+				return
+			}
 
-		// sample token string taken from the New example
-		tokenString := r.Header.Get("Authorization")
-		tokenString = strings.Replace(tokenString, "Bearer ", "", -1)
-		if tokenString == "" {
-			http.Error(w, "Authorization Header Required", http.StatusUnauthorized)
-			return
-		}
-		// Parse takes the token string and a function for looking up the key. The latter is especially
-		// useful if you use multiple keys for your application.  The standard is to use 'kid' in the
-		// head of the token to identify which key to use, but the parsed token (head and claims) is provided
-		// to the callback, providing flexibility.
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Don't forget to validate the alg is what you expect:
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			// Signed file urls carry their own authorization
+			if strings.HasPrefix(r.URL.Path, "/files/") && r.Method == "GET" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var user *users.User
+			if strings.HasPrefix(r.URL.Path, "/opds") {
+				// E-readers can't send a bearer token, the catalog also takes basic auth or a token parameter
+				if user = authenticateOPDS(r, userService); user == nil {
+					w.Header().Set("WWW-Authenticate", `Basic realm="book-organizer", charset="UTF-8"`)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+			} else {
+				tokenString := r.Header.Get("Authorization")
+				tokenString = strings.Replace(tokenString, "Bearer ", "", -1)
+				if tokenString == "" {
+					http.Error(w, "Authorization Header Required", http.StatusUnauthorized)
+					return
+				}
+
+				var err error
+				if user, err = userService.Verify(r.Context(), tokenString); err != nil {
+					code := http.StatusInternalServerError
+					if err == users.ErrInvalidToken {
+						code = http.StatusUnauthorized
+					}
+					http.Error(w, err.Error(), code)
+					return
+				}
 			}
 
-			// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
-			return []byte(os.Getenv("JWT_SECRET")), nil
+			if adminOnly(r) && !user.Admin {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			ctx := common.ContextWithUser(r.Context(), common.User{ID: user.ID, Admin: user.Admin})
+			next.ServeHTTP(w, r.WithContext(ctx)) // call original
 		})
+	}
+}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
+// authenticateOPDS accepts a token as a bearer token, a token parameter or a basic auth password,
+// and a username and password as basic auth.
+func authenticateOPDS(r *http.Request, userService users.UserService) *users.User {
+	ctx := r.Context()
+	token := r.URL.Query().Get("token")
+	if header := r.Header.Get("Authorization"); token == "" && strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	if token == "" {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return nil
 		}
+		if user, err := userService.Authenticate(ctx, username, password); err == nil {
+			return user
+		}
+		token = password
+	}
+	user, err := userService.Verify(ctx, token)
+	if err != nil {
+		return nil
+	}
+	return user
+}
 
-		if _, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			next.ServeHTTP(w, r) // call original
-		} else {
-			http.Error(w, "Invalid Token", http.StatusUnauthorized)
-			return
+// adminOnly reports whether a request changes something every user shares, such as the files in
+// the bucket or backups.
+func adminOnly(r *http.Request) bool {
+	for _, prefix := range []string{"/admin/", "/documents/scan"} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
 		}
-	})
+	}
+	return false
 }
@@ -4,6 +4,7 @@ go 1.14
 
 require (
 	github.com/Masterminds/squirrel v1.4.0
+	github.com/aws/aws-sdk-go v1.31.13
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/go-resty/resty/v2 v2.3.0
 	github.com/golang-migrate/migrate/v4 v4.11.0
@@ -12,6 +13,7 @@ require (
 	github.com/gorilla/mux v1.7.4
 	github.com/h2non/filetype v1.1.0
 	github.com/lib/pq v1.7.0
+	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.6.0
 	go.uber.org/fx v1.13.0
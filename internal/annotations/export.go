@@ -0,0 +1,210 @@
+package annotations
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats annotations can be exported in.
+const (
+	ExportMarkdown = "markdown"
+	ExportJSON     = "json"
+	ExportCSV      = "csv"
+)
+
+var ErrInvalidFormat = errors.New("invalid export format")
+
+// exportTypes are the content type and file extension of each export format.
+var exportTypes = map[string]struct{ contentType, ext string }{
+	ExportMarkdown: {"text/markdown; charset=utf-8", "md"},
+	ExportJSON:     {"application/json", "json"},
+	ExportCSV:      {"text/csv; charset=utf-8", "csv"},
+}
+
+// exportPrefix keeps the bulk exports of each user under their own folder of backup storage.
+const exportPrefix = common.BackupPrefix + "annotations/"
+
+// exportName matches the names given to bulk exports, the random part keeps exports started in
+// the same second apart.
+var exportName = regexp.MustCompile(`^annotations-\d{8}T\d{6}Z-[0-9a-f]{8}\.(md|json|csv)$`)
+
+func exportKey(userID string, name string) string {
+	return exportPrefix + userID + "/" + name
+}
+
+// exportFormatOf returns the format of a bulk export from its name.
+func exportFormatOf(name string) string {
+	for format, t := range exportTypes {
+		if strings.HasSuffix(name, "."+t.ext) {
+			return format
+		}
+	}
+	return ""
+}
+
+// ExportContentType returns the content type of an export format.
+func ExportContentType(format string) string {
+	return exportTypes[format].contentType
+}
+
+// ExportFileName names the notes file for a document.
+func ExportFileName(doc *documents.Document, format string) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(strings.ToLower(bookTitle(doc)), "-"), "-")
+	if name == "" {
+		name = doc.ID
+	}
+	return name + "-notes." + exportTypes[format].ext
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// Notes are the annotations of a single document as they are exported.
+type Notes struct {
+	DocumentID  string        `json:"document_id"`
+	Title       string        `json:"title"`
+	Authors     []string      `json:"authors"`
+	Annotations []*Annotation `json:"annotations"`
+}
+
+// Export describes a bulk export of every annotation in the library, it is downloaded by name by
+// the user who made it.
+type Export struct {
+	Name        string    `json:"name"`
+	Format      string    `json:"format"`
+	Created     time.Time `json:"created"`
+	Documents   int       `json:"documents"`
+	Annotations int       `json:"annotations"`
+}
+
+// newNotes puts the annotations of page based documents in reading order, Kindle locations before
+// pages. CFIs can't be compared so EPUB annotations stay in the order they were made.
+func newNotes(doc *documents.Document, list []*Annotation) *Notes {
+	if doc.Format != documents.FormatEpub {
+		list = append([]*Annotation{}, list...)
+		sort.SliceStable(list, func(i, j int) bool {
+			pi, pj := documents.LocationPage(list[i].Start), documents.LocationPage(list[j].Start)
+			if pi != pj {
+				return pi < pj
+			}
+			return documents.LocationKindle(list[i].Start) < documents.LocationKindle(list[j].Start)
+		})
+	}
+	return &Notes{
+		DocumentID:  doc.ID,
+		Title:       bookTitle(doc),
+		Authors:     append([]string{}, doc.Authors...),
+		Annotations: list,
+	}
+}
+
+func bookTitle(doc *documents.Document) string {
+	if doc.Title != "" {
+		return doc.Title
+	}
+	return doc.DisplayName
+}
+
+// writeNotes writes the notes of each book one after another in the given format, as a JSON
+// array for JSON.
+func writeNotes(w io.Writer, format string, books []*Notes) error {
+	switch format {
+	case ExportMarkdown:
+		return writeMarkdown(w, books)
+	case ExportJSON:
+		return writeJSON(w, books)
+	case ExportCSV:
+		return writeCSV(w, books)
+	}
+	return ErrInvalidFormat
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeMarkdown(w io.Writer, books []*Notes) error {
+	for i, book := range books {
+		if i > 0 {
+			fmt.Fprint(w, "---\n\n")
+		}
+		fmt.Fprintf(w, "# %s\n\n", book.Title)
+		if len(book.Authors) > 0 {
+			fmt.Fprintf(w, "*%s*\n\n", strings.Join(book.Authors, ", "))
+		}
+		for _, a := range book.Annotations {
+			fmt.Fprintf(w, "## %s\n\n", locationReference(a))
+			if a.Text != "" {
+				fmt.Fprintf(w, "> %s\n\n", strings.Join(strings.Split(a.Text, "\n"), "\n> "))
+			}
+			if a.Note != "" {
+				fmt.Fprintf(w, "%s\n\n", a.Note)
+			}
+			stamp := fmt.Sprintf("%s %s", kindVerbs[a.Kind], a.Created.UTC().Format(exportTimeFormat))
+			if a.Updated != nil {
+				stamp += fmt.Sprintf(", edited %s", a.Updated.UTC().Format(exportTimeFormat))
+			}
+			if _, err := fmt.Fprintf(w, "*%s*\n\n", stamp); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+const exportTimeFormat = "2006-01-02 15:04 MST"
+
+var kindVerbs = map[Kind]string{KindHighlight: "Highlighted", KindNote: "Noted"}
+
+var csvHeader = []string{"document_id", "title", "authors", "id", "kind", "location", "start", "end", "text", "note", "color", "created", "updated"}
+
+func writeCSV(w io.Writer, books []*Notes) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, book := range books {
+		for _, a := range book.Annotations {
+			updated := ""
+			if a.Updated != nil {
+				updated = a.Updated.UTC().Format(time.RFC3339)
+			}
+			if err := cw.Write([]string{book.DocumentID, book.Title, strings.Join(book.Authors, "; "), a.ID, string(a.Kind),
+				locationReference(a), a.Start, a.End, a.Text, a.Note, a.Color, a.Created.UTC().Format(time.RFC3339), updated}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// locationReference describes where an annotation is the way a reader would cite it.
+func locationReference(a *Annotation) string {
+	if start := documents.LocationKindle(a.Start); start > 0 {
+		if a.Start == a.End {
+			return fmt.Sprintf("Location %d", start)
+		}
+		return fmt.Sprintf("Locations %d-%d", start, documents.LocationKindle(a.End))
+	}
+	if documents.LocationPage(a.Start) == 0 {
+		if a.Start == a.End {
+			return "Location " + a.Start
+		}
+		return fmt.Sprintf("Location %s to %s", a.Start, a.End)
+	}
+	if a.Start == a.End {
+		return "Page " + a.Start
+	}
+	return fmt.Sprintf("Pages %s-%s", a.Start, a.End)
+}
@@ -0,0 +1,221 @@
+package annotations
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+func MakeAnnotationHandler(mr *mux.Router, service AnnotationService) http.Handler {
+	h := &annotationHandler{
+		service: service,
+	}
+
+	mr.HandleFunc("/documents/{id}/annotations", h.FindAll).Methods("GET")
+	mr.HandleFunc("/documents/{id}/annotations", h.Create).Methods("POST")
+	mr.HandleFunc("/documents/{id}/annotations/export", h.Export).Methods("GET")
+	mr.HandleFunc("/documents/{id}/annotations/{annotationID}", h.FindByID).Methods("GET")
+	mr.HandleFunc("/documents/{id}/annotations/{annotationID}", h.Update).Methods("PATCH")
+	mr.HandleFunc("/documents/{id}/annotations/{annotationID}", h.Delete).Methods("DELETE")
+	mr.HandleFunc("/annotations/export", h.ExportAll).Methods("POST")
+	mr.HandleFunc("/annotations/export/{name}", h.DownloadExport).Methods("GET")
+	mr.HandleFunc("/annotations/import/kindle", h.ImportKindle).Methods("POST")
+
+	return mr
+}
+
+type annotationHandler struct {
+	service AnnotationService
+}
+
+// makeError maps service errors onto responses, anything unexpected is a server error.
+func makeError(w http.ResponseWriter, err error, method string) {
+	switch err {
+	case ErrInvalidKind, ErrInvalidLocation, ErrInvalidColor, ErrEmptyHighlight, ErrEmptyNote, ErrInvalidFormat, ErrNoClippings:
+		common.MakeError(w, http.StatusBadRequest, "annotation", err.Error(), method)
+	case ErrNotFound, ErrExportNotFound, documents.ErrNotFound:
+		common.MakeError(w, http.StatusNotFound, "annotation", err.Error(), method)
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "annotation", "Server Error", method)
+	}
+}
+
+func (h *annotationHandler) FindAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	entities, err := h.service.FindAll(ctx, id)
+	if err != nil {
+		makeError(w, err, "findall")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entities)
+}
+
+func (h *annotationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	b, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	annotation := &Annotation{}
+	if err := json.Unmarshal(b, annotation); err != nil {
+		logrus.WithError(err).Error("unable to unmarshal annotation")
+		common.MakeError(w, http.StatusBadRequest, "annotation", "Bad Request", "create")
+		return
+	}
+
+	if err := h.service.Create(ctx, id, annotation); err != nil {
+		makeError(w, err, "create")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	common.EncodeResponse(r.Context(), w, annotation)
+}
+
+func (h *annotationHandler) FindByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	entity, err := h.service.FindByID(ctx, vars["id"], vars["annotationID"])
+	if err != nil {
+		makeError(w, err, "findbyid")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entity)
+}
+
+func (h *annotationHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	b, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	req := AnnotationUpdate{}
+	if err := json.Unmarshal(b, &req); err != nil {
+		logrus.WithError(err).Error("unable to unmarshal annotation")
+		common.MakeError(w, http.StatusBadRequest, "annotation", "Bad Request", "update")
+		return
+	}
+
+	entity, err := h.service.Update(ctx, vars["id"], vars["annotationID"], req)
+	if err != nil {
+		makeError(w, err, "update")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entity)
+}
+
+func (h *annotationHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	if err := h.service.Delete(ctx, vars["id"], vars["annotationID"]); err != nil {
+		makeError(w, err, "delete")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, map[string]string{"status": "success"})
+}
+
+// exportFormat reads the format query parameter, notes are exported as markdown by default.
+func exportFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	return ExportMarkdown
+}
+
+// Export renders the whole file before responding so a failure is still reported with a status.
+func (h *annotationHandler) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	format := exportFormat(r)
+
+	buf := &bytes.Buffer{}
+	doc, err := h.service.Export(ctx, mux.Vars(r)["id"], format, buf)
+	if err != nil {
+		makeError(w, err, "export")
+		return
+	}
+
+	w.Header().Set("Content-Type", ExportContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": ExportFileName(doc, format)}))
+	if _, err := io.Copy(w, buf); err != nil {
+		logrus.WithError(err).Warn("unable to write notes")
+	}
+}
+
+func (h *annotationHandler) ExportAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	export, err := h.service.ExportAll(ctx, exportFormat(r))
+	if err != nil {
+		makeError(w, err, "exportall")
+		return
+	}
+
+	w.Header().Set("Location", "/annotations/export/"+export.Name)
+	w.WriteHeader(http.StatusCreated)
+	common.EncodeResponse(r.Context(), w, export)
+}
+
+func (h *annotationHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := mux.Vars(r)["name"]
+
+	file, format, err := h.service.OpenExport(ctx, name)
+	if err != nil {
+		makeError(w, err, "downloadexport")
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", ExportContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if _, err := io.Copy(w, file); err != nil {
+		logrus.WithError(err).Warn("unable to write annotation export")
+	}
+}
+
+// ImportKindle takes a clippings file in the file field. Books the import couldn't match can be
+// resolved by sending matches, a JSON object of books to document ids, with the same file.
+func (h *annotationHandler) ImportKindle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		common.MakeError(w, http.StatusBadRequest, "annotation", "Unable to parse form", "importkindle")
+		return
+	}
+	defer file.Close()
+
+	matches := map[string]string{}
+	if v := r.FormValue("matches"); v != "" {
+		if err := json.Unmarshal([]byte(v), &matches); err != nil {
+			logrus.WithError(err).Error("unable to unmarshal matches")
+			common.MakeError(w, http.StatusBadRequest, "annotation", "Invalid matches", "importkindle")
+			return
+		}
+	}
+
+	result, err := h.service.ImportKindle(ctx, file, matches)
+	if err != nil {
+		makeError(w, err, "importkindle")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, result)
+}
@@ -0,0 +1,372 @@
+package annotations
+
+import (
+	"bufio"
+	"context"
+	"github.com/google/uuid"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/search"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of entry in a Kindle clippings file, bookmarks only mark a place and aren't imported.
+const (
+	ClippingHighlight = "highlight"
+	ClippingNote      = "note"
+	ClippingBookmark  = "bookmark"
+)
+
+// Reasons a clipping couldn't be imported.
+const (
+	ReasonNoMatch         = "no matching document"
+	ReasonAmbiguous       = "more than one document matches"
+	ReasonUnknownDocument = "matched document not found"
+	ReasonNoLocation      = "clipping has no location that can be used in this document"
+)
+
+const clippingSeparator = "=========="
+
+// clippingLimit starts the text Kindle saves in place of a highlight once a publisher's limit is reached.
+const clippingLimit = "<You have reached the clipping limit"
+
+var ErrNoClippings = errors.New("no clippings found")
+
+// Clipping is an entry of a Kindle "My Clippings.txt" file.
+type Clipping struct {
+	Book     string     `json:"book"` // title line as it appears in the file, used to resolve matches
+	Title    string     `json:"title"`
+	Author   string     `json:"author"`
+	Kind     string     `json:"kind"`
+	Page     string     `json:"page"`
+	Location string     `json:"location"`
+	Added    *time.Time `json:"added"`
+	Text     string     `json:"text"`
+}
+
+// KindleImport reports what an import of a clippings file did.
+type KindleImport struct {
+	Clippings  int                  `json:"clippings"`
+	Imported   int                  `json:"imported"`
+	Duplicates int                  `json:"duplicates"`
+	Skipped    int                  `json:"skipped"`
+	Matched    []*KindleMatch       `json:"matched"`
+	Unmatched  []*UnmatchedClipping `json:"unmatched"`
+}
+
+// KindleMatch is a book in the clippings file and the document its clippings were added to.
+type KindleMatch struct {
+	Book       string  `json:"book"`
+	DocumentID string  `json:"document_id"`
+	Title      string  `json:"title"`
+	Score      float64 `json:"score"`
+	Imported   int     `json:"imported"`
+}
+
+// UnmatchedClipping is a clipping that wasn't imported. Clippings can be matched by hand by
+// importing the file again with the book mapped to a document id.
+type UnmatchedClipping struct {
+	*Clipping
+	Reason     string                   `json:"reason"`
+	DocumentID string                   `json:"document_id,omitempty"`
+	Candidates []*search.MatchCandidate `json:"candidates,omitempty"`
+}
+
+// ImportKindle adds the highlights and notes of a clippings file to the documents their books match.
+// matches maps books, as written in the file, to document ids and takes precedence over matching.
+// Clippings already imported are skipped so a file can be imported again after resolving matches.
+func (s *annotationService) ImportKindle(ctx context.Context, r io.Reader, matches map[string]string) (*KindleImport, error) {
+	clippings, err := parseClippings(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(clippings) == 0 {
+		return nil, ErrNoClippings
+	}
+	docs, err := s.docService.FindAll(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]*documents.Document{}
+	for _, doc := range docs {
+		byID[doc.ID] = doc
+	}
+
+	result := &KindleImport{Clippings: len(clippings), Matched: []*KindleMatch{}, Unmatched: []*UnmatchedClipping{}}
+	var books []string
+	byBook := map[string][]*Clipping{}
+	for _, c := range clippings {
+		if c.Kind == "" || c.Kind == ClippingBookmark || c.Text == "" || strings.HasPrefix(c.Text, clippingLimit) {
+			result.Skipped++
+			continue
+		}
+		if _, ok := byBook[c.Book]; !ok {
+			books = append(books, c.Book)
+		}
+		byBook[c.Book] = append(byBook[c.Book], c)
+	}
+
+	for _, book := range books {
+		bookClippings := byBook[book]
+		var doc *documents.Document
+		var score float64
+		var candidates []*search.MatchCandidate
+		reason := ""
+		if id, ok := matches[book]; ok {
+			if doc = byID[id]; doc == nil {
+				reason = ReasonUnknownDocument
+			}
+			score = 1
+		} else {
+			doc, score, candidates = search.MatchDocument(bookClippings[0].Title, bookClippings[0].Author, docs)
+			if doc == nil {
+				reason = ReasonNoMatch
+				if len(candidates) > 1 && candidates[0].Score >= search.MatchThreshold {
+					reason = ReasonAmbiguous
+				}
+			}
+		}
+		if doc == nil {
+			for _, c := range bookClippings {
+				result.Unmatched = append(result.Unmatched, &UnmatchedClipping{Clipping: c, Reason: reason, DocumentID: matches[book], Candidates: candidates})
+			}
+			continue
+		}
+
+		imported, duplicates, unanchored, err := s.importClippings(ctx, doc, bookClippings)
+		if err != nil {
+			return nil, err
+		}
+		result.Imported += imported
+		result.Duplicates += duplicates
+		result.Matched = append(result.Matched, &KindleMatch{Book: book, DocumentID: doc.ID, Title: bookTitle(doc), Score: score, Imported: imported})
+		for _, c := range unanchored {
+			result.Unmatched = append(result.Unmatched, &UnmatchedClipping{Clipping: c, Reason: ReasonNoLocation, DocumentID: doc.ID})
+		}
+	}
+	logrus.WithFields(logrus.Fields{"clippings": result.Clippings, "imported": result.Imported, "unmatched": len(result.Unmatched)}).Info("kindle clippings imported")
+	return result, nil
+}
+
+// importClippings turns the clippings of one book into annotations on a document. Kindle saves a
+// note on a highlight as a separate clipping at the end of the highlight, those are folded into
+// the highlight.
+func (s *annotationService) importClippings(ctx context.Context, doc *documents.Document, clippings []*Clipping) (imported, duplicates int, unanchored []*Clipping, err error) {
+	existing, err := s.repo.FindAnnotations(ctx, doc.ID)
+	if err != nil {
+		logrus.WithError(err).WithField("id", doc.ID).Error("unable to fetch annotations from repository")
+		return 0, 0, nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	seen := map[string]bool{}
+	for _, a := range existing {
+		seen[annotationKey(a)] = true
+	}
+
+	var list []*Annotation
+	var highlights []*Annotation
+	sources := map[*Annotation]*Clipping{}
+	for _, c := range clippings {
+		start, end, ok := clippingAnchor(doc, c)
+		if !ok {
+			unanchored = append(unanchored, c)
+			continue
+		}
+		if c.Kind == ClippingNote {
+			if highlight := noteHighlight(highlights, sources, c); highlight != nil {
+				highlight.Note = c.Text
+				continue
+			}
+		}
+		a := &Annotation{
+			ID:         uuid.New().String(),
+			DocumentID: doc.ID,
+			Kind:       KindHighlight,
+			Start:      start,
+			End:        end,
+			Color:      DefaultColor,
+			Created:    time.Now(),
+		}
+		if c.Kind == ClippingNote {
+			a.Kind, a.Note = KindNote, c.Text
+		} else {
+			a.Text = c.Text
+			highlights = append(highlights, a)
+		}
+		if c.Added != nil {
+			a.Created = *c.Added
+		}
+		list = append(list, a)
+		sources[a] = c
+	}
+
+	var added []*Annotation
+	for _, a := range list {
+		if err := validate(doc, a); err != nil {
+			logrus.WithError(err).WithField("id", doc.ID).Warn("skipping invalid clipping")
+			continue
+		}
+		key := annotationKey(a)
+		if seen[key] {
+			duplicates++
+			continue
+		}
+		seen[key] = true
+		added = append(added, a)
+	}
+	if len(added) == 0 {
+		return 0, duplicates, unanchored, nil
+	}
+	if err := s.repo.InsertAnnotations(ctx, doc.ID, added); err != nil {
+		logrus.WithError(err).WithField("id", doc.ID).Error("unable to save clippings")
+		return 0, 0, nil, errors.Wrap(err, "failed to store data in repo")
+	}
+	return len(added), duplicates, unanchored, nil
+}
+
+// annotationKey identifies an annotation when checking for clippings that were already imported.
+func annotationKey(a *Annotation) string {
+	return strings.Join([]string{string(a.Kind), a.Start, a.End, a.Text, a.Note}, "\x00")
+}
+
+// noteHighlight finds the highlight a Kindle note belongs to, the latest highlight without a note
+// whose location range holds the note's location.
+func noteHighlight(highlights []*Annotation, sources map[*Annotation]*Clipping, note *Clipping) *Annotation {
+	noteStart, _ := kindleRange(note.Location)
+	if noteStart == 0 {
+		return nil
+	}
+	for i := len(highlights) - 1; i >= 0; i-- {
+		start, end := kindleRange(sources[highlights[i]].Location)
+		if highlights[i].Note == "" && start <= noteStart && noteStart <= end {
+			return highlights[i]
+		}
+	}
+	return nil
+}
+
+// clippingAnchor picks where a clipping goes in a document. Pages are used when the clipping
+// has them, otherwise Kindle formats and EPUBs are placed by Kindle location. Kindles don't give
+// EPUB pages or a CFI, so a highlight in an EPUB is found from its location and text.
+func clippingAnchor(doc *documents.Document, c *Clipping) (string, string, bool) {
+	if doc.Format != documents.FormatEpub {
+		if start, end := kindleRange(c.Page); start > 0 {
+			s, e := strconv.Itoa(start), strconv.Itoa(end)
+			if doc.ValidLocation(s) && doc.ValidLocation(e) {
+				return s, e, true
+			}
+		}
+	}
+	start, end := kindleRange(c.Location)
+	if start == 0 {
+		return "", "", false
+	}
+	s, e := documents.KindleLocationPrefix+strconv.Itoa(start), documents.KindleLocationPrefix+strconv.Itoa(end)
+	return s, e, doc.ValidLocation(s) && doc.ValidLocation(e)
+}
+
+// kindleRange parses a page or location range like "180-182". Older Kindles shorten the end of a
+// range to the digits that changed, so "1234-36" is 1234 to 1236.
+func kindleRange(v string) (int, int) {
+	parts := strings.SplitN(v, "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil || start < 1 {
+		return 0, 0
+	}
+	if len(parts) == 1 {
+		return start, start
+	}
+	endDigits := parts[1]
+	if full := strconv.Itoa(start); len(endDigits) < len(full) {
+		endDigits = full[:len(full)-len(endDigits)] + endDigits
+	}
+	end, err := strconv.Atoi(endDigits)
+	if err != nil || end < start {
+		return start, start
+	}
+	return start, end
+}
+
+var (
+	clippingBook     = regexp.MustCompile(`^(.*?)\s*\(([^()]*)\)\s*$`)
+	clippingKind     = regexp.MustCompile(`(?i)\b(highlight|note|bookmark)\b`)
+	clippingPage     = regexp.MustCompile(`(?i)\bpage\s+([0-9]+(?:-[0-9]+)?)`)
+	clippingLocation = regexp.MustCompile(`(?i)\b(?:location|loc\.)\s+([0-9]+(?:-[0-9]+)?)`)
+	clippingAdded    = regexp.MustCompile(`(?i)added on\s+(.+)$`)
+)
+
+// clippingTimeFormats are the ways English Kindles have written when a clipping was added.
+var clippingTimeFormats = []string{
+	"Monday, January 2, 2006 3:04:05 PM",
+	"Monday, January 2, 2006, 03:04 PM",
+	"Monday, 2 January 2006 15:04:05",
+	"Monday, January 2, 2006 15:04:05",
+}
+
+// parseClippings splits a clippings file into its entries, each is the book, a line describing
+// the clipping and the clipping's text.
+func parseClippings(r io.Reader) ([]*Clipping, error) {
+	var clippings []*Clipping
+	var entry []string
+	flush := func() {
+		if c := parseClipping(entry); c != nil {
+			clippings = append(clippings, c)
+		}
+		entry = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(strings.TrimPrefix(scanner.Text(), "\ufeff"), "\r")
+		if strings.TrimSpace(line) == clippingSeparator {
+			flush()
+			continue
+		}
+		entry = append(entry, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to read clippings")
+	}
+	flush()
+	return clippings, nil
+}
+
+func parseClipping(lines []string) *Clipping {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) < 2 {
+		return nil
+	}
+	c := &Clipping{Book: strings.TrimSpace(lines[0])}
+	c.Title = c.Book
+	if m := clippingBook.FindStringSubmatch(c.Book); m != nil {
+		c.Title, c.Author = m[1], strings.TrimSpace(m[2])
+	}
+
+	meta := lines[1]
+	if m := clippingKind.FindStringSubmatch(meta); m != nil {
+		c.Kind = strings.ToLower(m[1])
+	}
+	if m := clippingPage.FindStringSubmatch(meta); m != nil {
+		c.Page = m[1]
+	}
+	if m := clippingLocation.FindStringSubmatch(meta); m != nil {
+		c.Location = m[1]
+	}
+	if m := clippingAdded.FindStringSubmatch(meta); m != nil {
+		for _, layout := range clippingTimeFormats {
+			if t, err := time.Parse(layout, strings.TrimSpace(m[1])); err == nil {
+				c.Added = &t
+				break
+			}
+		}
+	}
+	c.Text = strings.TrimSpace(strings.Join(lines[2:], "\n"))
+	return c
+}
@@ -0,0 +1,189 @@
+package annotations
+
+import (
+	"github.com/holmes89/book-organizer/internal/documents"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, min, sec int) *time.Time {
+	t := time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	return &t
+}
+
+func TestParseClippings(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want []*Clipping
+	}{
+		{
+			name: "highlight with page and location",
+			file: "\ufeffThe Left Hand of Darkness (Le Guin, Ursula K.)\r\n" +
+				"- Your Highlight on page 12 | Location 180-182 | Added on Monday, March 4, 2019 9:15:02 PM\r\n" +
+				"\r\n" +
+				"Light is the left hand of darkness\r\n" +
+				"==========\r\n",
+			want: []*Clipping{{
+				Book:     "The Left Hand of Darkness (Le Guin, Ursula K.)",
+				Title:    "The Left Hand of Darkness",
+				Author:   "Le Guin, Ursula K.",
+				Kind:     ClippingHighlight,
+				Page:     "12",
+				Location: "180-182",
+				Added:    date(2019, time.March, 4, 21, 15, 2),
+				Text:     "Light is the left hand of darkness",
+			}},
+		},
+		{
+			name: "older kindle note without page",
+			file: "Dune (Frank Herbert)\n" +
+				"- Note Loc. 1234  | Added on Tuesday, June 5, 2012, 08:30 AM\n" +
+				"\n" +
+				"Fear is the mind-killer\n" +
+				"and the little death\n" +
+				"==========\n",
+			want: []*Clipping{{
+				Book:     "Dune (Frank Herbert)",
+				Title:    "Dune",
+				Author:   "Frank Herbert",
+				Kind:     ClippingNote,
+				Location: "1234",
+				Added:    date(2012, time.June, 5, 8, 30, 0),
+				Text:     "Fear is the mind-killer\nand the little death",
+			}},
+		},
+		{
+			name: "title with parentheses and no author",
+			file: "Notes (Draft) (Anonymous)\n" +
+				"- Your Bookmark on Location 50 | Added on Monday, 2 January 2006 15:04:05\n" +
+				"\n" +
+				"\n" +
+				"==========\n" +
+				"Untitled\n" +
+				"- Your Highlight at location 7-9 | Added on some day Kindle can't write\n" +
+				"\n" +
+				"text\n" +
+				"==========\n",
+			want: []*Clipping{
+				{
+					Book:     "Notes (Draft) (Anonymous)",
+					Title:    "Notes (Draft)",
+					Author:   "Anonymous",
+					Kind:     ClippingBookmark,
+					Location: "50",
+					Added:    date(2006, time.January, 2, 15, 4, 5),
+				},
+				{
+					Book:     "Untitled",
+					Title:    "Untitled",
+					Kind:     ClippingHighlight,
+					Location: "7-9",
+					Text:     "text",
+				},
+			},
+		},
+		{
+			name: "entries without a description and no trailing separator",
+			file: "==========\n" +
+				"\n" +
+				"Only a title\n" +
+				"==========\n" +
+				"Book (Author)\n" +
+				"- Your Highlight on page 3 | Added on Monday, January 2, 2006 15:04:05\n" +
+				"\n" +
+				"  last entry  ",
+			want: []*Clipping{{
+				Book:   "Book (Author)",
+				Title:  "Book",
+				Author: "Author",
+				Kind:   ClippingHighlight,
+				Page:   "3",
+				Added:  date(2006, time.January, 2, 15, 4, 5),
+				Text:   "last entry",
+			}},
+		},
+		{
+			name: "empty",
+			file: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClippings(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d clippings, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Errorf("clipping %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestKindleRange(t *testing.T) {
+	tests := []struct {
+		value string
+		start int
+		end   int
+	}{
+		{"", 0, 0},
+		{"12", 12, 12},
+		{"180-182", 180, 182},
+		{"1234-36", 1234, 1236},
+		{"1299-303", 1299, 1303},
+		{"99-101", 99, 101},
+		{"50-40", 50, 50},
+		{"50-x", 50, 50},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"xii", 0, 0},
+	}
+	for _, tt := range tests {
+		start, end := kindleRange(tt.value)
+		if start != tt.start || end != tt.end {
+			t.Errorf("kindleRange(%q) = %d, %d, want %d, %d", tt.value, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestClippingAnchor(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		pages    int
+		page     string
+		location string
+		start    string
+		end      string
+		ok       bool
+	}{
+		{"pdf page", documents.FormatPdf, 300, "12-13", "180-182", "12", "13", true},
+		{"pdf without page", documents.FormatPdf, 300, "", "180-182", "", "", false},
+		{"pdf page past the end", documents.FormatPdf, 10, "12", "", "", "", false},
+		{"mobi page", documents.FormatMobi, 0, "12", "180", "12", "12", true},
+		{"mobi location", documents.FormatMobi, 0, "", "1234-36", "loc:1234", "loc:1236", true},
+		{"azw3 page past the end falls back to location", documents.FormatAzw3, 10, "12", "180", "loc:180", "loc:180", true},
+		{"epub location", documents.FormatEpub, 0, "12", "180-182", "loc:180", "loc:182", true},
+		{"epub without location", documents.FormatEpub, 0, "12", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &documents.Document{Format: tt.format, PageCount: tt.pages}
+			start, end, ok := clippingAnchor(doc, &Clipping{Page: tt.page, Location: tt.location})
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (start != tt.start || end != tt.end) {
+				t.Errorf("got %q to %q, want %q to %q", start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package annotations
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Kind string
+
+const (
+	KindHighlight Kind = "highlight"
+	KindNote      Kind = "note"
+)
+
+// DefaultColor is used for annotations created without a colour.
+const DefaultColor = "yellow"
+
+// colors are the named colours readers offer, any other colour has to be a hex code.
+var colors = map[string]bool{"yellow": true, "green": true, "blue": true, "pink": true, "purple": true, "orange": true}
+
+var hexColor = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+var (
+	ErrNotFound        = errors.New("annotation not found")
+	ErrInvalidKind     = errors.New("invalid kind")
+	ErrInvalidLocation = errors.New("invalid location")
+	ErrInvalidColor    = errors.New("invalid color")
+	ErrEmptyHighlight  = errors.New("highlight text required")
+	ErrEmptyNote       = errors.New("note required")
+	ErrExportNotFound  = errors.New("export not found")
+)
+
+// Annotation is a highlight or note on a range of a document. Start and End are page numbers
+// for page based formats and EPUB CFIs for EPUBs, a single page or point has the same start and end.
+// Clippings imported from a Kindle without pages are placed by Kindle location, like "loc:1234".
+type Annotation struct {
+	ID         string     `json:"id"`
+	DocumentID string     `json:"document_id"`
+	Kind       Kind       `json:"kind"`
+	Start      string     `json:"start"`
+	End        string     `json:"end"`
+	Text       string     `json:"text"`
+	Color      string     `json:"color"`
+	Note       string     `json:"note"`
+	Created    time.Time  `json:"created"`
+	Updated    *time.Time `json:"updated"`
+}
+
+// AnnotationUpdate holds the fields to change on an annotation, nil fields are left as they are.
+type AnnotationUpdate struct {
+	Kind  *Kind   `json:"kind"`
+	Start *string `json:"start"`
+	End   *string `json:"end"`
+	Text  *string `json:"text"`
+	Color *string `json:"color"`
+	Note  *string `json:"note"`
+}
+
+type AnnotationService interface {
+	FindAll(ctx context.Context, documentID string) ([]*Annotation, error)
+	FindByID(ctx context.Context, documentID string, id string) (*Annotation, error)
+	Create(ctx context.Context, documentID string, annotation *Annotation) error
+	Update(ctx context.Context, documentID string, id string, update AnnotationUpdate) (*Annotation, error)
+	Delete(ctx context.Context, documentID string, id string) error
+	// Export writes the annotations of a document as a notes file.
+	Export(ctx context.Context, documentID string, format string, w io.Writer) (*documents.Document, error)
+	// ExportAll writes the annotations of every document in the library to backup storage.
+	ExportAll(ctx context.Context, format string) (*Export, error)
+	// OpenExport reads a bulk export made by the user of the context, returning its format.
+	OpenExport(ctx context.Context, name string) (io.ReadCloser, string, error)
+	ImportKindle(ctx context.Context, r io.Reader, matches map[string]string) (*KindleImport, error)
+}
+
+// AnnotationRepository methods are prefixed so a single database type can also implement the document repository.
+// Changes to annotations refresh the search index of their document.
+type AnnotationRepository interface {
+	FindAnnotations(ctx context.Context, documentID string) ([]*Annotation, error)
+	// FindAllAnnotations returns every annotation ordered by document.
+	FindAllAnnotations(ctx context.Context) ([]*Annotation, error)
+	FindAnnotationByID(ctx context.Context, id string) (*Annotation, error)
+	InsertAnnotation(ctx context.Context, annotation *Annotation) error
+	// InsertAnnotations adds annotations to a document together, refreshing its search index once.
+	InsertAnnotations(ctx context.Context, documentID string, annotations []*Annotation) error
+	UpdateAnnotation(ctx context.Context, annotation Annotation) error
+	DeleteAnnotation(ctx context.Context, documentID string, id string) error
+}
+
+type annotationService struct {
+	repo       AnnotationRepository
+	docService documents.DocumentService
+	storage    common.BackupStorage
+}
+
+func NewAnnotationService(repo AnnotationRepository, docService documents.DocumentService, storage common.BackupStorage) AnnotationService {
+	return &annotationService{
+		repo:       repo,
+		docService: docService,
+		storage:    storage,
+	}
+}
+
+func (s *annotationService) FindAll(ctx context.Context, documentID string) ([]*Annotation, error) {
+	if _, err := s.document(ctx, documentID); err != nil {
+		return nil, err
+	}
+	entities, err := s.repo.FindAnnotations(ctx, documentID)
+	if err != nil {
+		logrus.WithError(err).WithField("id", documentID).Error("unable to fetch annotations from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return entities, nil
+}
+
+// FindByID only finds annotations on the given document so ids can't be used across documents.
+func (s *annotationService) FindByID(ctx context.Context, documentID string, id string) (*Annotation, error) {
+	if _, err := s.document(ctx, documentID); err != nil {
+		return nil, err
+	}
+	entity, err := s.repo.FindAnnotationByID(ctx, id)
+	if err == ErrNotFound || (err == nil && entity.DocumentID != documentID) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to fetch annotation from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return entity, nil
+}
+
+func (s *annotationService) Create(ctx context.Context, documentID string, annotation *Annotation) error {
+	doc, err := s.document(ctx, documentID)
+	if err != nil {
+		return err
+	}
+	annotation.DocumentID = documentID
+	if annotation.Kind == "" {
+		annotation.Kind = KindNote
+		if strings.TrimSpace(annotation.Text) != "" {
+			annotation.Kind = KindHighlight
+		}
+	}
+	if annotation.Color == "" {
+		annotation.Color = DefaultColor
+	}
+	if err := validate(doc, annotation); err != nil {
+		return err
+	}
+
+	annotation.ID = uuid.New().String()
+	annotation.Created = time.Now()
+	annotation.Updated = nil
+
+	if err := s.repo.InsertAnnotation(ctx, annotation); err != nil {
+		logrus.WithError(err).Error("unable to save annotation to repo")
+		return errors.Wrap(err, "failed to store data in repo")
+	}
+	return nil
+}
+
+func (s *annotationService) Update(ctx context.Context, documentID string, id string, update AnnotationUpdate) (*Annotation, error) {
+	doc, err := s.document(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := s.FindByID(ctx, documentID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Kind != nil {
+		entity.Kind = *update.Kind
+	}
+	if update.Start != nil {
+		entity.Start = *update.Start
+		if update.End == nil {
+			// moving the start of a single point annotation moves all of it
+			entity.End = ""
+		}
+	}
+	if update.End != nil {
+		entity.End = *update.End
+	}
+	if update.Text != nil {
+		entity.Text = *update.Text
+	}
+	if update.Color != nil {
+		entity.Color = *update.Color
+	}
+	if update.Note != nil {
+		entity.Note = *update.Note
+	}
+	if err := validate(doc, entity); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entity.Updated = &now
+
+	if err := s.repo.UpdateAnnotation(ctx, *entity); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to update annotation")
+		return nil, errors.Wrap(err, "unable to update annotation")
+	}
+	return entity, nil
+}
+
+func (s *annotationService) Delete(ctx context.Context, documentID string, id string) error {
+	if _, err := s.FindByID(ctx, documentID, id); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteAnnotation(ctx, documentID, id); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to delete annotation")
+		return errors.Wrap(err, "unable to delete annotation")
+	}
+	return nil
+}
+
+func (s *annotationService) Export(ctx context.Context, documentID string, format string, w io.Writer) (*documents.Document, error) {
+	if _, ok := exportTypes[format]; !ok {
+		return nil, ErrInvalidFormat
+	}
+	doc, err := s.document(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.FindAll(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	notes := newNotes(doc, list)
+	if format == ExportJSON {
+		// a single book is exported as an object rather than a list of one
+		err = writeJSON(w, notes)
+	} else {
+		err = writeNotes(w, format, []*Notes{notes})
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", documentID).Error("unable to write notes")
+		return nil, errors.Wrap(err, "unable to write notes")
+	}
+	return doc, nil
+}
+
+// ExportAll streams the notes of every document with annotations into one file, books are in title
+// order and documents in the trash are left out.
+func (s *annotationService) ExportAll(ctx context.Context, format string) (*Export, error) {
+	if _, ok := exportTypes[format]; !ok {
+		return nil, ErrInvalidFormat
+	}
+	docs, err := s.docService.FindAll(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.repo.FindAllAnnotations(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch annotations from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	byDocument := map[string][]*Annotation{}
+	for _, a := range all {
+		byDocument[a.DocumentID] = append(byDocument[a.DocumentID], a)
+	}
+
+	now := time.Now().UTC()
+	export := &Export{
+		Name:    fmt.Sprintf("annotations-%s-%s.%s", now.Format("20060102T150405Z"), uuid.New().String()[:8], exportTypes[format].ext),
+		Format:  format,
+		Created: now,
+	}
+	books := []*Notes{}
+	for _, doc := range docs {
+		list, ok := byDocument[doc.ID]
+		if !ok {
+			continue
+		}
+		books = append(books, newNotes(doc, list))
+		export.Documents++
+		export.Annotations += len(list)
+	}
+	sort.SliceStable(books, func(i, j int) bool {
+		return strings.ToLower(books[i].Title) < strings.ToLower(books[j].Title)
+	})
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeNotes(pw, format, books))
+	}()
+	if _, err := s.storage.Save(ctx, exportKey(common.UserID(ctx), export.Name), pr); err != nil {
+		pr.CloseWithError(err)
+		logrus.WithError(err).Error("unable to save annotation export")
+		return nil, errors.Wrap(err, "unable to save annotation export")
+	}
+	logrus.WithFields(logrus.Fields{"name": export.Name, "documents": export.Documents, "annotations": export.Annotations}).Info("annotations exported")
+	return export, nil
+}
+
+// OpenExport only looks in the folder of the user of the context, so names can't be used to
+// read anyone else's notes.
+func (s *annotationService) OpenExport(ctx context.Context, name string) (io.ReadCloser, string, error) {
+	if !exportName.MatchString(name) {
+		return nil, "", ErrExportNotFound
+	}
+	r, err := s.storage.Reader(ctx, exportKey(common.UserID(ctx), name))
+	if err != nil {
+		logrus.WithError(err).WithField("name", name).Warn("unable to open annotation export")
+		return nil, "", ErrExportNotFound
+	}
+	return r, exportFormatOf(name), nil
+}
+
+func (s *annotationService) document(ctx context.Context, id string) (*documents.Document, error) {
+	doc, err := s.docService.FindByID(ctx, id)
+	if errors.Cause(err) == documents.ErrNotFound {
+		return nil, documents.ErrNotFound
+	}
+	return doc, err
+}
+
+// validate normalises an annotation and checks it against the document it is anchored to.
+func validate(doc *documents.Document, annotation *Annotation) error {
+	annotation.Start = strings.TrimSpace(annotation.Start)
+	annotation.End = strings.TrimSpace(annotation.End)
+	annotation.Text = strings.TrimSpace(annotation.Text)
+	annotation.Note = strings.TrimSpace(annotation.Note)
+	annotation.Color = strings.ToLower(strings.TrimSpace(annotation.Color))
+
+	if annotation.End == "" {
+		annotation.End = annotation.Start
+	}
+	if !doc.ValidLocation(annotation.Start) || !doc.ValidLocation(annotation.End) {
+		return ErrInvalidLocation
+	}
+	if start, end := documents.LocationKindle(annotation.Start), documents.LocationKindle(annotation.End); start > 0 || end > 0 {
+		if start == 0 || end < start {
+			return ErrInvalidLocation
+		}
+	} else if doc.Format != documents.FormatEpub && documents.LocationPage(annotation.End) < documents.LocationPage(annotation.Start) {
+		return ErrInvalidLocation
+	}
+
+	switch annotation.Kind {
+	case KindHighlight:
+		if annotation.Text == "" {
+			return ErrEmptyHighlight
+		}
+	case KindNote:
+		if annotation.Note == "" {
+			return ErrEmptyNote
+		}
+	default:
+		return ErrInvalidKind
+	}
+	if !colors[annotation.Color] && !hexColor.MatchString(annotation.Color) {
+		return ErrInvalidColor
+	}
+	return nil
+}
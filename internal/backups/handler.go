@@ -0,0 +1,60 @@
+package backups
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+func MakeBackupHandler(mr *mux.Router, service BackupService) http.Handler {
+	r := mr.PathPrefix("/admin/backups").Subrouter()
+
+	h := &backupHandler{
+		service: service,
+	}
+
+	r.HandleFunc("", h.Create).Methods("POST")
+	r.HandleFunc("/", h.Create).Methods("POST")
+	r.HandleFunc("/{name}/restore", h.Restore).Methods("POST")
+
+	return r
+}
+
+type backupHandler struct {
+	service BackupService
+}
+
+func (h *backupHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	backup, err := h.service.Create(ctx)
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "backup", "Server Error", "create")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	common.EncodeResponse(r.Context(), w, backup)
+}
+
+func (h *backupHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := mux.Vars(r)["name"]
+
+	backup, err := h.service.Restore(ctx, name)
+	switch errors.Cause(err) {
+	case nil:
+	case ErrInvalidName, ErrInvalidArchive, ErrUnsupportedVersion:
+		common.MakeError(w, http.StatusBadRequest, "backup", err.Error(), "restore")
+		return
+	case ErrNotFound:
+		common.MakeError(w, http.StatusNotFound, "backup", err.Error(), "restore")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "backup", "Server Error", "restore")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, backup)
+}
@@ -0,0 +1,318 @@
+package backups
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/holmes89/book-organizer/internal/users"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// FormatVersion is written to the manifest of every backup, restores refuse archives from a newer version.
+// Version 2 added reading progress, version 3 annotations, version 4 user accounts and version 5
+// tags per user.
+const FormatVersion = 5
+
+// Files in a backup archive, the manifest comes first so an archive can be checked before the rest is read.
+const (
+	manifestFile    = "manifest.json"
+	documentsFile   = "documents.json"
+	tagsFile        = "tags.json"
+	contentFile     = "content.json"
+	progressFile    = "progress.json"
+	annotationsFile = "annotations.json"
+	usersFile       = "users.json"
+)
+
+var (
+	ErrInvalidName        = errors.New("invalid backup name")
+	ErrNotFound           = errors.New("backup not found")
+	ErrInvalidArchive     = errors.New("invalid backup archive")
+	ErrUnsupportedVersion = errors.New("unsupported backup version")
+)
+
+// Backup describes an archive of the catalog, it is stored as the archive's manifest.
+type Backup struct {
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	Created   time.Time `json:"created"`
+	Documents int       `json:"documents"`
+	Tags      int       `json:"tags"`
+}
+
+// Catalog is everything a backup holds. Document files and covers stay in the bucket, documents
+// keep their ids so they still line up after a restore.
+type Catalog struct {
+	Documents   []*documents.Document
+	Tags        []*tags.Tag
+	Content     map[string]string // extracted text by document id
+	Progress    []*progress.Progress
+	Annotations []*annotations.Annotation
+	Users       []*users.User // empty for archives from before accounts, restoring them keeps the current accounts
+}
+
+// ownTags gives the tags of an archive from before tags were per user to the owners of the
+// documents they are on, a tag on documents of several users is copied for each of them. Tags
+// left without an owner are given to the first admin on start like documents.
+func ownTags(catalog *Catalog) {
+	byID := map[string]*tags.Tag{}
+	for _, tag := range catalog.Tags {
+		if tag.UserID == "" {
+			byID[tag.ID] = tag
+		}
+	}
+	owned := map[string]map[string]string{} // tag id to the id of the tag for each owner
+	for _, doc := range catalog.Documents {
+		if doc.UserID == "" {
+			continue
+		}
+		for i, id := range doc.Tags {
+			tag, ok := byID[id]
+			if !ok {
+				continue
+			}
+			if owned[id] == nil {
+				owned[id] = map[string]string{}
+			}
+			copyID, ok := owned[id][doc.UserID]
+			if !ok {
+				// the first owner keeps the tag itself
+				copyID = id
+				if len(owned[id]) == 0 {
+					tag.UserID = doc.UserID
+				} else {
+					c := *tag
+					c.ID = uuid.New().String()
+					c.UserID = doc.UserID
+					catalog.Tags = append(catalog.Tags, &c)
+					copyID = c.ID
+				}
+				owned[id][doc.UserID] = copyID
+			}
+			doc.Tags[i] = copyID
+		}
+	}
+}
+
+// account is a user as it is written to an archive, unlike the api it keeps the password hash.
+type account struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	Admin        bool      `json:"admin"`
+	Created      time.Time `json:"created"`
+}
+
+type BackupService interface {
+	Create(ctx context.Context) (*Backup, error)
+	Restore(ctx context.Context, name string) (*Backup, error)
+}
+
+// BackupRepository methods are prefixed so a single database type can also implement the document repository.
+type BackupRepository interface {
+	ExportCatalog(ctx context.Context) (*Catalog, error)
+	// RestoreCatalog replaces every document, tag, tag link, reading progress and annotation with the
+	// catalog, and the users when it has any.
+	RestoreCatalog(ctx context.Context, catalog *Catalog) error
+}
+
+type backupService struct {
+	storage common.BackupStorage
+	repo    BackupRepository
+}
+
+func NewBackupService(storage common.BackupStorage, repo BackupRepository) BackupService {
+	return &backupService{
+		storage: storage,
+		repo:    repo,
+	}
+}
+
+// Create exports the catalog of every user and streams it into a new archive in backup storage.
+func (s *backupService) Create(ctx context.Context) (*Backup, error) {
+	catalog, err := s.repo.ExportCatalog(common.SystemContext(ctx))
+	if err != nil {
+		logrus.WithError(err).Error("unable to export catalog")
+		return nil, errors.Wrap(err, "unable to export catalog")
+	}
+
+	now := time.Now().UTC()
+	backup := &Backup{
+		Name:      fmt.Sprintf("catalog-%s.tar.gz", now.Format("20060102T150405Z")),
+		Version:   FormatVersion,
+		Created:   now,
+		Documents: len(catalog.Documents),
+		Tags:      len(catalog.Tags),
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeArchive(pw, backup, catalog))
+	}()
+	if _, err := s.storage.Save(ctx, common.BackupPrefix+backup.Name, pr); err != nil {
+		pr.CloseWithError(err)
+		logrus.WithError(err).Error("unable to save backup")
+		return nil, errors.Wrap(err, "unable to save backup")
+	}
+	logrus.WithFields(logrus.Fields{"name": backup.Name, "documents": backup.Documents, "tags": backup.Tags}).Info("backup created")
+	return backup, nil
+}
+
+// Restore reads a whole archive before replacing the catalog so a damaged archive leaves the
+// repository untouched.
+func (s *backupService) Restore(ctx context.Context, name string) (*Backup, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, ErrInvalidName
+	}
+	r, err := s.storage.Reader(ctx, common.BackupPrefix+name)
+	if err != nil {
+		logrus.WithError(err).WithField("name", name).Warn("unable to open backup")
+		return nil, ErrNotFound
+	}
+	defer r.Close()
+
+	backup, catalog, err := readArchive(r)
+	if err != nil {
+		logrus.WithError(err).WithField("name", name).Error("unable to read backup")
+		return nil, err
+	}
+	backup.Name = name
+
+	// documents from before accounts go to whoever restores them, or to the first admin on start
+	if len(catalog.Users) == 0 {
+		for _, doc := range catalog.Documents {
+			if doc.UserID == "" {
+				doc.UserID = common.UserID(ctx)
+			}
+		}
+	}
+	if backup.Version < 5 {
+		ownTags(catalog)
+	}
+	if err := s.repo.RestoreCatalog(common.SystemContext(ctx), catalog); err != nil {
+		logrus.WithError(err).WithField("name", name).Error("unable to restore catalog")
+		return nil, errors.Wrap(err, "unable to restore catalog")
+	}
+	logrus.WithFields(logrus.Fields{"name": name, "documents": backup.Documents, "tags": backup.Tags}).Info("backup restored")
+	return backup, nil
+}
+
+func writeArchive(w io.Writer, backup *Backup, catalog *Catalog) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range []struct {
+		name string
+		v    interface{}
+	}{
+		{manifestFile, backup},
+		{documentsFile, catalog.Documents},
+		{tagsFile, catalog.Tags},
+		{contentFile, catalog.Content},
+		{progressFile, catalog.Progress},
+		{annotationsFile, catalog.Annotations},
+		{usersFile, accountsOf(catalog.Users)},
+	} {
+		b, err := json.Marshal(f.v)
+		if err != nil {
+			return errors.Wrapf(err, "unable to encode %s", f.name)
+		}
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(b)), ModTime: backup.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func readArchive(r io.Reader) (*Backup, *Catalog, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, ErrInvalidArchive
+	}
+	tr := tar.NewReader(gz)
+
+	var backup *Backup
+	var accounts []*account
+	catalog := &Catalog{Content: map[string]string{}}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, ErrInvalidArchive
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, ErrInvalidArchive
+		}
+
+		var v interface{}
+		switch hdr.Name {
+		case manifestFile:
+			backup = &Backup{}
+			v = backup
+		case documentsFile:
+			v = &catalog.Documents
+		case tagsFile:
+			v = &catalog.Tags
+		case contentFile:
+			v = &catalog.Content
+		case progressFile:
+			v = &catalog.Progress
+		case annotationsFile:
+			v = &catalog.Annotations
+		case usersFile:
+			v = &accounts
+		default:
+			logrus.WithField("file", hdr.Name).Warn("ignoring unknown file in backup")
+			continue
+		}
+		if backup == nil {
+			// the version decides how the rest is read
+			return nil, nil, ErrInvalidArchive
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return nil, nil, errors.Wrap(ErrInvalidArchive, err.Error())
+		}
+		if hdr.Name == manifestFile && backup.Version > FormatVersion {
+			return nil, nil, ErrUnsupportedVersion
+		}
+	}
+	if backup == nil {
+		return nil, nil, ErrInvalidArchive
+	}
+	for _, a := range accounts {
+		catalog.Users = append(catalog.Users, &users.User{ID: a.ID, Username: a.Username, PasswordHash: a.PasswordHash, Admin: a.Admin, Created: a.Created})
+	}
+	backup.Documents = len(catalog.Documents)
+	backup.Tags = len(catalog.Tags)
+	return backup, catalog, nil
+}
+
+func accountsOf(list []*users.User) []*account {
+	accounts := []*account{}
+	for _, u := range list {
+		accounts = append(accounts, &account{ID: u.ID, Username: u.Username, PasswordHash: u.PasswordHash, Admin: u.Admin, Created: u.Created})
+	}
+	return accounts
+}
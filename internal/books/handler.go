@@ -4,6 +4,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/holmes89/book-organizer/internal/common"
 	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/sirupsen/logrus"
 	"net/http"
 )
 
@@ -39,19 +40,26 @@ func (h *bookHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	displayName, ok := r.MultipartForm.Value["name"]
-	if !ok {
-		common.MakeError(w, http.StatusBadRequest, "book", "Name missing from form", "create")
-		return
-	}
-
+	// without a name the title embedded in the file is used
 	book := &documents.Document{
-		DisplayName: displayName[0],
+		DisplayName: r.FormValue("name"),
 		Name:        fileHeader.Filename,
 		Type:        "book",
 	}
 
-	if err := h.service.Add(ctx, file, book); err != nil {
+	err = h.service.Add(ctx, file, book)
+	if dup, ok := err.(*documents.DuplicateError); ok {
+		// point the client at the book that is already stored
+		logrus.WithField("id", dup.Existing.ID).Info("duplicate upload")
+		w.Header().Set("Location", "/books/"+dup.Existing.ID)
+		w.WriteHeader(http.StatusConflict)
+		common.EncodeResponse(r.Context(), w, map[string]interface{}{
+			"error":    dup.Error(),
+			"document": dup.Existing,
+		})
+		return
+	}
+	if err != nil {
 		common.MakeError(w, http.StatusInternalServerError, "book", err.Error(), "add")
 		return
 	}
@@ -63,8 +71,18 @@ func (h *bookHandler) Create(w http.ResponseWriter, r *http.Request) {
 func (h *bookHandler) FindAll(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	entity, err := h.service.FindAll(ctx)
+	opts, err := documents.ParseListOptions(r)
+	if err != nil {
+		common.MakeError(w, http.StatusBadRequest, "book", err.Error(), "findall")
+		return
+	}
 
+	entity, err := h.service.FindAll(ctx, opts)
+
+	if err == documents.ErrInvalidSort {
+		common.MakeError(w, http.StatusBadRequest, "book", err.Error(), "findall")
+		return
+	}
 	if err != nil {
 		common.MakeError(w, http.StatusInternalServerError, "book", "Server Error", "findall")
 		return
@@ -86,6 +104,10 @@ func (h *bookHandler) FindByID(w http.ResponseWriter, r *http.Request) {
 
 	entity, err := h.service.FindByID(ctx, id)
 
+	if err == documents.ErrNotFound {
+		common.MakeError(w, http.StatusNotFound, "document", err.Error(), "findbyid")
+		return
+	}
 	if err != nil {
 		common.MakeError(w, http.StatusInternalServerError, "document", "Server Error", "findbyid")
 		return
@@ -9,7 +9,7 @@ import (
 )
 
 type BookService interface {
-	FindAll(ctx context.Context) ([]*documents.Document, error)
+	FindAll(ctx context.Context, opts documents.ListOptions) (*documents.DocumentPage, error)
 	FindByID(ctx context.Context, id string) (*documents.Document, error)
 	Add(ctx context.Context, file multipart.File, book *documents.Document) error
 }
@@ -24,18 +24,27 @@ func NewBookService(docService documents.DocumentService) BookService {
 	}
 }
 
-func (s *service) FindAll(ctx context.Context) ([]*documents.Document, error) {
-	m := map[string]interface{}{"type": "book"}
-	entities, err := s.docService.FindAll(ctx, m)
+func (s *service) FindAll(ctx context.Context, opts documents.ListOptions) (*documents.DocumentPage, error) {
+	if opts.Filter == nil {
+		opts.Filter = map[string]interface{}{}
+	}
+	opts.Filter["type"] = "book"
+	page, err := s.docService.FindPage(ctx, opts)
+	if err == documents.ErrInvalidSort {
+		return nil, err
+	}
 	if err != nil {
 		logrus.WithError(err).Error("unable to fetch books from repository")
 		return nil, errors.Wrap(err, "unable to fetch from repository")
 	}
-	return entities, nil
+	return page, nil
 }
 
 func (s *service) FindByID(ctx context.Context, id string) (*documents.Document, error) {
 	entity, err := s.docService.FindByID(ctx, id)
+	if err == documents.ErrNotFound {
+		return nil, err
+	}
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("unable to fetch book from repository")
 		return nil, errors.Wrap(err, "unable to fetch from repository")
@@ -46,7 +55,11 @@ func (s *service) FindByID(ctx context.Context, id string) (*documents.Document,
 func (s *service) Add(ctx context.Context, file multipart.File, book *documents.Document) error {
 	book.Type = "book"
 
-	if err := s.docService.Add(ctx, file, book); err != nil {
+	err := s.docService.Add(ctx, file, book)
+	if _, ok := err.(*documents.DuplicateError); ok {
+		return err
+	}
+	if err != nil {
 		logrus.WithError(err).Error("unable to save to repo")
 		return errors.Wrap(err, "failed to store data in repo")
 	}
@@ -0,0 +1,54 @@
+package calibre
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+func MakeCalibreHandler(mr *mux.Router, service CalibreService) http.Handler {
+	h := &calibreHandler{
+		service: service,
+	}
+
+	mr.HandleFunc("/admin/import/calibre", h.Import).Methods("POST")
+
+	return mr
+}
+
+type calibreHandler struct {
+	service CalibreService
+}
+
+type importRequest struct {
+	Path string `json:"path"` // library folder on the server
+}
+
+func (h *calibreHandler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	req := importRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logrus.WithError(err).Error("unable to decode import request")
+		common.MakeError(w, http.StatusBadRequest, "calibre", "Bad Request", "import")
+		return
+	}
+	defer r.Body.Close()
+
+	job, err := h.service.Import(ctx, req.Path)
+	switch err {
+	case nil:
+	case ErrInvalidPath, ErrNotLibrary:
+		common.MakeError(w, http.StatusBadRequest, "calibre", err.Error(), "import")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "calibre", "Server Error", "import")
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	common.EncodeResponse(r.Context(), w, job)
+}
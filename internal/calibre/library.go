@@ -0,0 +1,222 @@
+package calibre
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/extract"
+	_ "github.com/mattn/go-sqlite3" // Calibre keeps its catalog in sqlite
+	"github.com/pkg/errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MetadataFile is the catalog at the root of every Calibre library.
+const MetadataFile = "metadata.db"
+
+// coverFile is the cover Calibre keeps in each book folder.
+const coverFile = "cover.jpg"
+
+// Book is a book as Calibre catalogs it, a book has one file per format.
+type Book struct {
+	ID          int64
+	Title       string
+	Authors     []string
+	Series      string
+	SeriesIndex float64
+	Tags        []string
+	Rating      float64 // stars out of five
+	Publisher   string
+	Language    string
+	ISBN        string
+	Description string
+	Path        string // folder of the book relative to the library
+	HasCover    bool
+	Files       []File
+}
+
+// File is one format of a book.
+type File struct {
+	Format string // upper case as Calibre stores it, EPUB or PDF
+	Name   string // file name without the extension
+}
+
+// FilePath is where a format of the book is stored relative to the library, a catalog entry that
+// points outside the library is ErrOutsideLibrary.
+func (b *Book) FilePath(f File) (string, error) {
+	return libraryPath(b.Path, b.fileName(f))
+}
+
+// CoverPath is where the cover of the book is stored relative to the library.
+func (b *Book) CoverPath() (string, error) {
+	return libraryPath(b.Path, coverFile)
+}
+
+// CatalogPath is the file of a format as the catalog names it, for reporting it when FilePath
+// rejects it.
+func (b *Book) CatalogPath(f File) string {
+	return b.Path + "/" + b.fileName(f)
+}
+
+func (b *Book) fileName(f File) string {
+	return f.Name + "." + strings.ToLower(f.Format)
+}
+
+// libraryPath joins the folder and file names the catalog stores, which use slashes, and checks
+// they stay within the library.
+func libraryPath(dir string, name string) (string, error) {
+	path := filepath.Join(filepath.FromSlash(dir), filepath.FromSlash(name))
+	if !inside(path) {
+		return "", ErrOutsideLibrary
+	}
+	return path, nil
+}
+
+// inside reports whether a cleaned path relative to the library doesn't leave it.
+func inside(rel string) bool {
+	return !filepath.IsAbs(rel) && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// openLibraryFile opens a file of the library by its path relative to the library, symbolic links
+// are followed first so one can't lead out of the library.
+func openLibraryFile(library string, path string) (*os.File, error) {
+	root, err := filepath.EvalSymlinks(library)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, path))
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || !inside(rel) {
+		return nil, ErrOutsideLibrary
+	}
+	return os.Open(resolved)
+}
+
+// readLibrary loads every book in the catalog of the library at dir, the catalog is opened read only
+// so a running Calibre isn't disturbed.
+func readLibrary(ctx context.Context, dir string) ([]*Book, error) {
+	path := filepath.Join(dir, MetadataFile)
+	if _, err := os.Stat(path); err != nil {
+		return nil, ErrNotLibrary
+	}
+	db, err := sql.Open("sqlite3", "file:"+(&url.URL{Path: path}).EscapedPath()+"?mode=ro")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open calibre catalog")
+	}
+	defer db.Close()
+
+	rows, err := sq.Select("id", "title", "path", "has_cover", "COALESCE(series_index, 1)").
+		From("books").OrderBy("id").
+		RunWith(db).QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read calibre books")
+	}
+	var books []*Book
+	byID := map[int64]*Book{}
+	for rows.Next() {
+		book := &Book{}
+		if err := rows.Scan(&book.ID, &book.Title, &book.Path, &book.HasCover, &book.SeriesIndex); err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "unable to read calibre books")
+		}
+		books = append(books, book)
+		byID[book.ID] = book
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to read calibre books")
+	}
+
+	// values linked to books, each query returns the book id and the value
+	links := []struct {
+		query sq.SelectBuilder
+		apply func(book *Book, value string)
+	}{
+		{
+			sq.Select("l.book", "a.name").From("books_authors_link l").Join("authors a ON a.id = l.author").OrderBy("l.id"),
+			func(book *Book, value string) {
+				// Calibre swaps commas in names for bars
+				book.Authors = append(book.Authors, strings.Replace(value, "|", ",", -1))
+			},
+		},
+		{
+			sq.Select("l.book", "s.name").From("books_series_link l").Join("series s ON s.id = l.series"),
+			func(book *Book, value string) { book.Series = value },
+		},
+		{
+			sq.Select("l.book", "t.name").From("books_tags_link l").Join("tags t ON t.id = l.tag").OrderBy("t.name"),
+			func(book *Book, value string) { book.Tags = append(book.Tags, value) },
+		},
+		{
+			// ratings are stored out of ten
+			sq.Select("l.book", "r.rating").From("books_ratings_link l").Join("ratings r ON r.id = l.rating"),
+			func(book *Book, value string) {
+				rating, _ := strconv.ParseFloat(value, 64)
+				book.Rating = rating / 2
+			},
+		},
+		{
+			sq.Select("l.book", "p.name").From("books_publishers_link l").Join("publishers p ON p.id = l.publisher"),
+			func(book *Book, value string) { book.Publisher = value },
+		},
+		{
+			sq.Select("l.book", "lang.lang_code").From("books_languages_link l").Join("languages lang ON lang.id = l.lang_code").OrderBy("l.item_order DESC"),
+			func(book *Book, value string) { book.Language = value },
+		},
+		{
+			sq.Select("book", "COALESCE(text, '')").From("comments"),
+			func(book *Book, value string) { book.Description = extract.HTMLText(value) },
+		},
+		{
+			sq.Select("book", "val").From("identifiers").Where(sq.Eq{"type": "isbn"}),
+			func(book *Book, value string) { book.ISBN = value },
+		},
+	}
+	for _, link := range links {
+		if err := readLinks(ctx, db, link.query, byID, link.apply); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err = sq.Select("book", "format", "name").From("data").OrderBy("book", "format").
+		RunWith(db).QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read calibre formats")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		f := File{}
+		if err := rows.Scan(&id, &f.Format, &f.Name); err != nil {
+			return nil, errors.Wrap(err, "unable to read calibre formats")
+		}
+		if book, ok := byID[id]; ok {
+			book.Files = append(book.Files, f)
+		}
+	}
+	return books, rows.Err()
+}
+
+func readLinks(ctx context.Context, db *sql.DB, query sq.SelectBuilder, books map[int64]*Book, apply func(book *Book, value string)) error {
+	rows, err := query.RunWith(db).QueryContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to read calibre metadata")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return errors.Wrap(err, "unable to read calibre metadata")
+		}
+		if book, ok := books[id]; ok {
+			apply(book, value)
+		}
+	}
+	return rows.Err()
+}
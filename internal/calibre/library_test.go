@@ -0,0 +1,84 @@
+package calibre
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilePath(t *testing.T) {
+	tests := []struct {
+		name string
+		book Book
+		file File
+		want string
+		err  error
+	}{
+		{"book folder", Book{Path: "Frank Herbert/Dune (1)"}, File{Format: "EPUB", Name: "Dune - Frank Herbert"}, filepath.FromSlash("Frank Herbert/Dune (1)/Dune - Frank Herbert.epub"), nil},
+		{"dots within the library", Book{Path: "Author/../Other/Book (2)"}, File{Format: "PDF", Name: "Book"}, filepath.FromSlash("Other/Book (2)/Book.pdf"), nil},
+		{"folder climbs out", Book{Path: "../../etc"}, File{Format: "PDF", Name: "passwd"}, "", ErrOutsideLibrary},
+		{"name climbs out", Book{Path: "Author/Book (3)"}, File{Format: "EPUB", Name: "../../../secret"}, "", ErrOutsideLibrary},
+		{"absolute folder", Book{Path: "/etc"}, File{Format: "PDF", Name: "passwd"}, "", ErrOutsideLibrary},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.book.FilePath(tt.file)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (&Book{Path: ".."}).CoverPath(); err != ErrOutsideLibrary {
+		t.Errorf("got error %v for a cover outside the library, want %v", err, ErrOutsideLibrary)
+	}
+}
+
+func TestOpenLibraryFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calibre")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	library := filepath.Join(dir, "library")
+	outside := filepath.Join(dir, "secret.epub")
+	for _, path := range []string{filepath.Join(library, "Author", "Book (1)", "Book.epub"), outside} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte("book"), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(library, "Author", "Book (1)", "Link.epub")); err != nil {
+		t.Skipf("unable to create symbolic link: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(library, "Author"), filepath.Join(library, "Alias")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		err  error
+	}{
+		{"file", filepath.Join("Author", "Book (1)", "Book.epub"), nil},
+		{"link within the library", filepath.Join("Alias", "Book (1)", "Book.epub"), nil},
+		{"link out of the library", filepath.Join("Author", "Book (1)", "Link.epub"), ErrOutsideLibrary},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := openLibraryFile(library, tt.path)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if file != nil {
+				file.Close()
+			}
+		})
+	}
+}
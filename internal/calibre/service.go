@@ -0,0 +1,258 @@
+package calibre
+
+import (
+	"bytes"
+	"context"
+	"github.com/holmes89/book-organizer/internal/covers"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImportJob imports a Calibre library in the background, the report is kept as the job result.
+const ImportJob = "calibre.import"
+
+var (
+	ErrInvalidPath = errors.New("library path required")
+	ErrNotLibrary  = errors.New("no calibre library at path")
+
+	// ErrOutsideLibrary is a book or cover the catalog places outside the library folder.
+	ErrOutsideLibrary = errors.New("file is outside the library")
+)
+
+// What happened to each file of an import.
+const (
+	FileImported    = "imported"
+	FileDuplicate   = "duplicate"   // already in the catalog, it is left as it is
+	FileUnsupported = "unsupported" // a format documents can't be made from
+	FileFailed      = "failed"
+)
+
+// Import reports what a Calibre import added to the catalog.
+type Import struct {
+	Library     string        `json:"library"`
+	Books       int           `json:"books"`
+	Imported    int           `json:"imported"`
+	Duplicates  int           `json:"duplicates"`
+	Unsupported int           `json:"unsupported"`
+	Failed      int           `json:"failed"`
+	Files       []*ImportFile `json:"files"`
+	Started     time.Time     `json:"started"`
+	Finished    time.Time     `json:"finished"`
+}
+
+// ImportFile is the outcome for one format of a Calibre book, DocumentID is the existing
+// document for a duplicate.
+type ImportFile struct {
+	BookID     int64  `json:"book_id"`
+	Title      string `json:"title"`
+	Path       string `json:"path"`
+	Status     string `json:"status"`
+	DocumentID string `json:"document_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type CalibreService interface {
+	// Import queues an import of the library and returns its job, the Import report is the
+	// result of the job once it has finished.
+	Import(ctx context.Context, library string) (*jobs.Job, error)
+}
+
+type calibreService struct {
+	docService documents.DocumentService
+	tagService tags.TagService
+	jobs       jobs.JobService
+}
+
+func NewCalibreService(docService documents.DocumentService, tagService tags.TagService, jobService jobs.JobService) CalibreService {
+	s := &calibreService{
+		docService: docService,
+		tagService: tagService,
+		jobs:       jobService,
+	}
+	jobService.Register(ImportJob, s.importJob)
+	return s
+}
+
+type importJobPayload struct {
+	Library string `json:"library"`
+}
+
+// Import checks the folder holds a Calibre library before queuing the import so a wrong path
+// is reported right away.
+func (s *calibreService) Import(ctx context.Context, library string) (*jobs.Job, error) {
+	library = strings.TrimSpace(library)
+	if library == "" {
+		return nil, ErrInvalidPath
+	}
+	if _, err := os.Stat(filepath.Join(library, MetadataFile)); err != nil {
+		return nil, ErrNotLibrary
+	}
+
+	job, err := s.jobs.Enqueue(ctx, ImportJob, importJobPayload{Library: library})
+	if err != nil {
+		logrus.WithError(err).WithField("library", library).Error("unable to queue calibre import")
+		return nil, errors.Wrap(err, "unable to queue import")
+	}
+	return job, nil
+}
+
+// importJob runs as the user who queued it so the documents are theirs.
+func (s *calibreService) importJob(ctx context.Context, job *jobs.Job) error {
+	payload := importJobPayload{}
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(errors.Wrap(err, "invalid job payload"))
+	}
+
+	report, err := s.importLibrary(ctx, payload.Library)
+	if err == ErrNotLibrary {
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	return job.SetResult(report)
+}
+
+// importLibrary adds the books of the Calibre library in the given folder to the catalog, each
+// format becomes a document carrying the Calibre metadata and cover. Files already in the catalog
+// are reported as duplicates so an import can be run again after adding books to Calibre.
+func (s *calibreService) importLibrary(ctx context.Context, library string) (*Import, error) {
+	report := &Import{Library: library, Started: time.Now(), Files: []*ImportFile{}}
+
+	books, err := readLibrary(ctx, library)
+	if err != nil {
+		if err != ErrNotLibrary {
+			logrus.WithError(err).WithField("library", library).Error("unable to read calibre library")
+		}
+		return nil, err
+	}
+	report.Books = len(books)
+
+	for _, book := range books {
+		cover := s.cover(library, book)
+		for _, f := range book.Files {
+			file := &ImportFile{BookID: book.ID, Title: book.Title}
+			if path, err := book.FilePath(f); err != nil {
+				file.Path, file.Status, file.Error = book.CatalogPath(f), FileFailed, err.Error()
+				logrus.WithField("path", file.Path).Warn("calibre file outside library")
+			} else {
+				file.Path = filepath.ToSlash(path)
+				s.importFile(ctx, library, path, book, f, cover, file)
+			}
+			switch file.Status {
+			case FileImported:
+				report.Imported++
+			case FileDuplicate:
+				report.Duplicates++
+			case FileUnsupported:
+				report.Unsupported++
+			case FileFailed:
+				report.Failed++
+			}
+			report.Files = append(report.Files, file)
+		}
+	}
+	report.Finished = time.Now()
+
+	logrus.WithFields(logrus.Fields{
+		"library":    library,
+		"books":      report.Books,
+		"imported":   report.Imported,
+		"duplicates": report.Duplicates,
+		"failed":     report.Failed,
+	}).Info("calibre library imported")
+	return report, nil
+}
+
+func (s *calibreService) importFile(ctx context.Context, library string, path string, book *Book, f File, cover []byte, result *ImportFile) {
+	file, err := openLibraryFile(library, path)
+	if err == ErrOutsideLibrary {
+		result.Status, result.Error = FileFailed, err.Error()
+		logrus.WithField("path", result.Path).Warn("calibre file outside library")
+		return
+	}
+	if err != nil {
+		result.Status, result.Error = FileFailed, "unable to open file"
+		logrus.WithError(err).WithField("path", result.Path).Warn("unable to open calibre file")
+		return
+	}
+	defer file.Close()
+
+	doc := &documents.Document{
+		DisplayName: book.Title,
+		Name:        f.Name,
+		Type:        "book",
+		Description: book.Description,
+		Title:       book.Title,
+		Authors:     book.Authors,
+		Publisher:   book.Publisher,
+		Language:    book.Language,
+		ISBN:        book.ISBN,
+		Series:      book.Series,
+		Rating:      book.Rating,
+	}
+	if book.Series != "" {
+		// every Calibre book has an index, it only means something in a series
+		doc.SeriesIndex = book.SeriesIndex
+	}
+	var coverReader io.Reader
+	if cover != nil {
+		coverReader = bytes.NewReader(cover)
+	}
+
+	err = s.docService.Import(ctx, file, doc, coverReader)
+	if dup, ok := err.(*documents.DuplicateError); ok {
+		result.Status, result.DocumentID = FileDuplicate, dup.Existing.ID
+		return
+	}
+	switch errors.Cause(err) {
+	case nil:
+	case documents.ErrInvalidFileType:
+		result.Status, result.Error = FileUnsupported, err.Error()
+		return
+	default:
+		result.Status, result.Error = FileFailed, err.Error()
+		return
+	}
+	result.Status, result.DocumentID = FileImported, doc.ID
+
+	for _, name := range book.Tags {
+		// the document is stored, a missing tag isn't worth failing it over
+		if err := s.tagService.Attach(ctx, doc.ID, &tags.Tag{Name: name}); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"id": doc.ID, "tag": name}).Warn("unable to tag imported document")
+		}
+	}
+}
+
+// cover loads the cover of a book as a thumbnail, nil when there isn't one it can use so one
+// is generated from the file instead.
+func (s *calibreService) cover(library string, book *Book) []byte {
+	if !book.HasCover {
+		return nil
+	}
+	path, err := book.CoverPath()
+	if err != nil {
+		logrus.WithError(err).WithField("book", book.ID).Warn("unable to open calibre cover")
+		return nil
+	}
+	file, err := openLibraryFile(library, path)
+	if err != nil {
+		logrus.WithError(err).WithField("book", book.ID).Warn("unable to open calibre cover")
+		return nil
+	}
+	defer file.Close()
+	thumbnail, err := covers.Resize(file)
+	if err != nil {
+		logrus.WithError(err).WithField("book", book.ID).Warn("unable to read calibre cover")
+		return nil
+	}
+	return thumbnail.Bytes()
+}
@@ -3,6 +3,14 @@ package common
 import (
 	"github.com/sirupsen/logrus"
 	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	PostgresDatabaseType = "postgres"
+	MemoryDatabaseType   = "memory"
+	SQLiteDatabaseType   = "sqlite"
 )
 
 type Config struct {
@@ -12,10 +20,15 @@ type Config struct {
 }
 
 func LoadConfig() Config {
-	dbType := GetEnv("DB_TYPE", "postgres")
+	dbType := GetEnv("DB_TYPE", PostgresDatabaseType)
+	switch dbType {
+	case PostgresDatabaseType, MemoryDatabaseType, SQLiteDatabaseType:
+	default:
+		logrus.WithField("type", dbType).Fatal("unsupported database type")
+	}
 
 	config := &Config{
-		DatabaseType: GetEnv("DB_TYPE", "postgres"),
+		DatabaseType: dbType,
 	}
 
 	logrus.WithField("type", dbType).Info("loading database config")
@@ -33,10 +46,23 @@ func (c *Config) LoadPostgresDatabaseConfig() PostgresDatabaseConfig {
 	}
 }
 
+type SQLiteDatabaseConfig struct {
+	Path string
+}
+
+func (c *Config) LoadSQLiteDatabaseConfig() SQLiteDatabaseConfig {
+
+	return SQLiteDatabaseConfig{
+		Path: GetEnv("SQLITE_PATH", "./books.db"),
+	}
+}
+
 type BucketConfig struct {
 	ConnectionString string
 	AccessID         string
 	AccessKey        string
+	BaseURL          string
+	SigningKey       string
 }
 
 func (c *Config) LoadBucketConfig() BucketConfig {
@@ -47,6 +73,86 @@ func (c *Config) LoadBucketConfig() BucketConfig {
 		ConnectionString: host,
 		AccessID:         accessID,
 		AccessKey:        key,
+		BaseURL:          GetEnv("BASE_URL", "http://localhost:8080"),
+		SigningKey:       GetEnv("SIGNING_KEY", os.Getenv("JWT_SECRET")),
+	}
+}
+
+type CoverConfig struct {
+	Endpoint string // optional external thumbnail service
+}
+
+func (c *Config) LoadCoverConfig() CoverConfig {
+	return CoverConfig{
+		Endpoint: os.Getenv("COVER_ENDPOINT"),
+	}
+}
+
+type JobConfig struct {
+	Workers       int
+	PollInterval  time.Duration
+	Lease         time.Duration // how long a claimed job stays locked without a heartbeat
+	Retention     time.Duration // how long finished jobs are kept
+	CleanInterval time.Duration
+}
+
+func (c *Config) LoadJobConfig() JobConfig {
+	workers, err := strconv.Atoi(GetEnv("JOB_WORKERS", "2"))
+	if err != nil || workers < 1 {
+		logrus.WithField("workers", os.Getenv("JOB_WORKERS")).Fatal("invalid job worker count")
+	}
+	days, err := strconv.Atoi(GetEnv("JOB_RETENTION_DAYS", "7"))
+	if err != nil || days < 0 {
+		logrus.WithField("days", os.Getenv("JOB_RETENTION_DAYS")).Fatal("invalid job retention")
+	}
+	return JobConfig{
+		Workers:       workers,
+		PollInterval:  time.Second,
+		Lease:         5 * time.Minute,
+		Retention:     time.Duration(days) * 24 * time.Hour,
+		CleanInterval: time.Hour,
+	}
+}
+
+type TrashConfig struct {
+	Retention     time.Duration // how long deleted documents stay restorable
+	PurgeInterval time.Duration
+}
+
+func (c *Config) LoadTrashConfig() TrashConfig {
+	days, err := strconv.Atoi(GetEnv("TRASH_RETENTION_DAYS", "30"))
+	if err != nil || days < 0 {
+		logrus.WithField("days", os.Getenv("TRASH_RETENTION_DAYS")).Fatal("invalid trash retention")
+	}
+	return TrashConfig{
+		Retention:     time.Duration(days) * 24 * time.Hour,
+		PurgeInterval: time.Hour,
+	}
+}
+
+// AuthConfig signs the tokens users log in with. The admin account is created on start when
+// there are no users yet.
+type AuthConfig struct {
+	Secret        string
+	TokenTTL      time.Duration
+	AdminUsername string
+	AdminPassword string
+}
+
+func (c *Config) LoadAuthConfig() AuthConfig {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		logrus.Fatal("jwt secret required")
+	}
+	hours, err := strconv.Atoi(GetEnv("TOKEN_TTL_HOURS", "720"))
+	if err != nil || hours < 1 {
+		logrus.WithField("hours", os.Getenv("TOKEN_TTL_HOURS")).Fatal("invalid token ttl")
+	}
+	return AuthConfig{
+		Secret:        secret,
+		TokenTTL:      time.Duration(hours) * time.Hour,
+		AdminUsername: os.Getenv("ADMIN_USERNAME"),
+		AdminPassword: os.Getenv("ADMIN_PASSWORD"),
 	}
 }
 
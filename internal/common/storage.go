@@ -3,17 +3,35 @@ package common
 import (
 	"context"
 	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	gcaws "gocloud.dev/aws"
 	"gocloud.dev/blob"
+	"gocloud.dev/blob/driver"
+	"gocloud.dev/blob/fileblob"
 	"gocloud.dev/blob/gcsblob"
-	_ "gocloud.dev/blob/gcsblob"
+	"gocloud.dev/blob/memblob"
+	"gocloud.dev/blob/s3blob"
+	"gocloud.dev/gcerrors"
 	"gocloud.dev/gcp"
 	"io"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
+// BackupPrefix keeps catalog backups apart from documents in the bucket.
+const BackupPrefix = "backups/"
+
+var (
+	ErrSignedURLUnsupported = errors.New("storage does not verify signed urls")
+	ErrInvalidSeek          = errors.New("invalid seek")
+)
+
 type DocumentSave interface {
 	Save(ctx context.Context, fileName string, reader io.Reader) (path string, err error)
 }
@@ -24,16 +42,28 @@ type BackupSave interface {
 
 type DocumentGet interface {
 	Get(ctx context.Context, path string) (string, error)
-	List(ctx context.Context) <-chan string
+	List(ctx context.Context, fn func(path string) error) error
+	Reader(ctx context.Context, path string) (io.ReadCloser, error)
+	Open(ctx context.Context, path string) (*Object, error)
 }
 
 type BackupReader interface {
 	Reader(ctx context.Context, path string) (io.ReadCloser, error)
 }
 
+type DocumentDelete interface {
+	Delete(ctx context.Context, path string) error
+}
+
+type DocumentMove interface {
+	Move(ctx context.Context, from string, to string) error
+}
+
 type DocumentStorage interface {
 	DocumentSave
 	DocumentGet
+	DocumentDelete
+	DocumentMove
 }
 
 type BackupStorage interface {
@@ -43,19 +73,33 @@ type BackupStorage interface {
 
 type BucketStorage struct {
 	Bucket *blob.Bucket
+	Signer fileblob.URLSigner // only set for buckets that are served by this application
 }
 
+// NewBucketStorage opens the storage backend matching the scheme of BUCKET_HOST:
+// gs:// for GCS, s3:// for S3 compatible stores, file:// for local disk and mem:// for memory.
 func NewBucketStorage(config BucketConfig) *BucketStorage {
-	bucket, err := blob.OpenBucket(context.Background(), config.ConnectionString)
+	u, err := url.Parse(config.ConnectionString)
 	if err != nil {
-		logrus.WithError(err).Fatal("unable to connect to bucket")
+		logrus.WithError(err).Fatal("unable to parse bucket host")
 	}
-	return &BucketStorage{
-		Bucket: bucket,
+
+	logrus.WithField("scheme", u.Scheme).Info("opening bucket")
+	switch u.Scheme {
+	case gcsblob.Scheme:
+		return NewGCPBucketStorage(config)
+	case s3blob.Scheme:
+		return NewS3BucketStorage(config)
+	case fileblob.Scheme:
+		return NewLocalBucketStorage(config)
+	case memblob.Scheme:
+		return NewMemoryBucketStorage(config)
 	}
+
+	logrus.WithField("scheme", u.Scheme).Fatal("unsupported bucket scheme")
+	return nil
 }
 
-// TODO redo this to pass in variables
 func NewGCPBucketStorage(config BucketConfig) *BucketStorage {
 	ctx := context.Background()
 
@@ -104,6 +148,94 @@ func NewGCPBucketStorage(config BucketConfig) *BucketStorage {
 	}
 }
 
+// NewS3BucketStorage connects to S3 or an S3 compatible store such as MinIO. Region, endpoint,
+// disableSSL and s3ForcePathStyle may be set as query parameters on the bucket host. ACCESS_ID and
+// ACCESS_KEY are used as static credentials, otherwise the default AWS credential chain applies.
+func NewS3BucketStorage(config BucketConfig) *BucketStorage {
+	ctx := context.Background()
+
+	urlParts, err := url.Parse(config.ConnectionString)
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to parse bucket host")
+	}
+
+	awsConfig, err := gcaws.ConfigFromURLParams(urlParts.Query())
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid s3 bucket options")
+	}
+
+	if config.AccessID != "" && config.AccessKey != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(config.AccessID, config.AccessKey, "")
+	} else {
+		logrus.Warn("unable to find access information using default aws credentials")
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to create aws session")
+	}
+
+	bucket, err := s3blob.OpenBucket(ctx, sess, urlParts.Host, nil)
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to open s3 bucket")
+	}
+	return &BucketStorage{
+		Bucket: bucket,
+	}
+}
+
+// NewLocalBucketStorage stores documents on disk in the directory named by the bucket host,
+// e.g. file:///var/books or file://./data for a path relative to the working directory.
+func NewLocalBucketStorage(config BucketConfig) *BucketStorage {
+	urlParts, err := url.Parse(config.ConnectionString)
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to parse bucket host")
+	}
+	dir := urlParts.Path
+	if urlParts.Host == "." {
+		dir = strings.TrimPrefix(dir, "/")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logrus.WithError(err).Fatal("unable to create local storage directory")
+	}
+
+	signer := newURLSigner(config)
+	bucket, err := fileblob.OpenBucket(filepath.FromSlash(dir), &fileblob.Options{URLSigner: signer})
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to open local bucket")
+	}
+	return &BucketStorage{
+		Bucket: bucket,
+		Signer: signer,
+	}
+}
+
+// NewMemoryBucketStorage keeps documents in memory, they are lost when the server stops.
+func NewMemoryBucketStorage(config BucketConfig) *BucketStorage {
+	return &BucketStorage{
+		Bucket: memblob.OpenBucket(nil),
+		Signer: newURLSigner(config),
+	}
+}
+
+// newURLSigner creates download urls that point back at this server's /files/ endpoint and are
+// signed with SigningKey so they expire like GCS signed urls.
+func newURLSigner(config BucketConfig) fileblob.URLSigner {
+	if config.SigningKey == "" {
+		logrus.Fatal("signing key required for locally served storage")
+	}
+
+	baseURL, err := url.Parse(config.BaseURL + "/files/")
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to parse base url")
+	}
+	return fileblob.NewURLSignerHMAC(baseURL, []byte(config.SigningKey))
+}
+
 func NewBucketDocumentStorage(storage *BucketStorage) DocumentStorage {
 	return storage
 }
@@ -112,7 +244,11 @@ func NewBackupStorage(storage *BucketStorage) BackupStorage {
 	return storage
 }
 
+// Save uploads the content of reader, a failed upload is abandoned rather than leaving part of the
+// file stored.
 func (s *BucketStorage) Save(ctx context.Context, fileName string, reader io.Reader) (path string, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	w, err := s.Bucket.NewWriter(ctx, fileName, nil)
 	if err != nil {
@@ -120,17 +256,33 @@ func (s *BucketStorage) Save(ctx context.Context, fileName string, reader io.Rea
 		return "", errors.Wrap(err, "unable to creat upload writer")
 	}
 
-	defer w.Close()
-
 	if _, err := io.Copy(w, reader); err != nil {
+		// the writer discards what it has when its context is cancelled before closing
+		cancel()
+		w.Close()
 		logrus.WithError(err).Error("failed to upload file")
 		return "", errors.Wrap(err, "failed to upload file")
 	}
+	if err := w.Close(); err != nil {
+		logrus.WithError(err).Error("failed to finish upload")
+		return "", errors.Wrap(err, "failed to finish upload")
+	}
 
-	return fileName, err //TODO allow for custom directory?
+	return fileName, nil //TODO allow for custom directory?
 }
 
 func (s *BucketStorage) Get(ctx context.Context, path string) (string, error) {
+	if s.Signer != nil {
+		u, err := s.Signer.URLFromKey(ctx, path, &driver.SignedURLOptions{
+			Expiry: 15 * time.Hour,
+			Method: "GET",
+		})
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	}
+
 	opts := &blob.SignedURLOptions{
 		Expiry: 15 * time.Hour,
 		Method: "GET",
@@ -138,35 +290,156 @@ func (s *BucketStorage) Get(ctx context.Context, path string) (string, error) {
 	return s.Bucket.SignedURL(ctx, path, opts)
 }
 
+// KeyFromSignedURL validates a url created by Get and returns the path it grants access to.
+func (s *BucketStorage) KeyFromSignedURL(ctx context.Context, u *url.URL) (string, error) {
+	if s.Signer == nil {
+		return "", ErrSignedURLUnsupported
+	}
+	return s.Signer.KeyFromURL(ctx, u)
+}
+
 func (s *BucketStorage) Reader(ctx context.Context, path string) (io.ReadCloser, error) {
 	return s.Bucket.NewReader(ctx, path, nil)
 }
 
-func (s *BucketStorage) List(ctx context.Context) <-chan string {
-	opts := &blob.ListOptions{}
-	iter := s.Bucket.List(opts)
-	out := make(chan string)
-	go func() {
-		defer close(out)
-		bgctx := context.Background()
-		for {
-			for {
-				obj, err := iter.Next(bgctx)
-				if err == io.EOF {
-					logrus.Info("file search complete")
-					return
-				}
-				if err != nil {
-					logrus.WithError(err).Error("unable to fetch object")
-					return
-				}
-				if obj.IsDir {
-					logrus.WithField("name", obj.Key).Debug("directory found")
-					continue
-				}
-				out <- obj.Key
-			}
+// Open returns the file at path for reading from any offset.
+func (s *BucketStorage) Open(ctx context.Context, path string) (*Object, error) {
+	attrs, err := s.Bucket.Attributes(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		ctx:         ctx,
+		bucket:      s.Bucket,
+		key:         path,
+		Size:        attrs.Size,
+		ModTime:     attrs.ModTime,
+		ContentType: attrs.ContentType,
+	}, nil
+}
+
+// Object is a stored file that can be read from any offset, it is an io.ReadSeeker so it can be
+// served with http.ServeContent which seeks to answer range requests, and an io.ReaderAt for the
+// extractors. Only the bytes read are fetched from the bucket.
+type Object struct {
+	ctx    context.Context
+	bucket *blob.Bucket
+	key    string
+	offset int64
+	reader *blob.Reader // open from offset until the next seek
+
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+func (o *Object) Read(p []byte) (int, error) {
+	if o.offset >= o.Size {
+		return 0, io.EOF
+	}
+	if o.reader == nil {
+		r, err := o.bucket.NewRangeReader(o.ctx, o.key, o.offset, -1, nil)
+		if err != nil {
+			return 0, err
+		}
+		o.reader = r
+	}
+	n, err := o.reader.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+// ReadAt fetches the range it is asked for on its own, it doesn't move the offset Read continues from.
+func (o *Object) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+	if off >= o.Size {
+		return 0, io.EOF
+	}
+	length := int64(len(p))
+	if rest := o.Size - off; length > rest {
+		length = rest
+	}
+	r, err := o.bucket.NewRangeReader(o.ctx, o.key, off, length, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	n, err := io.ReadFull(r, p[:length])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (o *Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.Size
+	default:
+		return 0, ErrInvalidSeek
+	}
+	if offset < 0 {
+		return 0, ErrInvalidSeek
+	}
+	if offset != o.offset && o.reader != nil {
+		o.reader.Close()
+		o.reader = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *Object) Close() error {
+	if o.reader == nil {
+		return nil
+	}
+	err := o.reader.Close()
+	o.reader = nil
+	return err
+}
+
+// Delete removes a file, a file that is already gone isn't an error.
+func (s *BucketStorage) Delete(ctx context.Context, path string) error {
+	if err := s.Bucket.Delete(ctx, path); err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+		logrus.WithError(err).WithField("path", path).Error("unable to delete file")
+		return errors.Wrap(err, "unable to delete file")
+	}
+	return nil
+}
+
+// Move copies a file to a new key within the bucket and deletes the original.
+func (s *BucketStorage) Move(ctx context.Context, from string, to string) error {
+	if err := s.Bucket.Copy(ctx, to, from, nil); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"from": from, "to": to}).Error("unable to copy file")
+		return errors.Wrap(err, "unable to copy file")
+	}
+	return s.Delete(ctx, from)
+}
+
+// List calls fn with the key of every file in the bucket, it stops at the first error fn returns.
+func (s *BucketStorage) List(ctx context.Context, fn func(path string) error) error {
+	iter := s.Bucket.List(&blob.ListOptions{})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			logrus.Info("file search complete")
+			return nil
+		}
+		if err != nil {
+			logrus.WithError(err).Error("unable to fetch object")
+			return err
 		}
-	}()
-	return out
+		if obj.IsDir {
+			logrus.WithField("name", obj.Key).Debug("directory found")
+			continue
+		}
+		if err := fn(obj.Key); err != nil {
+			return err
+		}
+	}
 }
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"context"
+	"gocloud.dev/blob/memblob"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestObjectReadAt(t *testing.T) {
+	ctx := context.Background()
+	s := &BucketStorage{Bucket: memblob.OpenBucket(nil)}
+	if _, err := s.Save(ctx, "book.txt", strings.NewReader("0123456789")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	obj, err := s.Open(ctx, "book.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer obj.Close()
+
+	tests := []struct {
+		name   string
+		offset int64
+		length int
+		want   string
+		err    error
+	}{
+		{"start", 0, 4, "0123", nil},
+		{"middle", 3, 4, "3456", nil},
+		{"whole file", 0, 10, "0123456789", nil},
+		{"past the end", 8, 4, "89", io.EOF},
+		{"at the end", 10, 1, "", io.EOF},
+		{"negative offset", -1, 1, "", ErrInvalidSeek},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.length)
+			n, err := obj.ReadAt(p, tt.offset)
+			if err != tt.err {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+			if got := string(p[:n]); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// reading at an offset doesn't move where Read continues from
+	obj.Seek(6, io.SeekStart)
+	obj.ReadAt(make([]byte, 2), 1)
+	rest := make([]byte, 4)
+	if n, _ := io.ReadFull(obj, rest); string(rest[:n]) != "6789" {
+		t.Errorf("read %q after ReadAt, want %q", rest[:n], "6789")
+	}
+}
@@ -0,0 +1,49 @@
+package common
+
+import "context"
+
+type userKey struct{}
+
+type systemKey struct{}
+
+// User is who a request is made for. Repositories only return documents owned by the user of
+// the context and nothing for a context without one, work the server does across every library
+// has to ask for a SystemContext.
+type User struct {
+	ID    string
+	Admin bool
+}
+
+func ContextWithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(context.WithValue(ctx, systemKey{}, false), userKey{}, user)
+}
+
+// SystemContext lifts the scoping of a context for work that spans every library, such as
+// backups or checking whether a stored file is still used by anyone. Any user of the context is
+// dropped so nothing done with it is attributed to them.
+func SystemContext(ctx context.Context) context.Context {
+	return context.WithValue(context.WithValue(ctx, userKey{}, nil), systemKey{}, true)
+}
+
+// IsSystem reports whether the context is for work across every library.
+func IsSystem(ctx context.Context) bool {
+	system, _ := ctx.Value(systemKey{}).(bool)
+	return system
+}
+
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userKey{}).(User)
+	return user, ok
+}
+
+// UserID is the id of the user of the context, empty when there is none.
+func UserID(ctx context.Context) string {
+	user, _ := UserFromContext(ctx)
+	return user.ID
+}
+
+// IsAdmin reports whether the context is for an admin.
+func IsAdmin(ctx context.Context) bool {
+	user, _ := UserFromContext(ctx)
+	return user.Admin
+}
@@ -0,0 +1,18 @@
+package covers
+
+import (
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/sirupsen/logrus"
+)
+
+// NewCoverGenerator uses the external cover service when an endpoint is configured and
+// generates thumbnails in process otherwise.
+func NewCoverGenerator(config common.CoverConfig, storage common.DocumentStorage) documents.CoverGenerator {
+	if config.Endpoint != "" {
+		logrus.WithField("endpoint", config.Endpoint).Info("using cover service")
+		return NewHTTPGenerator(config.Endpoint)
+	}
+	logrus.Info("using built in cover generator")
+	return NewThumbnailGenerator(storage)
+}
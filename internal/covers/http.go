@@ -0,0 +1,51 @@
+package covers
+
+import (
+	"context"
+	"github.com/go-resty/resty/v2"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+type httpGenerator struct {
+	client *resty.Client
+	url    string
+}
+
+// NewHTTPGenerator hands cover creation to an external thumbnail service, which writes the
+// cover to the bucket at the path it is sent.
+func NewHTTPGenerator(endpoint string) documents.CoverGenerator {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	return &httpGenerator{
+		client: resty.New(),
+		url:    strings.TrimSuffix(endpoint, "/") + "/thumbnail/",
+	}
+}
+
+type coverRequest struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	CoverPath string `json:"cover_path"`
+}
+
+func (g *httpGenerator) Generate(ctx context.Context, doc *documents.Document) error {
+	logrus.Infof("calling %s", g.url)
+	resp, err := g.client.
+		R().
+		SetContext(ctx).
+		SetBody(coverRequest{ID: doc.ID, Path: doc.Path, CoverPath: documents.CoverPath(doc.ID)}).
+		Post(g.url)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to call cover service")
+	}
+	if resp.StatusCode() != http.StatusCreated {
+		return errors.Errorf("cover service responded %d", resp.StatusCode())
+	}
+	return nil
+}
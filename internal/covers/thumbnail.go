@@ -0,0 +1,139 @@
+package covers
+
+import (
+	"bytes"
+	"context"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/extract"
+	"github.com/pkg/errors"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+)
+
+// ThumbnailWidth is the width covers are scaled down to.
+const ThumbnailWidth = 300
+
+type thumbnailGenerator struct {
+	storage common.DocumentStorage
+}
+
+// NewThumbnailGenerator creates covers in process from the images embedded in documents.
+func NewThumbnailGenerator(storage common.DocumentStorage) documents.CoverGenerator {
+	return &thumbnailGenerator{
+		storage: storage,
+	}
+}
+
+func (g *thumbnailGenerator) Generate(ctx context.Context, doc *documents.Document) error {
+	// only the parts of the document the extractor looks at are fetched
+	obj, err := g.storage.Open(ctx, doc.Path)
+	if err != nil {
+		return errors.Wrap(err, "unable to open document")
+	}
+	defer obj.Close()
+
+	img, err := extract.Cover(obj, obj.Size, documents.FormatMIME(doc.Format))
+	if err == extract.ErrNoCover && doc.Format == documents.FormatPdf {
+		// pages aren't rendered, stand in for a first page without artwork
+		img, err = placeholder(doc), nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to find cover")
+	}
+
+	buf, err := encode(img)
+	if err != nil {
+		return err
+	}
+	if _, err := g.storage.Save(ctx, documents.CoverPath(doc.ID), buf); err != nil {
+		return errors.Wrap(err, "unable to save cover")
+	}
+	return nil
+}
+
+// placeholderColors are the backgrounds of generated covers, picked by title so a book keeps its color.
+var placeholderColors = []color.RGBA{
+	{R: 0x3b, G: 0x5b, B: 0x7a, A: 0xff},
+	{R: 0x7a, G: 0x3b, B: 0x3b, A: 0xff},
+	{R: 0x3b, G: 0x6b, B: 0x4f, A: 0xff},
+	{R: 0x6b, G: 0x4f, B: 0x7a, A: 0xff},
+	{R: 0x8a, G: 0x6a, B: 0x2f, A: 0xff},
+	{R: 0x4a, G: 0x4a, B: 0x4a, A: 0xff},
+}
+
+// placeholder draws a plain cover with a darker spine and a light title panel.
+func placeholder(doc *documents.Document) image.Image {
+	width, height := ThumbnailWidth, ThumbnailWidth*3/2
+	h := fnv.New32a()
+	h.Write([]byte(doc.DisplayName + doc.Title))
+	bg := placeholderColors[int(h.Sum32()%uint32(len(placeholderColors)))]
+	spine := color.RGBA{R: bg.R / 2, G: bg.G / 2, B: bg.B / 2, A: 0xff}
+	panel := color.RGBA{R: 0xf2, G: 0xee, B: 0xe4, A: 0xff}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, width/12, height), &image.Uniform{C: spine}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(width/6, height/5, width*11/12, height*2/5), &image.Uniform{C: panel}, image.Point{}, draw.Src)
+	return img
+}
+
+// Resize turns a cover image kept alongside a document into a thumbnail like the generated ones.
+func Resize(r io.Reader) (*bytes.Buffer, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode cover")
+	}
+	return encode(img)
+}
+
+func encode(img image.Image) (*bytes.Buffer, error) {
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, thumbnail(img, ThumbnailWidth), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, errors.Wrap(err, "unable to encode cover")
+	}
+	return buf, nil
+}
+
+// thumbnail scales an image down to the given width, averaging the source pixels each
+// thumbnail pixel covers. Images already narrower are returned as they are.
+func thumbnail(img image.Image, width int) image.Image {
+	src := img.Bounds()
+	if src.Dx() <= width || src.Dx() == 0 {
+		return img
+	}
+	height := src.Dy() * width / src.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := src.Min.Y + y*src.Dy()/height
+		y1 := src.Min.Y + (y+1)*src.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < width; x++ {
+			x0 := src.Min.X + x*src.Dx()/width
+			x1 := src.Min.X + (x+1)*src.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
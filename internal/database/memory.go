@@ -0,0 +1,375 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/holmes89/book-organizer/internal/users"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryDatabase keeps documents in a map, it is intended for tests and running without postgres.
+type MemoryDatabase struct {
+	mu          sync.RWMutex
+	docs        map[string]*documents.Document
+	tags        map[string]*tags.Tag
+	tagged      map[string]map[string]bool // resource id to tag ids
+	content     map[string]string          // extracted document text
+	jobs        map[string]*jobs.Job
+	scans       map[string]*documents.Scan
+	progress    map[string]*progress.Progress // reading progress by document id
+	annotations map[string]*annotations.Annotation
+	users       map[string]*users.User
+}
+
+func NewMemoryDatabase() Repository {
+	logrus.Info("using in memory database")
+	return &MemoryDatabase{
+		docs:        make(map[string]*documents.Document),
+		tags:        make(map[string]*tags.Tag),
+		tagged:      make(map[string]map[string]bool),
+		content:     make(map[string]string),
+		jobs:        make(map[string]*jobs.Job),
+		scans:       make(map[string]*documents.Scan),
+		progress:    make(map[string]*progress.Progress),
+		annotations: make(map[string]*annotations.Annotation),
+		users:       make(map[string]*users.User),
+	}
+}
+
+func (r *MemoryDatabase) FindAll(ctx context.Context, filter map[string]interface{}) ([]*documents.Document, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	docs := []*documents.Document{}
+	for _, doc := range r.docs {
+		if !owns(ctx, doc) {
+			continue
+		}
+		ok, err := r.matchesFilter(doc, filter)
+		if err != nil {
+			logrus.WithError(err).Error("unable to fetch results")
+			return nil, errors.New("unable to fetch results")
+		}
+		if ok {
+			docs = append(docs, r.copyDocument(doc))
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].DisplayName < docs[j].DisplayName
+	})
+	return docs, nil
+}
+
+func (r *MemoryDatabase) FindPage(ctx context.Context, opts documents.ListOptions) (*documents.DocumentPage, error) {
+	docs, err := r.FindAll(ctx, opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		a, b := docs[i], docs[j]
+		if opts.Descending {
+			a, b = b, a
+		}
+		switch opts.Sort {
+		case "created":
+			return a.Created.Before(b.Created)
+		case "updated":
+			return updatedTime(a).Before(updatedTime(b))
+		}
+		return a.DisplayName < b.DisplayName
+	})
+
+	page := &documents.DocumentPage{
+		Items:  []*documents.Document{},
+		Total:  len(docs),
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+	}
+	if opts.Offset < len(docs) {
+		end := len(docs)
+		if opts.Limit > 0 && opts.Offset+opts.Limit < end {
+			end = opts.Offset + opts.Limit
+		}
+		page.Items = docs[opts.Offset:end]
+	}
+	return page, nil
+}
+
+func updatedTime(doc *documents.Document) time.Time {
+	if doc.Updated == nil {
+		return time.Time{}
+	}
+	return *doc.Updated
+}
+
+func (r *MemoryDatabase) FindByID(ctx context.Context, id string) (*documents.Document, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	doc, ok := r.docs[id]
+	if !ok || !owns(ctx, doc) {
+		return nil, documents.ErrNotFound
+	}
+	return r.copyDocument(doc), nil
+}
+
+func (r *MemoryDatabase) Insert(ctx context.Context, doc *documents.Document) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.docs[doc.ID]; ok {
+		logrus.WithField("id", doc.ID).Warn("unable to insert doc")
+		return errors.New("unable to insert doc metadata")
+	}
+	r.insert(doc)
+	return nil
+}
+
+func (r *MemoryDatabase) insert(doc *documents.Document) {
+	stored := r.copyDocument(doc)
+	if stored.Created.IsZero() {
+		stored.Created = time.Now()
+	}
+	r.docs[doc.ID] = stored
+}
+
+func (r *MemoryDatabase) UpdateDocument(ctx context.Context, doc documents.Document) (documents.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.docs[doc.ID]
+	if !ok || !owns(ctx, stored) {
+		logrus.WithField("id", doc.ID).Error("unable to update doc")
+		return documents.Document{}, errors.New("unable to update doc")
+	}
+	t := time.Now()
+	stored.Description = doc.Description
+	stored.DisplayName = doc.DisplayName
+	stored.Type = doc.Type
+	stored.Title = doc.Title
+	stored.Authors = append([]string{}, doc.Authors...)
+	stored.Publisher = doc.Publisher
+	stored.Language = doc.Language
+	stored.ISBN = doc.ISBN
+	stored.PageCount = doc.PageCount
+	stored.Series = doc.Series
+	stored.SeriesIndex = doc.SeriesIndex
+	stored.Rating = doc.Rating
+	stored.Review = doc.Review
+	stored.Updated = &t
+
+	return doc, nil
+}
+
+func (r *MemoryDatabase) UpdateFile(ctx context.Context, doc documents.Document) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.docs[doc.ID]
+	if !ok || !owns(ctx, stored) {
+		logrus.WithField("id", doc.ID).Error("unable to update doc file")
+		return errors.New("unable to update doc file")
+	}
+	t := time.Now()
+	stored.Path = doc.Path
+	stored.Size = doc.Size
+	stored.Hash = doc.Hash
+	stored.Missing = nil
+	if doc.Missing != nil {
+		missing := *doc.Missing
+		stored.Missing = &missing
+	}
+	stored.Updated = &t
+	return nil
+}
+
+func (r *MemoryDatabase) UpdateDeleted(ctx context.Context, id string, deleted *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.docs[id]
+	if !ok || !owns(ctx, stored) {
+		logrus.WithField("id", id).Error("unable to update doc trash state")
+		return errors.New("unable to update doc trash state")
+	}
+	stored.Deleted = nil
+	if deleted != nil {
+		t := *deleted
+		stored.Deleted = &t
+	}
+	return nil
+}
+
+func (r *MemoryDatabase) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if doc, ok := r.docs[id]; !ok || !owns(ctx, doc) {
+		return documents.ErrNotFound
+	}
+	delete(r.docs, id)
+	delete(r.tagged, id)
+	delete(r.content, id)
+	delete(r.progress, id)
+	for annotationID, annotation := range r.annotations {
+		if annotation.DocumentID == id {
+			delete(r.annotations, annotationID)
+		}
+	}
+	return nil
+}
+
+// owns reports whether the document belongs to the user of the context, like ownerFilter.
+func owns(ctx context.Context, doc *documents.Document) bool {
+	if id := common.UserID(ctx); id != "" {
+		return doc.UserID == id
+	}
+	return common.IsSystem(ctx)
+}
+
+// ownsDocument is owns for a document id, an unknown document isn't owned by anyone.
+func (r *MemoryDatabase) ownsDocument(ctx context.Context, id string) bool {
+	doc, ok := r.docs[id]
+	return ok && owns(ctx, doc)
+}
+
+// copyDocument returns a copy safe to hand out, tags are read from the tagged resources like the sql joins.
+func (r *MemoryDatabase) copyDocument(doc *documents.Document) *documents.Document {
+	c := *doc
+	c.Tags = []string{}
+	for tagID := range r.tagged[doc.ID] {
+		c.Tags = append(c.Tags, tagID)
+	}
+	sort.Strings(c.Tags)
+	c.Authors = append([]string{}, doc.Authors...)
+	if doc.Updated != nil {
+		t := *doc.Updated
+		c.Updated = &t
+	}
+	if doc.Missing != nil {
+		t := *doc.Missing
+		c.Missing = &t
+	}
+	if doc.Deleted != nil {
+		t := *doc.Deleted
+		c.Deleted = &t
+	}
+	return &c
+}
+
+// matchesFilter applies the same equality filter the postgres queries build with squirrel,
+// a slice value matches any of its elements.
+func (r *MemoryDatabase) matchesFilter(doc *documents.Document, filter map[string]interface{}) (bool, error) {
+	switch filter[documents.TrashFilter] {
+	case documents.TrashOnly:
+		if doc.Deleted == nil {
+			return false, nil
+		}
+	case documents.TrashIncluded:
+	default:
+		if doc.Deleted != nil {
+			return false, nil
+		}
+	}
+	for key, expected := range filter {
+		switch key {
+		case documents.TrashFilter:
+			continue
+		case documents.TagFilter:
+			if !r.tagged[doc.ID][fmt.Sprint(expected)] {
+				return false, nil
+			}
+			continue
+		case documents.NamePrefixFilter:
+			if !strings.HasPrefix(strings.ToLower(doc.DisplayName), strings.ToLower(fmt.Sprint(expected))) {
+				return false, nil
+			}
+			continue
+		case documents.MissingFilter:
+			if (doc.Missing != nil) != (expected == true) {
+				return false, nil
+			}
+			continue
+		case documents.CreatedAfterFilter, documents.CreatedBeforeFilter:
+			t, ok := expected.(time.Time)
+			if !ok {
+				return false, fmt.Errorf("invalid time for %q", key)
+			}
+			if key == documents.CreatedAfterFilter && doc.Created.Before(t) {
+				return false, nil
+			}
+			if key == documents.CreatedBeforeFilter && !doc.Created.Before(t) {
+				return false, nil
+			}
+			continue
+		}
+		actual, ok := documentColumn(doc, key)
+		if !ok {
+			return false, fmt.Errorf("unknown column %q", key)
+		}
+		if !matchesValue(actual, expected) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func matchesValue(actual string, expected interface{}) bool {
+	v := reflect.ValueOf(expected)
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			if fmt.Sprint(v.Index(i).Interface()) == actual {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(expected) == actual
+}
+
+func documentColumn(doc *documents.Document, column string) (string, bool) {
+	switch column {
+	case "id", "documents.id":
+		return doc.ID, true
+	case "description":
+		return doc.Description, true
+	case "display_name":
+		return doc.DisplayName, true
+	case "name":
+		return doc.Name, true
+	case "type":
+		return doc.Type, true
+	case "path":
+		return doc.Path, true
+	case "title":
+		return doc.Title, true
+	case "publisher":
+		return doc.Publisher, true
+	case "language":
+		return doc.Language, true
+	case "isbn":
+		return doc.ISBN, true
+	case "format":
+		return doc.Format, true
+	case "hash":
+		return doc.Hash, true
+	case "series":
+		return doc.Series, true
+	case "user_id", "documents.user_id":
+		return doc.UserID, true
+	}
+	return "", false
+}
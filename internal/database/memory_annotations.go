@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"sort"
+)
+
+func (r *MemoryDatabase) FindAnnotations(ctx context.Context, documentID string) ([]*annotations.Annotation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*annotations.Annotation{}
+	for _, annotation := range r.annotations {
+		if annotation.DocumentID == documentID && r.ownsDocument(ctx, documentID) {
+			results = append(results, copyAnnotation(*annotation))
+		}
+	}
+	sortAnnotations(results)
+	return results, nil
+}
+
+func (r *MemoryDatabase) FindAllAnnotations(ctx context.Context) ([]*annotations.Annotation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*annotations.Annotation{}
+	for _, annotation := range r.annotations {
+		if !r.ownsDocument(ctx, annotation.DocumentID) {
+			continue
+		}
+		results = append(results, copyAnnotation(*annotation))
+	}
+	sortAnnotations(results)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].DocumentID < results[j].DocumentID
+	})
+	return results, nil
+}
+
+func (r *MemoryDatabase) FindAnnotationByID(ctx context.Context, id string) (*annotations.Annotation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	annotation, ok := r.annotations[id]
+	if !ok || !r.ownsDocument(ctx, annotation.DocumentID) {
+		return nil, annotations.ErrNotFound
+	}
+	return copyAnnotation(*annotation), nil
+}
+
+func (r *MemoryDatabase) InsertAnnotation(ctx context.Context, annotation *annotations.Annotation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.annotations[annotation.ID] = copyAnnotation(*annotation)
+	return nil
+}
+
+func (r *MemoryDatabase) InsertAnnotations(ctx context.Context, documentID string, list []*annotations.Annotation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, annotation := range list {
+		r.annotations[annotation.ID] = copyAnnotation(*annotation)
+	}
+	return nil
+}
+
+func (r *MemoryDatabase) UpdateAnnotation(ctx context.Context, annotation annotations.Annotation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.annotations[annotation.ID]; !ok || !r.ownsDocument(ctx, stored.DocumentID) {
+		return annotations.ErrNotFound
+	}
+	r.annotations[annotation.ID] = copyAnnotation(annotation)
+	return nil
+}
+
+func (r *MemoryDatabase) DeleteAnnotation(ctx context.Context, documentID string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if annotation, ok := r.annotations[id]; ok && annotation.DocumentID == documentID && r.ownsDocument(ctx, documentID) {
+		delete(r.annotations, id)
+	}
+	return nil
+}
+
+func copyAnnotation(annotation annotations.Annotation) *annotations.Annotation {
+	if annotation.Updated != nil {
+		t := *annotation.Updated
+		annotation.Updated = &t
+	}
+	return &annotation
+}
+
+// sortAnnotations orders annotations the way the sql queries do, oldest first.
+func sortAnnotations(list []*annotations.Annotation) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Created.Equal(list[j].Created) {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].Created.Before(list[j].Created)
+	})
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"github.com/holmes89/book-organizer/internal/backups"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/holmes89/book-organizer/internal/users"
+	"sort"
+)
+
+func (r *MemoryDatabase) ExportCatalog(ctx context.Context) (*backups.Catalog, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	catalog := &backups.Catalog{
+		Documents:   []*documents.Document{},
+		Tags:        []*tags.Tag{},
+		Content:     map[string]string{},
+		Progress:    []*progress.Progress{},
+		Annotations: []*annotations.Annotation{},
+		Users:       []*users.User{},
+	}
+	for _, doc := range r.docs {
+		catalog.Documents = append(catalog.Documents, r.copyDocument(doc))
+	}
+	for _, tag := range r.tags {
+		t := *tag
+		catalog.Tags = append(catalog.Tags, &t)
+	}
+	sortTags(catalog.Tags)
+	for id, content := range r.content {
+		if content != "" {
+			catalog.Content[id] = content
+		}
+	}
+	for _, p := range r.progress {
+		catalog.Progress = append(catalog.Progress, copyProgress(*p))
+	}
+	for _, a := range r.annotations {
+		catalog.Annotations = append(catalog.Annotations, copyAnnotation(*a))
+	}
+	sortAnnotations(catalog.Annotations)
+	for _, user := range r.users {
+		u := *user
+		catalog.Users = append(catalog.Users, &u)
+	}
+	sort.Slice(catalog.Users, func(i, j int) bool {
+		return catalog.Users[i].Created.Before(catalog.Users[j].Created)
+	})
+	return catalog, nil
+}
+
+func (r *MemoryDatabase) RestoreCatalog(ctx context.Context, catalog *backups.Catalog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.docs = make(map[string]*documents.Document)
+	r.tags = make(map[string]*tags.Tag)
+	r.tagged = make(map[string]map[string]bool)
+	r.content = make(map[string]string)
+	r.progress = make(map[string]*progress.Progress)
+	r.annotations = make(map[string]*annotations.Annotation)
+	if len(catalog.Users) > 0 {
+		r.users = make(map[string]*users.User)
+		for _, user := range catalog.Users {
+			u := *user
+			r.users[user.ID] = &u
+		}
+	}
+	for _, tag := range catalog.Tags {
+		t := *tag
+		r.tags[tag.ID] = &t
+	}
+	for _, doc := range catalog.Documents {
+		r.docs[doc.ID] = r.copyDocument(doc)
+		for _, tagID := range doc.Tags {
+			if _, ok := r.tags[tagID]; !ok {
+				continue
+			}
+			if r.tagged[doc.ID] == nil {
+				r.tagged[doc.ID] = map[string]bool{}
+			}
+			r.tagged[doc.ID][tagID] = true
+		}
+		if content, ok := catalog.Content[doc.ID]; ok {
+			r.content[doc.ID] = content
+		}
+	}
+	for _, p := range catalog.Progress {
+		if _, ok := r.docs[p.DocumentID]; ok {
+			r.progress[p.DocumentID] = copyProgress(*p)
+		}
+	}
+	for _, a := range catalog.Annotations {
+		if _, ok := r.docs[a.DocumentID]; ok {
+			r.annotations[a.ID] = copyAnnotation(*a)
+		}
+	}
+	return nil
+}
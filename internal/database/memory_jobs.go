@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"time"
+)
+
+func (r *MemoryDatabase) InsertJob(ctx context.Context, job *jobs.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j := *job
+	r.jobs[job.ID] = &j
+	return nil
+}
+
+func (r *MemoryDatabase) FindJobByID(ctx context.Context, id string) (*jobs.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, jobs.ErrNotFound
+	}
+	if !seesJob(ctx, job) {
+		return nil, jobs.ErrNotFound
+	}
+	j := *job
+	return &j, nil
+}
+
+func (r *MemoryDatabase) ClaimJob(ctx context.Context, now time.Time, lockedUntil time.Time) (*jobs.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var next *jobs.Job
+	for _, job := range r.jobs {
+		due := job.Status == jobs.StatusPending && !job.RunAt.After(now)
+		expired := job.Status == jobs.StatusRunning && job.LockedUntil != nil && job.LockedUntil.Before(now)
+		if !due && !expired {
+			continue
+		}
+		if next == nil || job.RunAt.Before(next.RunAt) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	next.Status = jobs.StatusRunning
+	next.Attempts++
+	next.Updated = &now
+	next.LockedUntil = &lockedUntil
+	j := *next
+	return &j, nil
+}
+
+func (r *MemoryDatabase) UpdateJob(ctx context.Context, job jobs.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.jobs[job.ID]; !ok {
+		return jobs.ErrNotFound
+	}
+	r.jobs[job.ID] = &job
+	return nil
+}
+
+func (r *MemoryDatabase) ExtendJobLease(ctx context.Context, id string, lockedUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, ok := r.jobs[id]; ok && job.Status == jobs.StatusRunning {
+		job.LockedUntil = &lockedUntil
+	}
+	return nil
+}
+
+func (r *MemoryDatabase) DeleteFinishedJobs(ctx context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for id, job := range r.jobs {
+		if job.Status != jobs.StatusSucceeded && job.Status != jobs.StatusFailed {
+			continue
+		}
+		if job.Updated != nil && job.Updated.Before(before) {
+			delete(r.jobs, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// seesJob reports whether the user of the context may see the job, like jobFilter.
+func seesJob(ctx context.Context, job *jobs.Job) bool {
+	if common.IsAdmin(ctx) || common.IsSystem(ctx) {
+		return true
+	}
+	id := common.UserID(ctx)
+	return id != "" && job.UserID == id
+}
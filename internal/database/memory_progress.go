@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"sort"
+	"time"
+)
+
+func (r *MemoryDatabase) FindAllProgress(ctx context.Context) ([]*progress.Progress, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*progress.Progress{}
+	for _, p := range r.progress {
+		if !r.ownsDocument(ctx, p.DocumentID) {
+			continue
+		}
+		results = append(results, copyProgress(*p))
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].DocumentID < results[j].DocumentID
+	})
+	return results, nil
+}
+
+func (r *MemoryDatabase) FindProgress(ctx context.Context, documentID string) (*progress.Progress, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.progress[documentID]
+	if !ok || !r.ownsDocument(ctx, documentID) {
+		return nil, progress.ErrNotFound
+	}
+	return copyProgress(*p), nil
+}
+
+func (r *MemoryDatabase) UpsertProgress(ctx context.Context, p progress.Progress) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.progress[p.DocumentID] = copyProgress(p)
+	return nil
+}
+
+func copyProgress(p progress.Progress) *progress.Progress {
+	for _, t := range []**time.Time{&p.Started, &p.Finished, &p.Updated} {
+		if *t != nil {
+			c := **t
+			*t = &c
+		}
+	}
+	return &p
+}
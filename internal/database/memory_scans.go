@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/documents"
+)
+
+func (r *MemoryDatabase) InsertScan(ctx context.Context, scan *documents.Scan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.scans[scan.ID] = copyScan(*scan)
+	return nil
+}
+
+func (r *MemoryDatabase) FindScanByID(ctx context.Context, id string) (*documents.Scan, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	scan, ok := r.scans[id]
+	if !ok {
+		return nil, documents.ErrScanNotFound
+	}
+	return copyScan(*scan), nil
+}
+
+func (r *MemoryDatabase) UpdateScan(ctx context.Context, scan documents.Scan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.scans[scan.ID]
+	if !ok {
+		return documents.ErrScanNotFound
+	}
+	scan.CancelRequested = existing.CancelRequested
+	r.scans[scan.ID] = copyScan(scan)
+	return nil
+}
+
+func (r *MemoryDatabase) RequestScanCancel(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scan, ok := r.scans[id]
+	if !ok {
+		return documents.ErrScanNotFound
+	}
+	scan.CancelRequested = true
+	return nil
+}
+
+func copyScan(scan documents.Scan) *documents.Scan {
+	scan.Errors = append([]documents.ScanError{}, scan.Errors...)
+	scan.Changes = append([]documents.ScanChange{}, scan.Changes...)
+	return &scan
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/search"
+	"sort"
+	"strings"
+)
+
+const memorySnippetWidth = 200
+
+func (r *MemoryDatabase) UpdateContent(ctx context.Context, id string, content string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.docs[id]; !ok {
+		return documents.ErrNotFound
+	}
+	r.content[id] = content
+	return nil
+}
+
+// SearchDocuments matches documents containing every term, weighting title matches above
+// metadata and body text.
+func (r *MemoryDatabase) SearchDocuments(ctx context.Context, query search.Query) ([]search.Hit, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	terms := search.Terms(query.Text)
+	hits := []search.Hit{}
+	for id, doc := range r.docs {
+		if doc.Deleted != nil || !owns(ctx, doc) {
+			continue
+		}
+		var tagNames []string
+		for tagID := range r.tagged[id] {
+			if tag, ok := r.tags[tagID]; ok {
+				tagNames = append(tagNames, tag.Name)
+			}
+		}
+		var notes []string
+		for _, annotation := range r.annotations {
+			if annotation.DocumentID == id {
+				notes = append(notes, annotation.Text, annotation.Note)
+			}
+		}
+		fields := []struct {
+			text   string
+			weight float64
+		}{
+			{doc.DisplayName, 10},
+			{doc.Name, 4},
+			{doc.Description, 4},
+			{strings.Join(tagNames, " "), 4},
+			{strings.Join(notes, " "), 2},
+			{r.content[id], 1},
+		}
+
+		rank := 0.0
+		matched := true
+		for _, term := range terms {
+			found := false
+			for _, field := range fields {
+				if n := strings.Count(strings.ToLower(field.text), term); n > 0 {
+					rank += field.weight * float64(n)
+					found = true
+				}
+			}
+			if !found {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		snippet := search.Highlight(doc.Description+" "+r.content[id], terms, memorySnippetWidth)
+		if snippet == "" {
+			snippet = search.Highlight(doc.DisplayName, terms, memorySnippetWidth)
+		}
+		hits = append(hits, search.Hit{ID: id, Rank: rank, Snippet: snippet})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank == hits[j].Rank {
+			return hits[i].ID < hits[j].ID
+		}
+		return hits[i].Rank > hits[j].Rank
+	})
+
+	total := len(hits)
+	if query.Offset >= total {
+		return []search.Hit{}, total, nil
+	}
+	end := query.Offset + query.Limit
+	if end > total {
+		end = total
+	}
+	return hits[query.Offset:end], total, nil
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"sort"
+	"strings"
+)
+
+func (r *MemoryDatabase) FindAllTags(ctx context.Context) ([]*tags.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*tags.Tag{}
+	for _, tag := range r.tags {
+		if ownsTag(ctx, tag) {
+			t := *tag
+			results = append(results, &t)
+		}
+	}
+	sortTags(results)
+	return results, nil
+}
+
+func (r *MemoryDatabase) FindTagByID(ctx context.Context, id string) (*tags.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tag, ok := r.tags[id]
+	if !ok || !ownsTag(ctx, tag) {
+		return nil, tags.ErrNotFound
+	}
+	t := *tag
+	return &t, nil
+}
+
+func (r *MemoryDatabase) FindTagByName(ctx context.Context, name string) (*tags.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, tag := range r.tags {
+		if ownsTag(ctx, tag) && strings.EqualFold(tag.Name, name) {
+			t := *tag
+			return &t, nil
+		}
+	}
+	return nil, tags.ErrNotFound
+}
+
+func (r *MemoryDatabase) InsertTag(ctx context.Context, tag *tags.Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tagNameExists(tag.UserID, tag.Name, tag.ID) {
+		return errors.New("tag already exists")
+	}
+	t := *tag
+	r.tags[tag.ID] = &t
+	return nil
+}
+
+func (r *MemoryDatabase) UpdateTag(ctx context.Context, tag tags.Tag) (tags.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tags[tag.ID]
+	if !ok || !ownsTag(ctx, stored) {
+		return tags.Tag{}, tags.ErrNotFound
+	}
+	if r.tagNameExists(stored.UserID, tag.Name, tag.ID) {
+		return tags.Tag{}, errors.New("tag already exists")
+	}
+	stored.Name = tag.Name
+	return *stored, nil
+}
+
+// tagNameExists reports whether the user has another tag by the name, like the unique index.
+func (r *MemoryDatabase) tagNameExists(userID string, name string, exclude string) bool {
+	for id, tag := range r.tags {
+		if id != exclude && tag.UserID == userID && strings.EqualFold(tag.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryDatabase) DeleteTag(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tag, ok := r.tags[id]; !ok || !ownsTag(ctx, tag) {
+		return tags.ErrNotFound
+	}
+	delete(r.tags, id)
+	for _, tagIDs := range r.tagged {
+		delete(tagIDs, id)
+	}
+	return nil
+}
+
+func (r *MemoryDatabase) FindTagsByResource(ctx context.Context, resourceID string) ([]*tags.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*tags.Tag{}
+	if !r.ownsDocument(ctx, resourceID) {
+		return results, nil
+	}
+	for tagID := range r.tagged[resourceID] {
+		if tag, ok := r.tags[tagID]; ok && ownsTag(ctx, tag) {
+			t := *tag
+			results = append(results, &t)
+		}
+	}
+	sortTags(results)
+	return results, nil
+}
+
+func (r *MemoryDatabase) TagResource(ctx context.Context, tagID string, resourceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tag, ok := r.tags[tagID]; !ok || !ownsTag(ctx, tag) {
+		return tags.ErrNotFound
+	}
+	if !r.ownsDocument(ctx, resourceID) {
+		return tags.ErrResourceNotFound
+	}
+	if r.tagged[resourceID] == nil {
+		r.tagged[resourceID] = make(map[string]bool)
+	}
+	r.tagged[resourceID][tagID] = true
+	return nil
+}
+
+func (r *MemoryDatabase) UntagResource(ctx context.Context, tagID string, resourceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ownsDocument(ctx, resourceID) {
+		delete(r.tagged[resourceID], tagID)
+	}
+	return nil
+}
+
+// ownsTag reports whether the tag belongs to the user of the context, like tagFilter.
+func ownsTag(ctx context.Context, tag *tags.Tag) bool {
+	if id := common.UserID(ctx); id != "" {
+		return tag.UserID == id
+	}
+	return common.IsSystem(ctx)
+}
+
+func sortTags(results []*tags.Tag) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"testing"
+	"time"
+)
+
+// TestScoping checks that everything belonging to one user is not found for anyone else, a
+// context without a user sees nothing and only a system context sees every library.
+func TestScoping(t *testing.T) {
+	r := NewMemoryDatabase().(*MemoryDatabase)
+	alice := common.ContextWithUser(context.Background(), common.User{ID: "alice"})
+
+	doc := &documents.Document{ID: "doc", Name: "dune.epub", UserID: "alice", Created: time.Now()}
+	if err := r.Insert(alice, doc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tag := &tags.Tag{ID: "tag", Name: "sci-fi", UserID: "alice"}
+	if err := r.InsertTag(alice, tag); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.TagResource(alice, tag.ID, doc.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.InsertAnnotation(alice, &annotations.Annotation{ID: "note", DocumentID: doc.ID}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.UpsertProgress(alice, progress.Progress{DocumentID: doc.ID}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.InsertJob(alice, &jobs.Job{ID: "job", UserID: "alice"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		visible bool
+		jobs    bool // admins see every job but not the documents of others
+	}{
+		{"owner", alice, true, true},
+		{"other user", common.ContextWithUser(context.Background(), common.User{ID: "bob"}), false, false},
+		{"other admin", common.ContextWithUser(context.Background(), common.User{ID: "carol", Admin: true}), false, true},
+		{"no user", context.Background(), false, false},
+		{"user dropped", common.ContextWithUser(context.Background(), common.User{}), false, false},
+		{"system", common.SystemContext(alice), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := func(what string, err error, notFound error) {
+				t.Helper()
+				switch {
+				case tt.visible && err != nil:
+					t.Errorf("%s: unexpected error: %v", what, err)
+				case !tt.visible && err != notFound:
+					t.Errorf("%s: got error %v, want %v", what, err, notFound)
+				}
+			}
+			_, err := r.FindByID(tt.ctx, doc.ID)
+			check("document", err, documents.ErrNotFound)
+			_, err = r.FindTagByID(tt.ctx, tag.ID)
+			check("tag", err, tags.ErrNotFound)
+			_, err = r.FindTagByName(tt.ctx, tag.Name)
+			check("tag by name", err, tags.ErrNotFound)
+			_, err = r.FindAnnotationByID(tt.ctx, "note")
+			check("annotation", err, annotations.ErrNotFound)
+			_, err = r.FindProgress(tt.ctx, doc.ID)
+			check("progress", err, progress.ErrNotFound)
+
+			if _, err := r.FindJobByID(tt.ctx, "job"); tt.jobs != (err == nil) {
+				t.Errorf("job: got error %v, visible %v", err, tt.jobs)
+			}
+
+			docs, err := r.FindAll(tt.ctx, map[string]interface{}{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := len(docs) == 1; got != tt.visible {
+				t.Errorf("listed %d documents, visible %v", len(docs), tt.visible)
+			}
+			tagList, _ := r.FindTagsByResource(tt.ctx, doc.ID)
+			if got := len(tagList) == 1; got != tt.visible {
+				t.Errorf("listed %d tags of the document, visible %v", len(tagList), tt.visible)
+			}
+			if tt.visible {
+				return
+			}
+			if err := r.TagResource(tt.ctx, tag.ID, doc.ID); err == nil {
+				t.Error("tagged a document of someone else")
+			}
+			if err := r.DeleteTag(tt.ctx, tag.ID); err != tags.ErrNotFound {
+				t.Errorf("delete tag: got error %v, want %v", err, tags.ErrNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/holmes89/book-organizer/internal/users"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+func (r *MemoryDatabase) FindAllUsers(ctx context.Context) ([]*users.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*users.User{}
+	for _, user := range r.users {
+		u := *user
+		results = append(results, &u)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Created.Before(results[j].Created)
+	})
+	return results, nil
+}
+
+func (r *MemoryDatabase) FindUserByID(ctx context.Context, id string) (*users.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, users.ErrNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+func (r *MemoryDatabase) FindUserByUsername(ctx context.Context, username string) (*users.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Username, username) {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, users.ErrNotFound
+}
+
+func (r *MemoryDatabase) InsertUser(ctx context.Context, user *users.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.ID == user.ID || strings.EqualFold(existing.Username, user.Username) {
+			logrus.WithField("id", user.ID).Warn("unable to insert user")
+			return errors.New("unable to insert user")
+		}
+	}
+	u := *user
+	r.users[user.ID] = &u
+	return nil
+}
+
+func (r *MemoryDatabase) UpdateUserPassword(ctx context.Context, id string, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return users.ErrNotFound
+	}
+	user.PasswordHash = passwordHash
+	return nil
+}
+
+func (r *MemoryDatabase) AdoptDocuments(ctx context.Context, userID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	adopted := 0
+	for _, doc := range r.docs {
+		if doc.UserID == "" {
+			doc.UserID = userID
+			adopted++
+		}
+	}
+	for _, tag := range r.tags {
+		if tag.UserID == "" && !r.tagNameExists(userID, tag.Name, tag.ID) {
+			tag.UserID = userID
+		}
+	}
+	return adopted, nil
+}
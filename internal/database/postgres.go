@@ -22,7 +22,7 @@ type PostgresDatabase struct {
 	conn *sql.DB
 }
 
-func NewPostgresDatabase(lc fx.Lifecycle, config common.PostgresDatabaseConfig) documents.DocumentRepository {
+func NewPostgresDatabase(lc fx.Lifecycle, config common.PostgresDatabaseConfig) Repository {
 	logrus.Info("connecting to postgres")
 	db, err := retryPostgres(3, 10*time.Second, func() (db *sql.DB, e error) {
 		return sql.Open("postgres", config.ConnectionString)
@@ -83,28 +83,64 @@ func retryPostgres(attempts int, sleep time.Duration, callback func() (*sql.DB,
 }
 
 func (r *PostgresDatabase) FindAll(ctx context.Context, filter map[string]interface{}) (docs []*documents.Document, err error) {
+	return r.findDocuments(ctx, documents.ListOptions{Filter: filter})
+}
+
+func (r *PostgresDatabase) FindPage(ctx context.Context, opts documents.ListOptions) (*documents.DocumentPage, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	row := ps.Select("count(documents.id)").
+		From("documents").
+		Where(documentFilter(ctx, opts.Filter)).RunWith(r.conn).QueryRowContext(ctx)
+	var total int
+	if err := row.Scan(&total); err != nil {
+		logrus.WithError(err).Error("unable to count results")
+		return nil, errors.New("unable to count results")
+	}
+
+	docs, err := r.findDocuments(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &documents.DocumentPage{
+		Items:  docs,
+		Total:  total,
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+	}, nil
+}
+
+// findDocuments lists documents matching the options, a zero limit returns every match.
+func (r *PostgresDatabase) findDocuments(ctx context.Context, opts documents.ListOptions) (docs []*documents.Document, err error) {
 	docs = []*documents.Document{}
 	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-	rows, err := ps.Select("documents.id", "description", "display_name", "name", "type", "path", "COALESCE(string_agg(tagged_resources.id::character varying, ','), '')", "created", "updated").
+	query := ps.Select("documents.id", "description", "display_name", "name", "type", "path", "COALESCE(string_agg(tagged_resources.id::character varying, ','), '')", "documents.created", "updated", "title", "authors", "publisher", "language", "isbn", "page_count", "format", "size", "hash", "missing_since", "deleted", "series", "series_index", "rating", "review", "COALESCE(documents.user_id::character varying, '')").
 		From("documents").
 		LeftJoin("tagged_resources ON documents.id=tagged_resources.resource_id").
-		Suffix("GROUP BY documents.id ORDER BY display_name ASC").
-		Where(filter).RunWith(r.conn).Query()
+		Where(documentFilter(ctx, opts.Filter)).
+		GroupBy("documents.id").
+		OrderBy(documentOrder(opts)...)
+	if opts.Limit > 0 {
+		query = query.Limit(uint64(opts.Limit)).Offset(uint64(opts.Offset))
+	}
+	rows, err := query.RunWith(r.conn).QueryContext(ctx)
 
 	if err != nil {
 		logrus.WithError(err).Error("unable to fetch results")
 		return nil, errors.New("unable to fetch results")
 	}
+	defer rows.Close()
 	for rows.Next() {
 		doc := &documents.Document{}
-		var tagList string
+		var tagList, authors string
 		doc.Tags = []string{}
-		if err := rows.Scan(&doc.ID, &doc.Description, &doc.DisplayName, &doc.Name, &doc.Type, &doc.Path, &tagList, &doc.Created, &doc.Updated); err != nil {
+		if err := rows.Scan(&doc.ID, &doc.Description, &doc.DisplayName, &doc.Name, &doc.Type, &doc.Path, &tagList, &doc.Created, &doc.Updated,
+			&doc.Title, &authors, &doc.Publisher, &doc.Language, &doc.ISBN, &doc.PageCount, &doc.Format, &doc.Size, &doc.Hash, &doc.Missing, &doc.Deleted, &doc.Series, &doc.SeriesIndex, &doc.Rating, &doc.Review, &doc.UserID); err != nil {
 			logrus.WithError(err).Warn("unable to scan doc results")
 		}
 		if tagList != "" {
 			doc.Tags = append(doc.Tags, strings.Split(tagList, ",")...)
 		}
+		doc.Authors = splitAuthors(authors)
 		docs = append(docs, doc)
 	}
 	return docs, nil
@@ -112,89 +148,133 @@ func (r *PostgresDatabase) FindAll(ctx context.Context, filter map[string]interf
 
 func (r *PostgresDatabase) FindByID(ctx context.Context, id string) (*documents.Document, error) {
 	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-	row := ps.Select("documents.id", "description", "display_name", "name", "type", "path", "COALESCE(string_agg(tagged_resources.id::character varying, ','), '')", "created", "updated").
+	row := ps.Select("documents.id", "description", "display_name", "name", "type", "path", "COALESCE(string_agg(tagged_resources.id::character varying, ','), '')", "documents.created", "updated", "title", "authors", "publisher", "language", "isbn", "page_count", "format", "size", "hash", "missing_since", "deleted", "series", "series_index", "rating", "review", "COALESCE(documents.user_id::character varying, '')").
 		From("documents").
 		LeftJoin("tagged_resources ON documents.id=tagged_resources.resource_id").
 		Suffix("GROUP BY documents.id").
-		Where(sq.Eq{"documents.id": id}).RunWith(r.conn).QueryRow()
+		Where(sq.And{sq.Eq{"documents.id": id}, ownerFilter(ctx)}).RunWith(r.conn).QueryRow()
 	doc := &documents.Document{}
-	var tagList string
+	var tagList, authors string
 	doc.Tags = []string{}
-	if err := row.Scan(&doc.ID, &doc.Description, &doc.DisplayName, &doc.Name, &doc.Type, &doc.Path, &tagList, &doc.Created, &doc.Updated); err != nil {
+	if err := row.Scan(&doc.ID, &doc.Description, &doc.DisplayName, &doc.Name, &doc.Type, &doc.Path, &tagList, &doc.Created, &doc.Updated,
+		&doc.Title, &authors, &doc.Publisher, &doc.Language, &doc.ISBN, &doc.PageCount, &doc.Format, &doc.Size, &doc.Hash, &doc.Missing, &doc.Deleted, &doc.Series, &doc.SeriesIndex, &doc.Rating, &doc.Review, &doc.UserID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, documents.ErrNotFound
+		}
 		logrus.WithError(err).Warn("unable to scan doc results")
 	}
 	if tagList != "" {
 		doc.Tags = append(doc.Tags, strings.Split(tagList, ",")...)
 	}
+	doc.Authors = splitAuthors(authors)
 
 	return doc, nil
 }
 
-func (r *PostgresDatabase) UpdateDocument(_ context.Context, doc documents.Document) (result documents.Document, err error) {
+func (r *PostgresDatabase) UpdateDocument(ctx context.Context, doc documents.Document) (result documents.Document, err error) {
 	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 	_, err = ps.Update("documents").SetMap(
 		map[string]interface{}{
 			"description":  doc.Description,
 			"display_name": doc.DisplayName,
 			"type":         doc.Type,
+			"title":        doc.Title,
+			"authors":      joinAuthors(doc.Authors),
+			"publisher":    doc.Publisher,
+			"language":     doc.Language,
+			"isbn":         doc.ISBN,
+			"page_count":   doc.PageCount,
+			"series":       doc.Series,
+			"series_index": doc.SeriesIndex,
+			"rating":       doc.Rating,
+			"review":       doc.Review,
 			"updated":      time.Now()}).
-		Where(sq.Eq{"id": doc.ID}).RunWith(r.conn).Exec()
+		Where(sq.And{sq.Eq{"id": doc.ID}, ownerFilter(ctx)}).RunWith(r.conn).Exec()
 
 	if err != nil {
 		logrus.WithError(err).Error("unable to update doc")
 		return result, errors.New("unable to update doc")
 	}
+	r.refreshSearch(ctx, doc.ID)
 
 	return doc, nil
 }
 
-func (r *PostgresDatabase) existsByPath(ctx context.Context, path string) (bool, error) {
+func (r *PostgresDatabase) UpdateFile(ctx context.Context, doc documents.Document) error {
 	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-	row := ps.Select("count(id)").
-		From("documents").Where(sq.Eq{"path": path}).RunWith(r.conn).QueryRow()
-	var count int
-	if err := row.Scan(&count); err != nil {
-		logrus.WithError(err).Warn("unable to scan doc results")
+	_, err := ps.Update("documents").SetMap(
+		map[string]interface{}{
+			"path":          doc.Path,
+			"size":          doc.Size,
+			"hash":          doc.Hash,
+			"missing_since": doc.Missing,
+			"updated":       time.Now()}).
+		Where(sq.And{sq.Eq{"id": doc.ID}, ownerFilter(ctx)}).RunWith(r.conn).ExecContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to update doc file")
+		return errors.New("unable to update doc file")
 	}
+	return nil
+}
 
-	return count > 0, nil
+func (r *PostgresDatabase) UpdateDeleted(ctx context.Context, id string, deleted *time.Time) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	_, err := ps.Update("documents").
+		Set("deleted", deleted).
+		Where(sq.And{sq.Eq{"id": id}, ownerFilter(ctx)}).RunWith(r.conn).ExecContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to update doc trash state")
+		return errors.New("unable to update doc trash state")
+	}
+	return nil
 }
 
 func (r *PostgresDatabase) Insert(ctx context.Context, doc *documents.Document) error {
 	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-	if _, err := ps.Insert("documents").Columns("id", "description", "display_name", "name", "type", "path").
-		Values(doc.ID, doc.Description, doc.DisplayName, doc.Name, doc.Type, doc.Path).
+	if _, err := ps.Insert("documents").Columns("id", "description", "display_name", "name", "type", "path", "title", "authors", "publisher", "language", "isbn", "page_count", "format", "size", "hash", "series", "series_index", "rating", "review", "user_id").
+		Values(doc.ID, doc.Description, doc.DisplayName, doc.Name, doc.Type, doc.Path, doc.Title, joinAuthors(doc.Authors), doc.Publisher, doc.Language, doc.ISBN, doc.PageCount, doc.Format, doc.Size, doc.Hash, doc.Series, doc.SeriesIndex, doc.Rating, doc.Review, nullable(doc.UserID)).
 		RunWith(r.conn).
 		Exec(); err != nil {
 		logrus.WithError(err).Warn("unable to insert doc")
 		return errors.New("unable to insert doc metadata")
 	}
+	r.refreshSearch(ctx, doc.ID)
 	return nil
 }
 
-func (r *PostgresDatabase) UpsertStream(ctx context.Context, input <-chan *documents.Document) error {
-	count := 0
-	for doc := range input {
-		bctx := context.Background()
-		if exists, _ := r.existsByPath(bctx, doc.Path); exists {
-			continue
+// Delete removes a document with its tag links, progress, annotations and search entry in one
+// transaction rather than relying on cascades, which databases created before the tags migration lack.
+func (r *PostgresDatabase) Delete(ctx context.Context, id string) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		logrus.WithError(err).Warn("unable to start delete")
+		return errors.New("unable to delete")
+	}
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if owned, err := documentOwned(ctx, tx, ps, id); err != nil || !owned {
+		tx.Rollback()
+		if err != nil {
+			logrus.WithError(err).Warn("unable to check doc owner")
+			return errors.New("unable to delete")
 		}
-		if err := r.Insert(bctx, doc); err != nil {
-			logrus.WithError(err).Info("unable to upsert document")
-			return errors.New("unable to upsert document")
+		return documents.ErrNotFound
+	}
+	for _, q := range []sq.DeleteBuilder{
+		ps.Delete("tagged_resources").Where(sq.Eq{"resource_id": id}),
+		ps.Delete("reading_progress").Where(sq.Eq{"document_id": id}),
+		ps.Delete("annotations").Where(sq.Eq{"document_id": id}),
+		ps.Delete("document_search").Where(sq.Eq{"id": id}),
+		ps.Delete("documents").Where(sq.Eq{"id": id}),
+	} {
+		if _, err := q.RunWith(tx).ExecContext(ctx); err != nil {
+			tx.Rollback()
+			logrus.WithError(err).Warn("unable to delete doc")
+			return errors.New("unable to delete")
 		}
-		count++
 	}
-	logrus.WithField("count", count).Info("documents added")
-	return nil
-}
-
-func (r *PostgresDatabase) Delete(ctx context.Context, id string) error {
-	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-	if _, err := ps.Delete("documents").Where(sq.Eq{"id": id}).RunWith(r.conn).Exec(); err != nil {
-		logrus.WithError(err).Warn("unable to scan doc results")
+	if err := tx.Commit(); err != nil {
+		logrus.WithError(err).Warn("unable to commit delete")
 		return errors.New("unable to delete")
 	}
-
 	return nil
 }
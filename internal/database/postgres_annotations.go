@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"github.com/sirupsen/logrus"
+)
+
+var annotationColumns = []string{"id", "document_id", "kind", "start_location", "end_location", "text", "color", "note", "created", "updated"}
+
+func (r *PostgresDatabase) FindAnnotations(ctx context.Context, documentID string) ([]*annotations.Annotation, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	return findAnnotations(ctx, ps.Select(annotationColumns...).
+		From("annotations").
+		Where(sq.And{sq.Eq{"document_id": documentID}, ownedDocuments(ctx, "document_id")}).
+		OrderBy("created ASC", "id ASC").
+		RunWith(r.conn))
+}
+
+func (r *PostgresDatabase) FindAllAnnotations(ctx context.Context) ([]*annotations.Annotation, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	return findAnnotations(ctx, ps.Select(annotationColumns...).
+		From("annotations").
+		Where(ownedDocuments(ctx, "document_id")).
+		OrderBy("document_id ASC", "created ASC", "id ASC").
+		RunWith(r.conn))
+}
+
+func (r *PostgresDatabase) FindAnnotationByID(ctx context.Context, id string) (*annotations.Annotation, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	row := ps.Select(annotationColumns...).
+		From("annotations").
+		Where(sq.And{sq.Eq{"id": id}, ownedDocuments(ctx, "document_id")}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanAnnotation(row)
+}
+
+func (r *PostgresDatabase) InsertAnnotation(ctx context.Context, annotation *annotations.Annotation) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Insert("annotations").Columns(annotationColumns...).
+		Values(annotationValues(annotation)...).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert annotation")
+		return errors.New("unable to insert annotation")
+	}
+	r.refreshSearch(ctx, annotation.DocumentID)
+	return nil
+}
+
+func (r *PostgresDatabase) InsertAnnotations(ctx context.Context, documentID string, list []*annotations.Annotation) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		logrus.WithError(err).Warn("unable to start annotation insert")
+		return errors.New("unable to insert annotations")
+	}
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if err := insertAnnotations(ctx, tx, ps, list); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logrus.WithError(err).Warn("unable to commit annotations")
+		return errors.New("unable to insert annotations")
+	}
+	r.refreshSearch(ctx, documentID)
+	return nil
+}
+
+func (r *PostgresDatabase) UpdateAnnotation(ctx context.Context, annotation annotations.Annotation) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Update("annotations").SetMap(annotationFields(annotation)).
+		Where(sq.And{sq.Eq{"id": annotation.ID}, ownedDocuments(ctx, "document_id")}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update annotation")
+		return errors.New("unable to update annotation")
+	}
+	r.refreshSearch(ctx, annotation.DocumentID)
+	return nil
+}
+
+func (r *PostgresDatabase) DeleteAnnotation(ctx context.Context, documentID string, id string) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Delete("annotations").
+		Where(sq.And{sq.Eq{"id": id, "document_id": documentID}, ownedDocuments(ctx, "document_id")}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to delete annotation")
+		return errors.New("unable to delete annotation")
+	}
+	r.refreshSearch(ctx, documentID)
+	return nil
+}
+
+func insertAnnotations(ctx context.Context, tx *sql.Tx, sb sq.StatementBuilderType, list []*annotations.Annotation) error {
+	for _, a := range list {
+		if _, err := sb.Insert("annotations").Columns(annotationColumns...).
+			Values(annotationValues(a)...).
+			RunWith(tx).ExecContext(ctx); err != nil {
+			logrus.WithError(err).WithField("id", a.ID).Warn("unable to insert annotation")
+			return errors.New("unable to insert annotations")
+		}
+	}
+	return nil
+}
+
+func annotationValues(a *annotations.Annotation) []interface{} {
+	return []interface{}{a.ID, a.DocumentID, a.Kind, a.Start, a.End, a.Text, a.Color, a.Note, a.Created, a.Updated}
+}
+
+// annotationFields is every column an update can change.
+func annotationFields(a annotations.Annotation) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":           a.Kind,
+		"start_location": a.Start,
+		"end_location":   a.End,
+		"text":           a.Text,
+		"color":          a.Color,
+		"note":           a.Note,
+		"updated":        a.Updated,
+	}
+}
+
+func scanAnnotation(row sq.RowScanner) (*annotations.Annotation, error) {
+	a := &annotations.Annotation{}
+	if err := row.Scan(&a.ID, &a.DocumentID, &a.Kind, &a.Start, &a.End, &a.Text, &a.Color, &a.Note, &a.Created, &a.Updated); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, annotations.ErrNotFound
+		}
+		logrus.WithError(err).Warn("unable to scan annotation results")
+		return nil, errors.New("unable to fetch annotation")
+	}
+	return a, nil
+}
+
+func findAnnotations(ctx context.Context, query sq.SelectBuilder) ([]*annotations.Annotation, error) {
+	rows, err := query.QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch annotations")
+		return nil, errors.New("unable to fetch annotations")
+	}
+	defer rows.Close()
+	results := []*annotations.Annotation{}
+	for rows.Next() {
+		a, err := scanAnnotation(rows)
+		if err != nil {
+			continue
+		}
+		results = append(results, a)
+	}
+	return results, nil
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"github.com/holmes89/book-organizer/internal/backups"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/sirupsen/logrus"
+)
+
+// restoreDocumentColumns are written when restoring so documents come back exactly as they were backed up.
+var restoreDocumentColumns = []string{"id", "description", "display_name", "name", "type", "path", "created", "updated",
+	"title", "authors", "publisher", "language", "isbn", "page_count", "format", "size", "hash", "missing_since", "deleted",
+	"series", "series_index", "rating", "review", "user_id"}
+
+func restoreDocumentValues(doc *documents.Document) []interface{} {
+	return []interface{}{doc.ID, doc.Description, doc.DisplayName, doc.Name, doc.Type, doc.Path, doc.Created, doc.Updated,
+		doc.Title, joinAuthors(doc.Authors), doc.Publisher, doc.Language, doc.ISBN, doc.PageCount, doc.Format, doc.Size, doc.Hash, doc.Missing, doc.Deleted,
+		doc.Series, doc.SeriesIndex, doc.Rating, doc.Review, nullable(doc.UserID)}
+}
+
+func (r *PostgresDatabase) ExportCatalog(ctx context.Context) (*backups.Catalog, error) {
+	docs, err := r.findDocuments(ctx, documents.ListOptions{Filter: map[string]interface{}{documents.TrashFilter: documents.TrashIncluded}})
+	if err != nil {
+		return nil, err
+	}
+	tagList, err := r.FindAllTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	content, err := exportContent(ctx, ps.Select("id", "content").From("document_search").Where(sq.NotEq{"content": ""}).RunWith(r.conn))
+	if err != nil {
+		return nil, err
+	}
+	progressList, err := exportProgress(ctx, ps.Select(progressColumns...).From("reading_progress").RunWith(r.conn))
+	if err != nil {
+		return nil, err
+	}
+	annotationList, err := r.FindAllAnnotations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userList, err := r.FindAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &backups.Catalog{Documents: docs, Tags: tagList, Content: content, Progress: progressList, Annotations: annotationList, Users: userList}, nil
+}
+
+// RestoreCatalog replaces the catalog in one transaction, the search index is rebuilt from
+// the restored content afterwards.
+func (r *PostgresDatabase) RestoreCatalog(ctx context.Context, catalog *backups.Catalog) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		logrus.WithError(err).Error("unable to start restore")
+		return errors.New("unable to restore catalog")
+	}
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if err := restoreCatalog(ctx, tx, ps, catalog, []string{"tagged_resources", "reading_progress", "annotations", "document_search", "documents", "tags"}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logrus.WithError(err).Error("unable to commit restore")
+		return errors.New("unable to restore catalog")
+	}
+
+	for _, doc := range catalog.Documents {
+		if content, ok := catalog.Content[doc.ID]; ok {
+			if err := r.UpdateContent(ctx, doc.ID, content); err != nil {
+				return err
+			}
+			continue
+		}
+		r.refreshSearch(ctx, doc.ID)
+	}
+	return nil
+}
+
+// restoreCatalog clears the tables in order and inserts the catalog, links to tags and progress
+// or annotations for documents the backup doesn't have are dropped. Users are only replaced when
+// the backup has some.
+func restoreCatalog(ctx context.Context, tx *sql.Tx, sb sq.StatementBuilderType, catalog *backups.Catalog, tables []string) error {
+	for _, table := range tables {
+		if _, err := sb.Delete(table).RunWith(tx).ExecContext(ctx); err != nil {
+			logrus.WithError(err).WithField("table", table).Error("unable to clear table")
+			return errors.New("unable to restore catalog")
+		}
+	}
+	if len(catalog.Users) > 0 {
+		if _, err := sb.Delete("users").RunWith(tx).ExecContext(ctx); err != nil {
+			logrus.WithError(err).WithField("table", "users").Error("unable to clear table")
+			return errors.New("unable to restore catalog")
+		}
+		for _, user := range catalog.Users {
+			if _, err := sb.Insert("users").Columns(userColumns...).
+				Values(userValues(user)...).
+				RunWith(tx).ExecContext(ctx); err != nil {
+				logrus.WithError(err).WithField("id", user.ID).Error("unable to restore user")
+				return errors.New("unable to restore catalog")
+			}
+		}
+	}
+	known := map[string]bool{}
+	docs := map[string]bool{}
+	for _, tag := range catalog.Tags {
+		known[tag.ID] = true
+		if _, err := sb.Insert("tags").Columns("id", "name", "created", "user_id").
+			Values(tag.ID, tag.Name, tag.Created, nullable(tag.UserID)).
+			RunWith(tx).ExecContext(ctx); err != nil {
+			logrus.WithError(err).WithField("id", tag.ID).Error("unable to restore tag")
+			return errors.New("unable to restore catalog")
+		}
+	}
+	for _, doc := range catalog.Documents {
+		docs[doc.ID] = true
+		if _, err := sb.Insert("documents").Columns(restoreDocumentColumns...).
+			Values(restoreDocumentValues(doc)...).
+			RunWith(tx).ExecContext(ctx); err != nil {
+			logrus.WithError(err).WithField("id", doc.ID).Error("unable to restore document")
+			return errors.New("unable to restore catalog")
+		}
+		for _, tagID := range doc.Tags {
+			if !known[tagID] {
+				continue
+			}
+			if _, err := sb.Insert("tagged_resources").Columns("id", "resource_id").
+				Values(tagID, doc.ID).
+				RunWith(tx).ExecContext(ctx); err != nil {
+				logrus.WithError(err).WithField("id", doc.ID).Error("unable to restore document tags")
+				return errors.New("unable to restore catalog")
+			}
+		}
+	}
+	for _, p := range catalog.Progress {
+		if !docs[p.DocumentID] {
+			continue
+		}
+		if _, err := sb.Insert("reading_progress").Columns(progressColumns...).
+			Values(progressValues(p)...).
+			RunWith(tx).ExecContext(ctx); err != nil {
+			logrus.WithError(err).WithField("id", p.DocumentID).Error("unable to restore reading progress")
+			return errors.New("unable to restore catalog")
+		}
+	}
+	var restored []*annotations.Annotation
+	for _, a := range catalog.Annotations {
+		if docs[a.DocumentID] {
+			restored = append(restored, a)
+		}
+	}
+	if err := insertAnnotations(ctx, tx, sb, restored); err != nil {
+		return errors.New("unable to restore catalog")
+	}
+	return nil
+}
+
+func exportContent(ctx context.Context, query sq.SelectBuilder) (map[string]string, error) {
+	rows, err := query.QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to export document content")
+		return nil, errors.New("unable to export document content")
+	}
+	defer rows.Close()
+	content := map[string]string{}
+	for rows.Next() {
+		var id, text string
+		if err := rows.Scan(&id, &text); err != nil {
+			logrus.WithError(err).Warn("unable to scan document content")
+			continue
+		}
+		content[id] = text
+	}
+	return content, nil
+}
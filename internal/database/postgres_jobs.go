@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+var jobColumns = []string{"id", "type", "payload", "status", "attempts", "max_attempts", "error", "run_at", "locked_until", "created", "updated", "user_id", "result"}
+
+func (r *PostgresDatabase) InsertJob(ctx context.Context, job *jobs.Job) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Insert("jobs").Columns(jobColumns...).
+		Values(job.ID, job.Type, string(job.Payload), job.Status, job.Attempts, job.MaxAttempts, job.Error, job.RunAt, job.LockedUntil, job.Created, job.Updated, job.UserID, string(job.Result)).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert job")
+		return errors.New("unable to insert job")
+	}
+	return nil
+}
+
+func (r *PostgresDatabase) FindJobByID(ctx context.Context, id string) (*jobs.Job, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	row := ps.Select(jobColumns...).
+		From("jobs").
+		Where(sq.And{sq.Eq{"id": id}, jobFilter(ctx)}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanJob(row)
+}
+
+// ClaimJob skips rows locked by other claims so several instances can share the queue.
+func (r *PostgresDatabase) ClaimJob(ctx context.Context, now time.Time, lockedUntil time.Time) (*jobs.Job, error) {
+	row := r.conn.QueryRowContext(ctx, `UPDATE jobs SET status = $1, attempts = attempts + 1, updated = $2, locked_until = $4
+WHERE id = (
+    SELECT id FROM jobs
+    WHERE (status = $3 AND run_at <= $2) OR (status = $1 AND locked_until < $2)
+    ORDER BY run_at ASC LIMIT 1 FOR UPDATE SKIP LOCKED
+)
+RETURNING `+strings.Join(jobColumns, ", "), jobs.StatusRunning, now, jobs.StatusPending, lockedUntil)
+	job, err := scanJob(row)
+	if err == jobs.ErrNotFound {
+		return nil, nil
+	}
+	return job, err
+}
+
+func (r *PostgresDatabase) UpdateJob(ctx context.Context, job jobs.Job) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Update("jobs").SetMap(map[string]interface{}{
+		"status":       job.Status,
+		"attempts":     job.Attempts,
+		"error":        job.Error,
+		"run_at":       job.RunAt,
+		"locked_until": job.LockedUntil,
+		"updated":      job.Updated,
+		"result":       string(job.Result),
+	}).
+		Where(sq.Eq{"id": job.ID}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update job")
+		return errors.New("unable to update job")
+	}
+	return nil
+}
+
+func (r *PostgresDatabase) ExtendJobLease(ctx context.Context, id string, lockedUntil time.Time) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Update("jobs").
+		Set("locked_until", lockedUntil).
+		Where(sq.Eq{"id": id, "status": jobs.StatusRunning}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to extend job lease")
+		return errors.New("unable to extend job lease")
+	}
+	return nil
+}
+
+func (r *PostgresDatabase) DeleteFinishedJobs(ctx context.Context, before time.Time) (int, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	res, err := ps.Delete("jobs").
+		Where(sq.Eq{"status": []jobs.Status{jobs.StatusSucceeded, jobs.StatusFailed}}).
+		Where(sq.Lt{"updated": before}).
+		RunWith(r.conn).
+		ExecContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to delete finished jobs")
+		return 0, errors.New("unable to delete finished jobs")
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func scanJob(row sq.RowScanner) (*jobs.Job, error) {
+	job := &jobs.Job{}
+	var payload, result string
+	if err := row.Scan(&job.ID, &job.Type, &payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.Error, &job.RunAt, &job.LockedUntil, &job.Created, &job.Updated, &job.UserID, &result); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, jobs.ErrNotFound
+		}
+		logrus.WithError(err).Warn("unable to scan job results")
+		return nil, errors.New("unable to fetch job")
+	}
+	job.Payload = []byte(payload)
+	if result != "" {
+		job.Result = []byte(result)
+	}
+	return job, nil
+}
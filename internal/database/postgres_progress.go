@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"github.com/sirupsen/logrus"
+)
+
+var progressColumns = []string{"document_id", "location", "percentage", "status", "started", "finished", "updated"}
+
+func (r *PostgresDatabase) FindAllProgress(ctx context.Context) ([]*progress.Progress, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	return exportProgress(ctx, ps.Select(progressColumns...).From("reading_progress").Where(ownedDocuments(ctx, "document_id")).OrderBy("document_id").RunWith(r.conn))
+}
+
+func (r *PostgresDatabase) FindProgress(ctx context.Context, documentID string) (*progress.Progress, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	row := ps.Select(progressColumns...).
+		From("reading_progress").
+		Where(sq.And{sq.Eq{"document_id": documentID}, ownedDocuments(ctx, "document_id")}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanProgressRow(row)
+}
+
+func (r *PostgresDatabase) UpsertProgress(ctx context.Context, p progress.Progress) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Insert("reading_progress").Columns(progressColumns...).
+		Values(progressValues(&p)...).
+		Suffix(`ON CONFLICT (document_id) DO UPDATE SET location = EXCLUDED.location, percentage = EXCLUDED.percentage,
+status = EXCLUDED.status, started = EXCLUDED.started, finished = EXCLUDED.finished, updated = EXCLUDED.updated`).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to save progress")
+		return errors.New("unable to save progress")
+	}
+	return nil
+}
+
+func progressValues(p *progress.Progress) []interface{} {
+	return []interface{}{p.DocumentID, p.Location, p.Percentage, p.Status, p.Started, p.Finished, p.Updated}
+}
+
+func scanProgressRow(row sq.RowScanner) (*progress.Progress, error) {
+	p := &progress.Progress{}
+	if err := row.Scan(&p.DocumentID, &p.Location, &p.Percentage, &p.Status, &p.Started, &p.Finished, &p.Updated); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, progress.ErrNotFound
+		}
+		logrus.WithError(err).Warn("unable to scan progress results")
+		return nil, errors.New("unable to fetch progress")
+	}
+	return p, nil
+}
+
+func exportProgress(ctx context.Context, query sq.SelectBuilder) ([]*progress.Progress, error) {
+	rows, err := query.QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to export reading progress")
+		return nil, errors.New("unable to export reading progress")
+	}
+	defer rows.Close()
+	results := []*progress.Progress{}
+	for rows.Next() {
+		p, err := scanProgressRow(rows)
+		if err != nil {
+			continue
+		}
+		results = append(results, p)
+	}
+	return results, nil
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/sirupsen/logrus"
+)
+
+var scanColumns = []string{"id", "job_id", "status", "prune", "dry_run", "seen", "imported", "skipped", "failed", "found", "moved", "missing", "pruned", "errors", "changes", "error", "cancel_requested", "created", "started", "finished", "user_id"}
+
+func (r *PostgresDatabase) InsertScan(ctx context.Context, scan *documents.Scan) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Insert("scans").Columns(scanColumns...).
+		Values(scanValues(*scan)...).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert scan")
+		return errors.New("unable to insert scan")
+	}
+	return nil
+}
+
+func (r *PostgresDatabase) FindScanByID(ctx context.Context, id string) (*documents.Scan, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	row := ps.Select(scanColumns...).
+		From("scans").
+		Where(sq.Eq{"id": id}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanScan(row)
+}
+
+func (r *PostgresDatabase) UpdateScan(ctx context.Context, scan documents.Scan) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Update("scans").SetMap(scanProgress(scan)).
+		Where(sq.Eq{"id": scan.ID}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update scan")
+		return errors.New("unable to update scan")
+	}
+	return nil
+}
+
+func (r *PostgresDatabase) RequestScanCancel(ctx context.Context, id string) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Update("scans").
+		Set("cancel_requested", true).
+		Where(sq.Eq{"id": id}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to cancel scan")
+		return errors.New("unable to cancel scan")
+	}
+	return nil
+}
+
+func scanValues(scan documents.Scan) []interface{} {
+	return []interface{}{scan.ID, scan.JobID, scan.Status, scan.Prune, scan.DryRun, scan.Seen, scan.Imported, scan.Skipped, scan.Failed,
+		scan.Found, scan.Moved, scan.Missing, scan.Pruned, encodeJSONList(scan.Errors), encodeJSONList(scan.Changes), scan.Error,
+		scan.CancelRequested, scan.Created, scan.Started, scan.Finished, scan.UserID}
+}
+
+// scanProgress is every column a running scan changes, the cancel flag is only set by RequestScanCancel.
+func scanProgress(scan documents.Scan) map[string]interface{} {
+	return map[string]interface{}{
+		"job_id":   scan.JobID,
+		"status":   scan.Status,
+		"seen":     scan.Seen,
+		"imported": scan.Imported,
+		"skipped":  scan.Skipped,
+		"failed":   scan.Failed,
+		"found":    scan.Found,
+		"moved":    scan.Moved,
+		"missing":  scan.Missing,
+		"pruned":   scan.Pruned,
+		"errors":   encodeJSONList(scan.Errors),
+		"changes":  encodeJSONList(scan.Changes),
+		"error":    scan.Error,
+		"started":  scan.Started,
+		"finished": scan.Finished,
+	}
+}
+
+// encodeJSONList stores a slice as a json array, nil becomes an empty array.
+func encodeJSONList(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return "[]"
+	}
+	return string(b)
+}
+
+func scanScan(row sq.RowScanner) (*documents.Scan, error) {
+	scan := &documents.Scan{}
+	var errs, changes string
+	if err := row.Scan(&scan.ID, &scan.JobID, &scan.Status, &scan.Prune, &scan.DryRun, &scan.Seen, &scan.Imported, &scan.Skipped, &scan.Failed,
+		&scan.Found, &scan.Moved, &scan.Missing, &scan.Pruned, &errs, &changes, &scan.Error,
+		&scan.CancelRequested, &scan.Created, &scan.Started, &scan.Finished, &scan.UserID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, documents.ErrScanNotFound
+		}
+		logrus.WithError(err).Warn("unable to scan scan results")
+		return nil, errors.New("unable to fetch scan")
+	}
+	if err := json.Unmarshal([]byte(errs), &scan.Errors); err != nil {
+		logrus.WithError(err).WithField("id", scan.ID).Warn("unable to decode scan errors")
+	}
+	if err := json.Unmarshal([]byte(changes), &scan.Changes); err != nil {
+		logrus.WithError(err).WithField("id", scan.ID).Warn("unable to decode scan changes")
+	}
+	if scan.Errors == nil {
+		scan.Errors = []documents.ScanError{}
+	}
+	if scan.Changes == nil {
+		scan.Changes = []documents.ScanChange{}
+	}
+	return scan, nil
+}
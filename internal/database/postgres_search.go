@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/search"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// postgresRefreshSearch rebuilds the search vector of a document from its metadata, tag names,
+// annotations and extracted content. Titles rank highest and body text lowest.
+const postgresRefreshSearch = `INSERT INTO document_search(id, content, search)
+SELECT d.id, COALESCE(s.content, ''),
+    setweight(to_tsvector('english', d.display_name), 'A') ||
+    setweight(to_tsvector('english', d.name), 'B') ||
+    setweight(to_tsvector('english', COALESCE(d.description, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE((SELECT string_agg(t.name, ' ') FROM tags t JOIN tagged_resources tr ON t.id = tr.id WHERE tr.resource_id = d.id), '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE((SELECT string_agg(a.text || ' ' || a.note, ' ') FROM annotations a WHERE a.document_id = d.id), '')), 'C') ||
+    setweight(to_tsvector('english', COALESCE(s.content, '')), 'D')
+FROM documents d LEFT JOIN document_search s ON s.id = d.id
+WHERE d.id = $1
+ON CONFLICT (id) DO UPDATE SET content = EXCLUDED.content, search = EXCLUDED.search`
+
+const postgresHeadlineOptions = "StartSel=" + search.MatchStart + ", StopSel=" + search.MatchEnd + ", MaxFragments=2, MaxWords=30, MinWords=10"
+
+func (r *PostgresDatabase) refreshSearch(ctx context.Context, id string) {
+	if _, err := r.conn.ExecContext(ctx, postgresRefreshSearch, id); err != nil {
+		logrus.WithError(err).WithField("id", id).Warn("unable to refresh search index")
+	}
+}
+
+func (r *PostgresDatabase) taggedResourceIDs(ctx context.Context, tagID string) []string {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	rows, err := ps.Select("resource_id").From("tagged_resources").
+		Where(sq.Eq{"id": tagID}).RunWith(r.conn).QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("unable to fetch tagged resources")
+		return nil
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (r *PostgresDatabase) UpdateContent(ctx context.Context, id string, content string) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Insert("document_search").Columns("id", "content", "search").
+		Values(id, content, sq.Expr("''::tsvector")).
+		Suffix("ON CONFLICT (id) DO UPDATE SET content = EXCLUDED.content").
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to store document content")
+		return errors.New("unable to store document content")
+	}
+	r.refreshSearch(ctx, id)
+	return nil
+}
+
+func (r *PostgresDatabase) SearchDocuments(ctx context.Context, query search.Query) ([]search.Hit, int, error) {
+	text := strings.Join(search.Terms(query.Text), " ")
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	var total int
+	row := ps.Select("count(*)").From("document_search s").
+		Join("documents d ON d.id = s.id").
+		Where("s.search @@ plainto_tsquery('english', ?)", text).
+		Where(sq.Eq{"d.deleted": nil}).
+		Where(ownedDocuments(ctx, "d.id")).
+		RunWith(r.conn).QueryRowContext(ctx)
+	if err := row.Scan(&total); err != nil {
+		logrus.WithError(err).Error("unable to count search results")
+		return nil, 0, errors.New("unable to search")
+	}
+
+	rows, err := ps.Select("s.id").
+		Column(sq.Alias(sq.Expr("ts_rank(s.search, plainto_tsquery('english', ?))", text), "rank")).
+		Column(sq.Expr("ts_headline('english', COALESCE(d.description, '') || ' ' || s.content, plainto_tsquery('english', ?), '"+postgresHeadlineOptions+"')", text)).
+		From("document_search s").
+		Join("documents d ON d.id = s.id").
+		Where("s.search @@ plainto_tsquery('english', ?)", text).
+		Where(sq.Eq{"d.deleted": nil}).
+		Where(ownedDocuments(ctx, "d.id")).
+		OrderBy("rank DESC", "s.id ASC").
+		Limit(uint64(query.Limit)).
+		Offset(uint64(query.Offset)).
+		RunWith(r.conn).QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to search")
+		return nil, 0, errors.New("unable to search")
+	}
+	defer rows.Close()
+
+	hits := []search.Hit{}
+	for rows.Next() {
+		hit := search.Hit{}
+		if err := rows.Scan(&hit.ID, &hit.Rank, &hit.Snippet); err != nil {
+			logrus.WithError(err).Warn("unable to scan search results")
+			continue
+		}
+		hit.Snippet = search.MarkSnippet(hit.Snippet)
+		hits = append(hits, hit)
+	}
+	return hits, total, nil
+}
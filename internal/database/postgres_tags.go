@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/sirupsen/logrus"
+)
+
+var tagColumns = []string{"tags.id", "tags.name", "tags.created", "tags.user_id"}
+
+func (r *PostgresDatabase) FindAllTags(ctx context.Context) ([]*tags.Tag, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	rows, err := ps.Select(tagColumns...).
+		From("tags").
+		Where(tagFilter(ctx)).
+		OrderBy("name ASC").
+		RunWith(r.conn).QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch tags")
+		return nil, errors.New("unable to fetch tags")
+	}
+	return scanTags(rows), nil
+}
+
+func (r *PostgresDatabase) FindTagByID(ctx context.Context, id string) (*tags.Tag, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	row := ps.Select(tagColumns...).
+		From("tags").
+		Where(sq.And{sq.Eq{"id": id}, tagFilter(ctx)}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanTag(row)
+}
+
+func (r *PostgresDatabase) FindTagByName(ctx context.Context, name string) (*tags.Tag, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	row := ps.Select(tagColumns...).
+		From("tags").
+		Where(sq.And{sq.Expr("lower(name) = lower(?)", name), tagFilter(ctx)}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanTag(row)
+}
+
+func (r *PostgresDatabase) InsertTag(ctx context.Context, tag *tags.Tag) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Insert("tags").Columns("id", "name", "created", "user_id").
+		Values(tag.ID, tag.Name, tag.Created, nullable(tag.UserID)).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert tag")
+		return errors.New("unable to insert tag")
+	}
+	return nil
+}
+
+func (r *PostgresDatabase) UpdateTag(ctx context.Context, tag tags.Tag) (tags.Tag, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Update("tags").Set("name", tag.Name).
+		Where(sq.And{sq.Eq{"id": tag.ID}, tagFilter(ctx)}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update tag")
+		return tags.Tag{}, errors.New("unable to update tag")
+	}
+	for _, id := range r.taggedResourceIDs(ctx, tag.ID) {
+		r.refreshSearch(ctx, id)
+	}
+	return tag, nil
+}
+
+func (r *PostgresDatabase) DeleteTag(ctx context.Context, id string) error {
+	if _, err := r.FindTagByID(ctx, id); err != nil {
+		return err
+	}
+	resources := r.taggedResourceIDs(ctx, id)
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Delete("tags").Where(sq.And{sq.Eq{"id": id}, tagFilter(ctx)}).RunWith(r.conn).ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to delete tag")
+		return errors.New("unable to delete tag")
+	}
+	for _, resourceID := range resources {
+		r.refreshSearch(ctx, resourceID)
+	}
+	return nil
+}
+
+func (r *PostgresDatabase) FindTagsByResource(ctx context.Context, resourceID string) ([]*tags.Tag, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	rows, err := ps.Select(tagColumns...).
+		From("tags").
+		Join("tagged_resources ON tags.id=tagged_resources.id").
+		Where(sq.And{sq.Eq{"tagged_resources.resource_id": resourceID}, ownedDocuments(ctx, "tagged_resources.resource_id"), tagFilter(ctx)}).
+		OrderBy("tags.name ASC").
+		RunWith(r.conn).QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch resource tags")
+		return nil, errors.New("unable to fetch tags")
+	}
+	return scanTags(rows), nil
+}
+
+func (r *PostgresDatabase) TagResource(ctx context.Context, tagID string, resourceID string) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if owned, err := documentOwned(ctx, r.conn, ps, resourceID); err != nil {
+		logrus.WithError(err).Warn("unable to check resource owner")
+		return errors.New("unable to tag resource")
+	} else if !owned {
+		return tags.ErrResourceNotFound
+	}
+	if _, err := ps.Insert("tagged_resources").Columns("id", "resource_id").
+		Values(tagID, resourceID).
+		Suffix("ON CONFLICT DO NOTHING").
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to tag resource")
+		return errors.New("unable to tag resource")
+	}
+	r.refreshSearch(ctx, resourceID)
+	return nil
+}
+
+func (r *PostgresDatabase) UntagResource(ctx context.Context, tagID string, resourceID string) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Delete("tagged_resources").
+		Where(sq.And{sq.Eq{"id": tagID, "resource_id": resourceID}, ownedDocuments(ctx, "resource_id")}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to untag resource")
+		return errors.New("unable to untag resource")
+	}
+	r.refreshSearch(ctx, resourceID)
+	return nil
+}
+
+func scanTag(row sq.RowScanner) (*tags.Tag, error) {
+	tag := &tags.Tag{}
+	var userID sql.NullString
+	if err := row.Scan(&tag.ID, &tag.Name, &tag.Created, &userID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tags.ErrNotFound
+		}
+		logrus.WithError(err).Warn("unable to scan tag results")
+		return nil, errors.New("unable to fetch tag")
+	}
+	tag.UserID = userID.String
+	return tag, nil
+}
+
+func scanTags(rows *sql.Rows) []*tags.Tag {
+	defer rows.Close()
+	results := []*tags.Tag{}
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			continue
+		}
+		results = append(results, tag)
+	}
+	return results
+}
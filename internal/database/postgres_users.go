@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/users"
+	"github.com/sirupsen/logrus"
+)
+
+var userColumns = []string{"id", "username", "password_hash", "admin", "created"}
+
+func (r *PostgresDatabase) FindAllUsers(ctx context.Context) ([]*users.User, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	return findUsers(ctx, ps.Select(userColumns...).From("users").OrderBy("created ASC").RunWith(r.conn))
+}
+
+func (r *PostgresDatabase) FindUserByID(ctx context.Context, id string) (*users.User, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	row := ps.Select(userColumns...).
+		From("users").
+		Where(sq.Eq{"id": id}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanUser(row)
+}
+
+func (r *PostgresDatabase) FindUserByUsername(ctx context.Context, username string) (*users.User, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	row := ps.Select(userColumns...).
+		From("users").
+		Where("lower(username) = lower(?)", username).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanUser(row)
+}
+
+func (r *PostgresDatabase) InsertUser(ctx context.Context, user *users.User) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Insert("users").Columns(userColumns...).
+		Values(userValues(user)...).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert user")
+		return errors.New("unable to insert user")
+	}
+	return nil
+}
+
+func (r *PostgresDatabase) UpdateUserPassword(ctx context.Context, id string, passwordHash string) error {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if _, err := ps.Update("users").Set("password_hash", passwordHash).
+		Where(sq.Eq{"id": id}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update password")
+		return errors.New("unable to update password")
+	}
+	return nil
+}
+
+func (r *PostgresDatabase) AdoptDocuments(ctx context.Context, userID string) (int, error) {
+	ps := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	return adoptDocuments(ctx, r.conn, ps, userID)
+}
+
+func userValues(user *users.User) []interface{} {
+	return []interface{}{user.ID, user.Username, user.PasswordHash, user.Admin, user.Created}
+}
+
+// adoptDocuments gives documents and tags without an owner to the user, a tag is left alone when
+// the user already has one by that name.
+func adoptDocuments(ctx context.Context, db sq.BaseRunner, sb sq.StatementBuilderType, userID string) (int, error) {
+	result, err := sb.Update("documents").Set("user_id", userID).Where(sq.Eq{"user_id": nil}).RunWith(db).ExecContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to assign documents")
+		return 0, errors.New("unable to assign documents")
+	}
+	if _, err := sb.Update("tags").Set("user_id", userID).
+		Where(sq.And{sq.Eq{"user_id": nil}, sq.Expr("lower(name) NOT IN (SELECT lower(name) FROM tags WHERE user_id = ?)", userID)}).
+		RunWith(db).ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to assign tags")
+		return 0, errors.New("unable to assign tags")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, nil
+	}
+	return int(n), nil
+}
+
+func scanUser(row sq.RowScanner) (*users.User, error) {
+	user := &users.User{}
+	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Admin, &user.Created); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, users.ErrNotFound
+		}
+		logrus.WithError(err).Warn("unable to scan user results")
+		return nil, errors.New("unable to fetch user")
+	}
+	return user, nil
+}
+
+func findUsers(ctx context.Context, query sq.SelectBuilder) ([]*users.User, error) {
+	rows, err := query.QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch users")
+		return nil, errors.New("unable to fetch users")
+	}
+	defer rows.Close()
+	results := []*users.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			continue
+		}
+		results = append(results, user)
+	}
+	return results, nil
+}
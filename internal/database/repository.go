@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"github.com/holmes89/book-organizer/internal/backups"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"github.com/holmes89/book-organizer/internal/search"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/holmes89/book-organizer/internal/users"
+	"strings"
+)
+
+// Repository is implemented by each database backend.
+type Repository interface {
+	documents.DocumentRepository
+	documents.ScanRepository
+	tags.TagRepository
+	search.SearchRepository
+	jobs.JobRepository
+	backups.BackupRepository
+	progress.ProgressRepository
+	annotations.AnnotationRepository
+	users.UserRepository
+}
+
+func NewDocumentRepository(db Repository) documents.DocumentRepository {
+	return db
+}
+
+func NewScanRepository(db Repository) documents.ScanRepository {
+	return db
+}
+
+func NewTagRepository(db Repository) tags.TagRepository {
+	return db
+}
+
+func NewSearchRepository(db Repository) search.SearchRepository {
+	return db
+}
+
+func NewJobRepository(db Repository) jobs.JobRepository {
+	return db
+}
+
+func NewBackupRepository(db Repository) backups.BackupRepository {
+	return db
+}
+
+func NewProgressRepository(db Repository) progress.ProgressRepository {
+	return db
+}
+
+func NewAnnotationRepository(db Repository) annotations.AnnotationRepository {
+	return db
+}
+
+func NewUserRepository(db Repository) users.UserRepository {
+	return db
+}
+
+// noRows is a condition nothing matches, used to scope a query for a context without a user.
+var noRows = sq.Expr("1 = 0")
+
+// ownerFilter limits a query on documents to those of the user of the context. A system context
+// matches everything and a context without a user matches nothing.
+func ownerFilter(ctx context.Context) sq.Sqlizer {
+	return userFilter(ctx, "documents.user_id")
+}
+
+// tagFilter limits a query on tags to those of the user of the context, scoped like ownerFilter.
+func tagFilter(ctx context.Context) sq.Sqlizer {
+	return userFilter(ctx, "tags.user_id")
+}
+
+func userFilter(ctx context.Context, column string) sq.Sqlizer {
+	if id := common.UserID(ctx); id != "" {
+		return sq.Eq{column: id}
+	}
+	if common.IsSystem(ctx) {
+		return sq.And{}
+	}
+	return noRows
+}
+
+// ownedDocuments limits a query on a table that references documents to rows for documents of the
+// user of the context, scoped like ownerFilter.
+func ownedDocuments(ctx context.Context, column string) sq.Sqlizer {
+	if id := common.UserID(ctx); id != "" {
+		return sq.Expr(column+" IN (SELECT id FROM documents WHERE user_id = ?)", id)
+	}
+	if common.IsSystem(ctx) {
+		return sq.And{}
+	}
+	return noRows
+}
+
+// documentOwned reports whether a document exists and belongs to the user of the context.
+func documentOwned(ctx context.Context, db sq.BaseRunner, sb sq.StatementBuilderType, id string) (bool, error) {
+	var owned int
+	if err := sb.Select("count(*)").From("documents").
+		Where(sq.And{sq.Eq{"documents.id": id}, ownerFilter(ctx)}).
+		RunWith(db).QueryRowContext(ctx).Scan(&owned); err != nil {
+		return false, err
+	}
+	return owned > 0, nil
+}
+
+// jobFilter limits a query on jobs to those queued by the user of the context, admins and system
+// contexts see every job and a context without a user sees none.
+func jobFilter(ctx context.Context) sq.Sqlizer {
+	if common.IsAdmin(ctx) || common.IsSystem(ctx) {
+		return sq.And{}
+	}
+	if id := common.UserID(ctx); id != "" {
+		return sq.Eq{"user_id": id}
+	}
+	return noRows
+}
+
+// nullable stores an empty string as NULL, for columns where NULL means unset.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// documentFilter converts a document filter into squirrel clauses, the special filters defined in
+// documents become sub queries or range checks and everything else is an equality check.
+func documentFilter(ctx context.Context, filter map[string]interface{}) sq.And {
+	clauses := sq.And{ownerFilter(ctx)}
+	switch filter[documents.TrashFilter] {
+	case documents.TrashOnly:
+		clauses = append(clauses, sq.NotEq{"deleted": nil})
+	case documents.TrashIncluded:
+	default:
+		clauses = append(clauses, sq.Eq{"deleted": nil})
+	}
+	eq := sq.Eq{}
+	for k, v := range filter {
+		switch k {
+		case documents.TrashFilter:
+		case documents.TagFilter:
+			clauses = append(clauses, sq.Expr("documents.id IN (SELECT resource_id FROM tagged_resources WHERE id = ?)", v))
+		case documents.NamePrefixFilter:
+			clauses = append(clauses, sq.Expr(`lower(display_name) LIKE lower(?) ESCAPE '\'`, escapeLike(fmt.Sprint(v))+"%"))
+		case documents.MissingFilter:
+			if v == true {
+				clauses = append(clauses, sq.NotEq{"missing_since": nil})
+			} else {
+				clauses = append(clauses, sq.Eq{"missing_since": nil})
+			}
+		case documents.CreatedAfterFilter:
+			clauses = append(clauses, sq.GtOrEq{"documents.created": v})
+		case documents.CreatedBeforeFilter:
+			clauses = append(clauses, sq.Lt{"documents.created": v})
+		default:
+			eq[k] = v
+		}
+	}
+	return append(clauses, eq)
+}
+
+// documentOrder returns the ORDER BY clauses for a listing, ties are broken by id so pages are stable.
+func documentOrder(opts documents.ListOptions) []string {
+	sort := opts.Sort
+	if !documents.SortFields[sort] {
+		sort = "display_name"
+	}
+	direction := "ASC"
+	if opts.Descending {
+		direction = "DESC"
+	}
+	return []string{"documents." + sort + " " + direction, "documents.id ASC"}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// authorSeparator joins the authors of a document into a single column.
+const authorSeparator = "; "
+
+func joinAuthors(authors []string) string {
+	return strings.Join(authors, authorSeparator)
+}
+
+func splitAuthors(authors string) []string {
+	if authors == "" {
+		return []string{}
+	}
+	return strings.Split(authors, authorSeparator)
+}
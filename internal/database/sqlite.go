@@ -0,0 +1,258 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	_ "github.com/mattn/go-sqlite3" // Used for specifying the type client we are creating
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"strings"
+	"time"
+)
+
+// SQLiteDatabase stores the catalog in a single file for personal deployments.
+type SQLiteDatabase struct {
+	conn *sql.DB
+}
+
+func NewSQLiteDatabase(lc fx.Lifecycle, config common.SQLiteDatabaseConfig) Repository {
+	logrus.WithField("path", config.Path).Info("opening sqlite")
+	db, err := sql.Open("sqlite3", config.Path+"?_foreign_keys=on")
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to open sqlite")
+	}
+	// sqlite only allows a single writer
+	db.SetMaxOpenConns(1)
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			logrus.Info("closing connection for sqlite")
+			return db.Close()
+		},
+	})
+
+	migrateSQLite(db)
+
+	return &SQLiteDatabase{db}
+}
+
+func migrateSQLite(db *sql.DB) {
+	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to get driver to migrate")
+	}
+
+	m, err := migrate.NewWithDatabaseInstance(
+		"file://migrations/sqlite",
+		"sqlite3", driver)
+	if err != nil {
+		logrus.WithError(err).Fatal("unable to create migration instance")
+	}
+	if err := m.Up(); err != nil {
+		if err != migrate.ErrNoChange {
+			logrus.WithError(err).Fatal("unable to migrate")
+		}
+		logrus.Info("no migrations to run")
+	}
+}
+
+func (r *SQLiteDatabase) FindAll(ctx context.Context, filter map[string]interface{}) (docs []*documents.Document, err error) {
+	return r.findDocuments(ctx, documents.ListOptions{Filter: filter})
+}
+
+func (r *SQLiteDatabase) FindPage(ctx context.Context, opts documents.ListOptions) (*documents.DocumentPage, error) {
+	row := sq.Select("count(documents.id)").
+		From("documents").
+		Where(documentFilter(ctx, opts.Filter)).RunWith(r.conn).QueryRowContext(ctx)
+	var total int
+	if err := row.Scan(&total); err != nil {
+		logrus.WithError(err).Error("unable to count results")
+		return nil, errors.New("unable to count results")
+	}
+
+	docs, err := r.findDocuments(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &documents.DocumentPage{
+		Items:  docs,
+		Total:  total,
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+	}, nil
+}
+
+// findDocuments lists documents matching the options, a zero limit returns every match.
+func (r *SQLiteDatabase) findDocuments(ctx context.Context, opts documents.ListOptions) (docs []*documents.Document, err error) {
+	docs = []*documents.Document{}
+	query := sq.Select("documents.id", "COALESCE(description, '')", "display_name", "name", "type", "path", "COALESCE(group_concat(tagged_resources.id, ','), '')", "documents.created", "updated", "title", "authors", "publisher", "language", "isbn", "page_count", "format", "size", "hash", "missing_since", "deleted", "series", "series_index", "rating", "review", "COALESCE(documents.user_id, '')").
+		From("documents").
+		LeftJoin("tagged_resources ON documents.id=tagged_resources.resource_id").
+		Where(documentFilter(ctx, opts.Filter)).
+		GroupBy("documents.id").
+		OrderBy(documentOrder(opts)...)
+	if opts.Limit > 0 {
+		query = query.Limit(uint64(opts.Limit)).Offset(uint64(opts.Offset))
+	}
+	rows, err := query.RunWith(r.conn).QueryContext(ctx)
+
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch results")
+		return nil, errors.New("unable to fetch results")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		doc := &documents.Document{}
+		var tagList, authors string
+		doc.Tags = []string{}
+		if err := rows.Scan(&doc.ID, &doc.Description, &doc.DisplayName, &doc.Name, &doc.Type, &doc.Path, &tagList, &doc.Created, &doc.Updated,
+			&doc.Title, &authors, &doc.Publisher, &doc.Language, &doc.ISBN, &doc.PageCount, &doc.Format, &doc.Size, &doc.Hash, &doc.Missing, &doc.Deleted, &doc.Series, &doc.SeriesIndex, &doc.Rating, &doc.Review, &doc.UserID); err != nil {
+			logrus.WithError(err).Warn("unable to scan doc results")
+		}
+		if tagList != "" {
+			doc.Tags = append(doc.Tags, strings.Split(tagList, ",")...)
+		}
+		doc.Authors = splitAuthors(authors)
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func (r *SQLiteDatabase) FindByID(ctx context.Context, id string) (*documents.Document, error) {
+	row := sq.Select("documents.id", "COALESCE(description, '')", "display_name", "name", "type", "path", "COALESCE(group_concat(tagged_resources.id, ','), '')", "documents.created", "updated", "title", "authors", "publisher", "language", "isbn", "page_count", "format", "size", "hash", "missing_since", "deleted", "series", "series_index", "rating", "review", "COALESCE(documents.user_id, '')").
+		From("documents").
+		LeftJoin("tagged_resources ON documents.id=tagged_resources.resource_id").
+		Suffix("GROUP BY documents.id").
+		Where(sq.And{sq.Eq{"documents.id": id}, ownerFilter(ctx)}).RunWith(r.conn).QueryRowContext(ctx)
+	doc := &documents.Document{}
+	var tagList, authors string
+	doc.Tags = []string{}
+	if err := row.Scan(&doc.ID, &doc.Description, &doc.DisplayName, &doc.Name, &doc.Type, &doc.Path, &tagList, &doc.Created, &doc.Updated,
+		&doc.Title, &authors, &doc.Publisher, &doc.Language, &doc.ISBN, &doc.PageCount, &doc.Format, &doc.Size, &doc.Hash, &doc.Missing, &doc.Deleted, &doc.Series, &doc.SeriesIndex, &doc.Rating, &doc.Review, &doc.UserID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, documents.ErrNotFound
+		}
+		logrus.WithError(err).Warn("unable to scan doc results")
+	}
+	if tagList != "" {
+		doc.Tags = append(doc.Tags, strings.Split(tagList, ",")...)
+	}
+	doc.Authors = splitAuthors(authors)
+
+	return doc, nil
+}
+
+func (r *SQLiteDatabase) UpdateDocument(ctx context.Context, doc documents.Document) (result documents.Document, err error) {
+	_, err = sq.Update("documents").SetMap(
+		map[string]interface{}{
+			"description":  doc.Description,
+			"display_name": doc.DisplayName,
+			"type":         doc.Type,
+			"title":        doc.Title,
+			"authors":      joinAuthors(doc.Authors),
+			"publisher":    doc.Publisher,
+			"language":     doc.Language,
+			"isbn":         doc.ISBN,
+			"page_count":   doc.PageCount,
+			"series":       doc.Series,
+			"series_index": doc.SeriesIndex,
+			"rating":       doc.Rating,
+			"review":       doc.Review,
+			"updated":      time.Now()}).
+		Where(sq.And{sq.Eq{"id": doc.ID}, ownerFilter(ctx)}).RunWith(r.conn).ExecContext(ctx)
+
+	if err != nil {
+		logrus.WithError(err).Error("unable to update doc")
+		return result, errors.New("unable to update doc")
+	}
+	r.refreshSearch(ctx, doc.ID)
+
+	return doc, nil
+}
+
+func (r *SQLiteDatabase) UpdateFile(ctx context.Context, doc documents.Document) error {
+	_, err := sq.Update("documents").SetMap(
+		map[string]interface{}{
+			"path":          doc.Path,
+			"size":          doc.Size,
+			"hash":          doc.Hash,
+			"missing_since": doc.Missing,
+			"updated":       time.Now()}).
+		Where(sq.And{sq.Eq{"id": doc.ID}, ownerFilter(ctx)}).RunWith(r.conn).ExecContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to update doc file")
+		return errors.New("unable to update doc file")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) UpdateDeleted(ctx context.Context, id string, deleted *time.Time) error {
+	_, err := sq.Update("documents").
+		Set("deleted", deleted).
+		Where(sq.And{sq.Eq{"id": id}, ownerFilter(ctx)}).RunWith(r.conn).ExecContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to update doc trash state")
+		return errors.New("unable to update doc trash state")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) Insert(ctx context.Context, doc *documents.Document) error {
+	created := doc.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	if _, err := sq.Insert("documents").Columns("id", "description", "display_name", "name", "type", "path", "created", "title", "authors", "publisher", "language", "isbn", "page_count", "format", "size", "hash", "series", "series_index", "rating", "review", "user_id").
+		Values(doc.ID, doc.Description, doc.DisplayName, doc.Name, doc.Type, doc.Path, created, doc.Title, joinAuthors(doc.Authors), doc.Publisher, doc.Language, doc.ISBN, doc.PageCount, doc.Format, doc.Size, doc.Hash, doc.Series, doc.SeriesIndex, doc.Rating, doc.Review, nullable(doc.UserID)).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert doc")
+		return errors.New("unable to insert doc metadata")
+	}
+	r.refreshSearch(ctx, doc.ID)
+	return nil
+}
+
+// Delete removes a document with its tag links, content and search entry in one transaction,
+// the fts table can't reference documents so it isn't cleaned up by a cascade.
+func (r *SQLiteDatabase) Delete(ctx context.Context, id string) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		logrus.WithError(err).Warn("unable to start delete")
+		return errors.New("unable to delete")
+	}
+	if owned, err := documentOwned(ctx, tx, sq.StatementBuilder, id); err != nil || !owned {
+		tx.Rollback()
+		if err != nil {
+			logrus.WithError(err).Warn("unable to check doc owner")
+			return errors.New("unable to delete")
+		}
+		return documents.ErrNotFound
+	}
+	for _, q := range []sq.DeleteBuilder{
+		sq.Delete("document_search").Where(sq.Eq{"id": id}),
+		sq.Delete("document_content").Where(sq.Eq{"id": id}),
+		sq.Delete("tagged_resources").Where(sq.Eq{"resource_id": id}),
+		sq.Delete("reading_progress").Where(sq.Eq{"document_id": id}),
+		sq.Delete("annotations").Where(sq.Eq{"document_id": id}),
+		sq.Delete("documents").Where(sq.Eq{"id": id}),
+	} {
+		if _, err := q.RunWith(tx).ExecContext(ctx); err != nil {
+			tx.Rollback()
+			logrus.WithError(err).Warn("unable to delete doc")
+			return errors.New("unable to delete")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logrus.WithError(err).Warn("unable to commit delete")
+		return errors.New("unable to delete")
+	}
+	return nil
+}
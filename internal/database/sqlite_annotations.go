@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/annotations"
+	"github.com/sirupsen/logrus"
+)
+
+func (r *SQLiteDatabase) FindAnnotations(ctx context.Context, documentID string) ([]*annotations.Annotation, error) {
+	return findAnnotations(ctx, sq.Select(annotationColumns...).
+		From("annotations").
+		Where(sq.And{sq.Eq{"document_id": documentID}, ownedDocuments(ctx, "document_id")}).
+		OrderBy("created ASC", "id ASC").
+		RunWith(r.conn))
+}
+
+func (r *SQLiteDatabase) FindAllAnnotations(ctx context.Context) ([]*annotations.Annotation, error) {
+	return findAnnotations(ctx, sq.Select(annotationColumns...).
+		From("annotations").
+		Where(ownedDocuments(ctx, "document_id")).
+		OrderBy("document_id ASC", "created ASC", "id ASC").
+		RunWith(r.conn))
+}
+
+func (r *SQLiteDatabase) FindAnnotationByID(ctx context.Context, id string) (*annotations.Annotation, error) {
+	row := sq.Select(annotationColumns...).
+		From("annotations").
+		Where(sq.And{sq.Eq{"id": id}, ownedDocuments(ctx, "document_id")}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanAnnotation(row)
+}
+
+func (r *SQLiteDatabase) InsertAnnotation(ctx context.Context, annotation *annotations.Annotation) error {
+	if _, err := sq.Insert("annotations").Columns(annotationColumns...).
+		Values(annotationValues(annotation)...).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert annotation")
+		return errors.New("unable to insert annotation")
+	}
+	r.refreshSearch(ctx, annotation.DocumentID)
+	return nil
+}
+
+func (r *SQLiteDatabase) InsertAnnotations(ctx context.Context, documentID string, list []*annotations.Annotation) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		logrus.WithError(err).Warn("unable to start annotation insert")
+		return errors.New("unable to insert annotations")
+	}
+	if err := insertAnnotations(ctx, tx, sq.StatementBuilder, list); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logrus.WithError(err).Warn("unable to commit annotations")
+		return errors.New("unable to insert annotations")
+	}
+	r.refreshSearch(ctx, documentID)
+	return nil
+}
+
+func (r *SQLiteDatabase) UpdateAnnotation(ctx context.Context, annotation annotations.Annotation) error {
+	if _, err := sq.Update("annotations").SetMap(annotationFields(annotation)).
+		Where(sq.And{sq.Eq{"id": annotation.ID}, ownedDocuments(ctx, "document_id")}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update annotation")
+		return errors.New("unable to update annotation")
+	}
+	r.refreshSearch(ctx, annotation.DocumentID)
+	return nil
+}
+
+func (r *SQLiteDatabase) DeleteAnnotation(ctx context.Context, documentID string, id string) error {
+	if _, err := sq.Delete("annotations").
+		Where(sq.And{sq.Eq{"id": id, "document_id": documentID}, ownedDocuments(ctx, "document_id")}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to delete annotation")
+		return errors.New("unable to delete annotation")
+	}
+	r.refreshSearch(ctx, documentID)
+	return nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/backups"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/sirupsen/logrus"
+)
+
+func (r *SQLiteDatabase) ExportCatalog(ctx context.Context) (*backups.Catalog, error) {
+	docs, err := r.findDocuments(ctx, documents.ListOptions{Filter: map[string]interface{}{documents.TrashFilter: documents.TrashIncluded}})
+	if err != nil {
+		return nil, err
+	}
+	tagList, err := r.FindAllTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	content, err := exportContent(ctx, sq.Select("id", "content").From("document_content").Where(sq.NotEq{"content": ""}).RunWith(r.conn))
+	if err != nil {
+		return nil, err
+	}
+	progressList, err := exportProgress(ctx, sq.Select(progressColumns...).From("reading_progress").RunWith(r.conn))
+	if err != nil {
+		return nil, err
+	}
+	annotationList, err := r.FindAllAnnotations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userList, err := r.FindAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &backups.Catalog{Documents: docs, Tags: tagList, Content: content, Progress: progressList, Annotations: annotationList, Users: userList}, nil
+}
+
+// RestoreCatalog replaces the catalog in one transaction, the search index is rebuilt from
+// the restored content afterwards.
+func (r *SQLiteDatabase) RestoreCatalog(ctx context.Context, catalog *backups.Catalog) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		logrus.WithError(err).Error("unable to start restore")
+		return errors.New("unable to restore catalog")
+	}
+	tables := []string{"document_search", "document_content", "tagged_resources", "reading_progress", "annotations", "documents", "tags"}
+	if err := restoreCatalog(ctx, tx, sq.StatementBuilder, catalog, tables); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		logrus.WithError(err).Error("unable to commit restore")
+		return errors.New("unable to restore catalog")
+	}
+
+	for _, doc := range catalog.Documents {
+		if content, ok := catalog.Content[doc.ID]; ok {
+			if err := r.UpdateContent(ctx, doc.ID, content); err != nil {
+				return err
+			}
+			continue
+		}
+		r.refreshSearch(ctx, doc.ID)
+	}
+	return nil
+}
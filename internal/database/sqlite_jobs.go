@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// sqliteTimeLayout is how job times are written, in UTC and fixed width so they compare as text
+// with each other and with current_timestamp. The driver's own format keeps the zone of the value
+// and trims the fraction, which orders some times wrongly. It matches strftime('%Y-%m-%d %H:%M:%f').
+const sqliteTimeLayout = "2006-01-02 15:04:05.000"
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+func sqliteNullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return sqliteTime(*t)
+}
+
+func (r *SQLiteDatabase) InsertJob(ctx context.Context, job *jobs.Job) error {
+	if _, err := sq.Insert("jobs").Columns(jobColumns...).
+		Values(job.ID, job.Type, string(job.Payload), job.Status, job.Attempts, job.MaxAttempts, job.Error, sqliteTime(job.RunAt), sqliteNullTime(job.LockedUntil), sqliteTime(job.Created), sqliteNullTime(job.Updated), job.UserID, string(job.Result)).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert job")
+		return errors.New("unable to insert job")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) FindJobByID(ctx context.Context, id string) (*jobs.Job, error) {
+	row := sq.Select(jobColumns...).
+		From("jobs").
+		Where(sq.And{sq.Eq{"id": id}, jobFilter(ctx)}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanJob(row)
+}
+
+// ClaimJob only updates the job while it is unchanged, with the single connection the select
+// and update can't interleave with another claim.
+func (r *SQLiteDatabase) ClaimJob(ctx context.Context, now time.Time, lockedUntil time.Time) (*jobs.Job, error) {
+	row := sq.Select(jobColumns...).
+		From("jobs").
+		Where(sq.Or{
+			sq.And{sq.Eq{"status": jobs.StatusPending}, sq.LtOrEq{"run_at": sqliteTime(now)}},
+			sq.And{sq.Eq{"status": jobs.StatusRunning}, sq.Lt{"locked_until": sqliteTime(now)}},
+		}).
+		OrderBy("run_at ASC").
+		Limit(1).
+		RunWith(r.conn).QueryRowContext(ctx)
+	job, err := scanJob(row)
+	if err == jobs.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := sq.Update("jobs").
+		Set("status", jobs.StatusRunning).
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("updated", sqliteTime(now)).
+		Set("locked_until", sqliteTime(lockedUntil)).
+		Where(sq.Eq{"id": job.ID, "status": job.Status, "attempts": job.Attempts}).
+		RunWith(r.conn).
+		ExecContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to claim job")
+		return nil, errors.New("unable to claim job")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// claimed by another worker in between
+		return nil, nil
+	}
+	job.Status = jobs.StatusRunning
+	job.Attempts++
+	job.Updated = &now
+	job.LockedUntil = &lockedUntil
+	return job, nil
+}
+
+func (r *SQLiteDatabase) UpdateJob(ctx context.Context, job jobs.Job) error {
+	if _, err := sq.Update("jobs").SetMap(map[string]interface{}{
+		"status":       job.Status,
+		"attempts":     job.Attempts,
+		"error":        job.Error,
+		"run_at":       sqliteTime(job.RunAt),
+		"locked_until": sqliteNullTime(job.LockedUntil),
+		"updated":      sqliteNullTime(job.Updated),
+		"result":       string(job.Result),
+	}).
+		Where(sq.Eq{"id": job.ID}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update job")
+		return errors.New("unable to update job")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) ExtendJobLease(ctx context.Context, id string, lockedUntil time.Time) error {
+	if _, err := sq.Update("jobs").
+		Set("locked_until", sqliteTime(lockedUntil)).
+		Where(sq.Eq{"id": id, "status": jobs.StatusRunning}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to extend job lease")
+		return errors.New("unable to extend job lease")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) DeleteFinishedJobs(ctx context.Context, before time.Time) (int, error) {
+	res, err := sq.Delete("jobs").
+		Where(sq.Eq{"status": []jobs.Status{jobs.StatusSucceeded, jobs.StatusFailed}}).
+		Where(sq.Lt{"updated": sqliteTime(before)}).
+		RunWith(r.conn).
+		ExecContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to delete finished jobs")
+		return 0, errors.New("unable to delete finished jobs")
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSQLiteTime checks that job times compare as text in the order of the times, whatever zone
+// they come in, and around values current_timestamp writes.
+func TestSQLiteTime(t *testing.T) {
+	east := time.FixedZone("east", 2*60*60)
+	base := time.Date(2021, time.March, 14, 9, 26, 53, 0, time.UTC)
+	tests := []struct {
+		name          string
+		before, after interface{} // a time or text stored by sqlite
+	}{
+		{"fraction trimmed by the driver", base.Add(670 * time.Millisecond), base.Add(672 * time.Millisecond)},
+		{"earlier in a zone ahead", base.In(east), base.Add(time.Minute)},
+		{"later in a zone ahead", base.Add(-time.Minute), base.Add(time.Hour).In(east)},
+		{"current_timestamp before", "2021-03-14 09:26:52", base},
+		{"current_timestamp after", base, "2021-03-14 09:26:54"},
+	}
+	text := func(v interface{}) string {
+		if s, ok := v.(string); ok {
+			return s
+		}
+		return sqliteTime(v.(time.Time))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if before, after := text(tt.before), text(tt.after); before >= after {
+				t.Errorf("%q sorts after %q", before, after)
+			}
+		})
+	}
+
+	if got, want := sqliteTime(base.Add(5*time.Millisecond).In(east)), "2021-03-14 09:26:53.005"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"github.com/sirupsen/logrus"
+)
+
+func (r *SQLiteDatabase) FindAllProgress(ctx context.Context) ([]*progress.Progress, error) {
+	return exportProgress(ctx, sq.Select(progressColumns...).From("reading_progress").Where(ownedDocuments(ctx, "document_id")).OrderBy("document_id").RunWith(r.conn))
+}
+
+func (r *SQLiteDatabase) FindProgress(ctx context.Context, documentID string) (*progress.Progress, error) {
+	row := sq.Select(progressColumns...).
+		From("reading_progress").
+		Where(sq.And{sq.Eq{"document_id": documentID}, ownedDocuments(ctx, "document_id")}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanProgressRow(row)
+}
+
+func (r *SQLiteDatabase) UpsertProgress(ctx context.Context, p progress.Progress) error {
+	if _, err := sq.Insert("reading_progress").Options("OR REPLACE").Columns(progressColumns...).
+		Values(progressValues(&p)...).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to save progress")
+		return errors.New("unable to save progress")
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/sirupsen/logrus"
+)
+
+func (r *SQLiteDatabase) InsertScan(ctx context.Context, scan *documents.Scan) error {
+	if _, err := sq.Insert("scans").Columns(scanColumns...).
+		Values(scanValues(*scan)...).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert scan")
+		return errors.New("unable to insert scan")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) FindScanByID(ctx context.Context, id string) (*documents.Scan, error) {
+	row := sq.Select(scanColumns...).
+		From("scans").
+		Where(sq.Eq{"id": id}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanScan(row)
+}
+
+func (r *SQLiteDatabase) UpdateScan(ctx context.Context, scan documents.Scan) error {
+	if _, err := sq.Update("scans").SetMap(scanProgress(scan)).
+		Where(sq.Eq{"id": scan.ID}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update scan")
+		return errors.New("unable to update scan")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) RequestScanCancel(ctx context.Context, id string) error {
+	if _, err := sq.Update("scans").
+		Set("cancel_requested", true).
+		Where(sq.Eq{"id": id}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to cancel scan")
+		return errors.New("unable to cancel scan")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/search"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+// sqliteSearchWeights weights matches per fts column: id, display_name, name, description, tags, content, annotations.
+var sqliteSearchWeights = []float64{0, 10, 4, 4, 4, 1, 2}
+
+func (r *SQLiteDatabase) refreshSearch(ctx context.Context, id string) {
+	if _, err := sq.Delete("document_search").Where(sq.Eq{"id": id}).RunWith(r.conn).ExecContext(ctx); err != nil {
+		logrus.WithError(err).WithField("id", id).Warn("unable to clear search index")
+		return
+	}
+	if _, err := r.conn.ExecContext(ctx, `INSERT INTO document_search(id, display_name, name, description, tags, content, annotations)
+SELECT d.id, d.display_name, d.name, COALESCE(d.description, ''),
+    COALESCE((SELECT group_concat(t.name, ' ') FROM tags t JOIN tagged_resources tr ON t.id = tr.id WHERE tr.resource_id = d.id), ''),
+    COALESCE(c.content, ''),
+    COALESCE((SELECT group_concat(a.text || ' ' || a.note, ' ') FROM annotations a WHERE a.document_id = d.id), '')
+FROM documents d LEFT JOIN document_content c ON c.id = d.id
+WHERE d.id = ?`, id); err != nil {
+		logrus.WithError(err).WithField("id", id).Warn("unable to refresh search index")
+	}
+}
+
+func (r *SQLiteDatabase) taggedResourceIDs(ctx context.Context, tagID string) []string {
+	rows, err := sq.Select("resource_id").From("tagged_resources").
+		Where(sq.Eq{"id": tagID}).RunWith(r.conn).QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("unable to fetch tagged resources")
+		return nil
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (r *SQLiteDatabase) UpdateContent(ctx context.Context, id string, content string) error {
+	if _, err := sq.Insert("document_content").Options("OR REPLACE").Columns("id", "content").
+		Values(id, content).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to store document content")
+		return errors.New("unable to store document content")
+	}
+	r.refreshSearch(ctx, id)
+	return nil
+}
+
+// SearchDocuments ranks matches in go from fts4 matchinfo since sqlite has no built in ranking.
+func (r *SQLiteDatabase) SearchDocuments(ctx context.Context, query search.Query) ([]search.Hit, int, error) {
+	terms := search.Terms(query.Text)
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"`
+	}
+
+	rows, err := sq.Select("id", "snippet(document_search, '"+search.MatchStart+"', '"+search.MatchEnd+"', '...', -1, 32)", "matchinfo(document_search, 'pcx')").
+		From("document_search").
+		Where("document_search MATCH ?", strings.Join(quoted, " ")).
+		Where("id IN (SELECT id FROM documents WHERE deleted IS NULL)").
+		Where(ownedDocuments(ctx, "id")).
+		RunWith(r.conn).QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to search")
+		return nil, 0, errors.New("unable to search")
+	}
+	defer rows.Close()
+
+	hits := []search.Hit{}
+	for rows.Next() {
+		hit := search.Hit{}
+		var info []byte
+		if err := rows.Scan(&hit.ID, &hit.Snippet, &info); err != nil {
+			logrus.WithError(err).Warn("unable to scan search results")
+			continue
+		}
+		hit.Snippet = search.MarkSnippet(hit.Snippet)
+		hit.Rank = matchinfoRank(info)
+		hits = append(hits, hit)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Rank == hits[j].Rank {
+			return hits[i].ID < hits[j].ID
+		}
+		return hits[i].Rank > hits[j].Rank
+	})
+
+	total := len(hits)
+	if query.Offset >= total {
+		return []search.Hit{}, total, nil
+	}
+	end := query.Offset + query.Limit
+	if end > total {
+		end = total
+	}
+	return hits[query.Offset:end], total, nil
+}
+
+// matchinfoRank scores a row from matchinfo 'pcx' output, which holds the phrase and column
+// counts followed by hits in this row, hits in all rows and rows with hits for each phrase
+// and column. Hits are weighted by column and scaled by how rare the phrase is.
+func matchinfoRank(info []byte) float64 {
+	values := make([]uint32, len(info)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(info[i*4:])
+	}
+	if len(values) < 2 {
+		return 0
+	}
+	phrases, columns := int(values[0]), int(values[1])
+	rank := 0.0
+	for p := 0; p < phrases; p++ {
+		for c := 0; c < columns && c < len(sqliteSearchWeights); c++ {
+			i := 2 + 3*(p*columns+c)
+			if i+2 >= len(values) {
+				return rank
+			}
+			hits, rowsWithHits := values[i], values[i+2]
+			if hits == 0 || rowsWithHits == 0 {
+				continue
+			}
+			rank += sqliteSearchWeights[c] * float64(hits) / float64(rowsWithHits)
+		}
+	}
+	return rank
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/sirupsen/logrus"
+)
+
+func (r *SQLiteDatabase) FindAllTags(ctx context.Context) ([]*tags.Tag, error) {
+	rows, err := sq.Select(tagColumns...).
+		From("tags").
+		Where(tagFilter(ctx)).
+		OrderBy("name ASC").
+		RunWith(r.conn).QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch tags")
+		return nil, errors.New("unable to fetch tags")
+	}
+	return scanTags(rows), nil
+}
+
+func (r *SQLiteDatabase) FindTagByID(ctx context.Context, id string) (*tags.Tag, error) {
+	row := sq.Select(tagColumns...).
+		From("tags").
+		Where(sq.And{sq.Eq{"id": id}, tagFilter(ctx)}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanTag(row)
+}
+
+func (r *SQLiteDatabase) FindTagByName(ctx context.Context, name string) (*tags.Tag, error) {
+	row := sq.Select(tagColumns...).
+		From("tags").
+		Where(sq.And{sq.Expr("lower(name) = lower(?)", name), tagFilter(ctx)}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanTag(row)
+}
+
+func (r *SQLiteDatabase) InsertTag(ctx context.Context, tag *tags.Tag) error {
+	if _, err := sq.Insert("tags").Columns("id", "name", "created", "user_id").
+		Values(tag.ID, tag.Name, tag.Created, nullable(tag.UserID)).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert tag")
+		return errors.New("unable to insert tag")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) UpdateTag(ctx context.Context, tag tags.Tag) (tags.Tag, error) {
+	if _, err := sq.Update("tags").Set("name", tag.Name).
+		Where(sq.And{sq.Eq{"id": tag.ID}, tagFilter(ctx)}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update tag")
+		return tags.Tag{}, errors.New("unable to update tag")
+	}
+	for _, id := range r.taggedResourceIDs(ctx, tag.ID) {
+		r.refreshSearch(ctx, id)
+	}
+	return tag, nil
+}
+
+func (r *SQLiteDatabase) DeleteTag(ctx context.Context, id string) error {
+	if _, err := r.FindTagByID(ctx, id); err != nil {
+		return err
+	}
+	resources := r.taggedResourceIDs(ctx, id)
+	// tagged_resources predates the tags table so it has no foreign key to cascade
+	if _, err := sq.Delete("tagged_resources").Where(sq.Eq{"id": id}).RunWith(r.conn).ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to delete tagged resources")
+		return errors.New("unable to delete tag")
+	}
+	if _, err := sq.Delete("tags").Where(sq.And{sq.Eq{"id": id}, tagFilter(ctx)}).RunWith(r.conn).ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to delete tag")
+		return errors.New("unable to delete tag")
+	}
+	for _, resourceID := range resources {
+		r.refreshSearch(ctx, resourceID)
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) FindTagsByResource(ctx context.Context, resourceID string) ([]*tags.Tag, error) {
+	rows, err := sq.Select(tagColumns...).
+		From("tags").
+		Join("tagged_resources ON tags.id=tagged_resources.id").
+		Where(sq.And{sq.Eq{"tagged_resources.resource_id": resourceID}, ownedDocuments(ctx, "tagged_resources.resource_id"), tagFilter(ctx)}).
+		OrderBy("tags.name ASC").
+		RunWith(r.conn).QueryContext(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch resource tags")
+		return nil, errors.New("unable to fetch tags")
+	}
+	return scanTags(rows), nil
+}
+
+func (r *SQLiteDatabase) TagResource(ctx context.Context, tagID string, resourceID string) error {
+	if owned, err := documentOwned(ctx, r.conn, sq.StatementBuilder, resourceID); err != nil {
+		logrus.WithError(err).Warn("unable to check resource owner")
+		return errors.New("unable to tag resource")
+	} else if !owned {
+		return tags.ErrResourceNotFound
+	}
+	if _, err := sq.Insert("tagged_resources").Options("OR IGNORE").Columns("id", "resource_id").
+		Values(tagID, resourceID).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to tag resource")
+		return errors.New("unable to tag resource")
+	}
+	r.refreshSearch(ctx, resourceID)
+	return nil
+}
+
+func (r *SQLiteDatabase) UntagResource(ctx context.Context, tagID string, resourceID string) error {
+	if _, err := sq.Delete("tagged_resources").
+		Where(sq.And{sq.Eq{"id": tagID, "resource_id": resourceID}, ownedDocuments(ctx, "resource_id")}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to untag resource")
+		return errors.New("unable to untag resource")
+	}
+	r.refreshSearch(ctx, resourceID)
+	return nil
+}
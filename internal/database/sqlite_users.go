@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"errors"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/holmes89/book-organizer/internal/users"
+	"github.com/sirupsen/logrus"
+)
+
+func (r *SQLiteDatabase) FindAllUsers(ctx context.Context) ([]*users.User, error) {
+	return findUsers(ctx, sq.Select(userColumns...).From("users").OrderBy("created ASC").RunWith(r.conn))
+}
+
+func (r *SQLiteDatabase) FindUserByID(ctx context.Context, id string) (*users.User, error) {
+	row := sq.Select(userColumns...).
+		From("users").
+		Where(sq.Eq{"id": id}).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanUser(row)
+}
+
+func (r *SQLiteDatabase) FindUserByUsername(ctx context.Context, username string) (*users.User, error) {
+	row := sq.Select(userColumns...).
+		From("users").
+		Where("lower(username) = lower(?)", username).
+		RunWith(r.conn).QueryRowContext(ctx)
+	return scanUser(row)
+}
+
+func (r *SQLiteDatabase) InsertUser(ctx context.Context, user *users.User) error {
+	if _, err := sq.Insert("users").Columns(userColumns...).
+		Values(userValues(user)...).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Warn("unable to insert user")
+		return errors.New("unable to insert user")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) UpdateUserPassword(ctx context.Context, id string, passwordHash string) error {
+	if _, err := sq.Update("users").Set("password_hash", passwordHash).
+		Where(sq.Eq{"id": id}).
+		RunWith(r.conn).
+		ExecContext(ctx); err != nil {
+		logrus.WithError(err).Error("unable to update password")
+		return errors.New("unable to update password")
+	}
+	return nil
+}
+
+func (r *SQLiteDatabase) AdoptDocuments(ctx context.Context, userID string) (int, error) {
+	return adoptDocuments(ctx, r.conn, sq.StatementBuilder, userID)
+}
@@ -0,0 +1,131 @@
+package documents
+
+import (
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/matchers"
+	"github.com/holmes89/book-organizer/internal/extract"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Formats a document file can be stored in.
+const (
+	FormatPdf  = "pdf"
+	FormatEpub = "epub"
+	FormatMobi = "mobi"
+	FormatAzw3 = "azw3"
+	FormatCbz  = "cbz"
+	FormatCbr  = "cbr"
+)
+
+// formatMIME is the mime type of each format, used for extraction and serving files.
+var formatMIME = map[string]string{
+	FormatPdf:  extract.MIMEPdf,
+	FormatEpub: extract.MIMEEpub,
+	FormatMobi: extract.MIMEMobi,
+	FormatAzw3: extract.MIMEAzw3,
+	FormatCbz:  extract.MIMECbz,
+	FormatCbr:  extract.MIMECbr,
+}
+
+// FormatMIME returns the mime type of a format, empty for unknown formats.
+func FormatMIME(format string) string {
+	return formatMIME[format]
+}
+
+// KindleLocationPrefix marks a Kindle location, which Kindles give in place of a page for books
+// without page numbers. They count through the text so they only mean something in Kindle formats
+// and EPUBs, which Kindles read converted.
+const KindleLocationPrefix = "loc:"
+
+// ValidLocation reports whether a location can point into the document. EPUBs are addressed
+// with an EPUB CFI and every other format by page number, Kindle formats and EPUBs can also be
+// addressed by Kindle location.
+func (d *Document) ValidLocation(location string) bool {
+	if strings.HasPrefix(location, KindleLocationPrefix) {
+		return LocationKindle(location) > 0 && (d.Format == FormatMobi || d.Format == FormatAzw3 || d.Format == FormatEpub)
+	}
+	if d.Format == FormatEpub {
+		return strings.HasPrefix(location, "epubcfi(") && strings.HasSuffix(location, ")")
+	}
+	page := LocationPage(location)
+	return page > 0 && (d.PageCount == 0 || page <= d.PageCount)
+}
+
+// LocationPage returns the page a location points to, zero when it isn't a page number.
+func LocationPage(location string) int {
+	page, err := strconv.Atoi(location)
+	if err != nil || page < 0 {
+		return 0
+	}
+	return page
+}
+
+// LocationKindle returns the Kindle location a location points to, zero when it isn't one.
+func LocationKindle(location string) int {
+	if !strings.HasPrefix(location, KindleLocationPrefix) {
+		return 0
+	}
+	return LocationPage(strings.TrimPrefix(location, KindleLocationPrefix))
+}
+
+// formatExts maps the file extensions picked up by Scan to their format.
+var formatExts = map[string]string{
+	".pdf":  FormatPdf,
+	".epub": FormatEpub,
+	".mobi": FormatMobi,
+	".azw":  FormatMobi,
+	".azw3": FormatAzw3,
+	".cbz":  FormatCbz,
+	".cbr":  FormatCbr,
+}
+
+// formatFromExt returns the format a file name suggests.
+func formatFromExt(ext string) (string, bool) {
+	format, ok := formatExts[strings.ToLower(ext)]
+	return format, ok
+}
+
+// detectFormat sniffs the format from the content of a file. Comic archives have no magic
+// number of their own so any zip of images is a CBZ and any rar a CBR.
+func detectFormat(file io.ReaderAt, size int64) (string, bool) {
+	head := make([]byte, 261)
+	if bytesRead, err := file.ReadAt(head, 0); err != nil && err != io.EOF {
+		logrus.WithField("bytesRead", bytesRead).WithError(err).Error("couldn't read file header")
+		return "", false
+	} else if bytesRead == 0 {
+		logrus.Error("couldn't read file header: empty file")
+		return "", false
+	}
+
+	if extract.IsMobi(head) {
+		mime, err := extract.MobiFormat(file, size)
+		if err != nil {
+			logrus.WithError(err).Error("unable to read mobi header")
+			return "", false
+		}
+		if mime == extract.MIMEAzw3 {
+			return FormatAzw3, true
+		}
+		return FormatMobi, true
+	}
+
+	// filetype.Match tries its matchers in random order and a zip can match before an epub,
+	// so the formats are checked most specific first
+	switch {
+	case matchers.Pdf(head):
+		return FormatPdf, true
+	case matchers.Epub(head):
+		return FormatEpub, true
+	case matchers.Rar(head):
+		return FormatCbr, true
+	case matchers.Zip(head) && extract.IsComicArchive(file, size):
+		return FormatCbz, true
+	}
+
+	kind, _ := filetype.Match(head)
+	logrus.WithFields(logrus.Fields{"mime": kind.MIME.Value, "ext": kind.Extension}).Error("file type not supported")
+	return "", false
+}
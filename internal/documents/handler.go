@@ -2,11 +2,17 @@ package documents
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/holmes89/book-organizer/internal/common"
 	"github.com/sirupsen/logrus"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func MakeDocumentHandler(mr *mux.Router, service DocumentService) http.Handler {
@@ -16,10 +22,15 @@ func MakeDocumentHandler(mr *mux.Router, service DocumentService) http.Handler {
 		service: service,
 	}
 
+	r.HandleFunc("/{id}/cover", h.Cover).Methods("GET")
+	r.HandleFunc("/{id}/content", h.Content).Methods("GET", "HEAD")
+	r.HandleFunc("/{id}/restore", h.Restore).Methods("POST")
 	r.HandleFunc("/{id}", h.FindByID).Methods("GET")
 	r.HandleFunc("/{id}", h.UpdateFields).Methods("PATCH")
 	r.HandleFunc("/{id}", h.Delete).Methods("DELETE")
 	r.HandleFunc("/scan", h.Scan).Methods("PUT")
+	r.HandleFunc("/scans/{id}", h.FindScan).Methods("GET")
+	r.HandleFunc("/scans/{id}/cancel", h.CancelScan).Methods("POST")
 	r.HandleFunc("/", h.FindAll).Methods("GET")
 
 	return r
@@ -42,6 +53,10 @@ func (h *documentHandler) FindByID(w http.ResponseWriter, r *http.Request) {
 
 	entity, err := h.service.FindByID(ctx, id)
 
+	if err == ErrNotFound {
+		common.MakeError(w, http.StatusNotFound, "document", err.Error(), "findbyid")
+		return
+	}
 	if err != nil {
 		common.MakeError(w, http.StatusInternalServerError, "document", "Server Error", "findbyid")
 		return
@@ -50,6 +65,74 @@ func (h *documentHandler) FindByID(w http.ResponseWriter, r *http.Request) {
 	common.EncodeResponse(r.Context(), w, entity)
 }
 
+func (h *documentHandler) Cover(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	cover, err := h.service.Cover(ctx, id)
+	if err == ErrNotFound || err == ErrCoverNotFound {
+		common.MakeError(w, http.StatusNotFound, "document", err.Error(), "cover")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "document", "Server Error", "cover")
+		return
+	}
+	defer cover.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	if _, err := io.Copy(w, cover); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to write cover")
+	}
+}
+
+// Content streams the file of a document through the server. Range requests are answered so
+// viewers can seek without downloading the whole file, and it is shown inline unless download
+// is set.
+func (h *documentHandler) Content(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	doc, file, err := h.service.Content(ctx, id)
+	if err == ErrNotFound || err == ErrNoFile {
+		common.MakeError(w, http.StatusNotFound, "document", err.Error(), "content")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "document", "Server Error", "content")
+		return
+	}
+	defer file.Close()
+
+	contentType := FormatMIME(doc.Format)
+	if contentType == "" {
+		contentType = file.ContentType
+	}
+	disposition := "inline"
+	if download, _ := strconv.ParseBool(r.URL.Query().Get("download")); download {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": contentName(doc)}))
+	// the file is stored under its hash so the hash changes with the content
+	if doc.Hash != "" {
+		w.Header().Set("ETag", `"`+doc.Hash+`"`)
+	}
+	http.ServeContent(w, r, "", file.ModTime, file)
+}
+
+// contentName is the file name a download is saved as.
+func contentName(doc *Document) string {
+	name := doc.Name
+	if name == "" {
+		name = doc.DisplayName
+	}
+	if ext := "." + doc.Format; doc.Format != "" && !strings.HasSuffix(strings.ToLower(name), ext) {
+		name += ext
+	}
+	return name
+}
+
 func (h *documentHandler) UpdateFields(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -74,6 +157,14 @@ func (h *documentHandler) UpdateFields(w http.ResponseWriter, r *http.Request) {
 
 	entity, err := h.service.UpdateFields(ctx, id, req)
 
+	if err == ErrNotFound {
+		common.MakeError(w, http.StatusNotFound, "document", err.Error(), "updateFields")
+		return
+	}
+	if err == ErrInvalidRating {
+		common.MakeError(w, http.StatusBadRequest, "document", err.Error(), "updateFields")
+		return
+	}
 	if err != nil {
 		common.MakeError(w, http.StatusInternalServerError, "document", "Server Error", "updateFields")
 		return
@@ -82,6 +173,7 @@ func (h *documentHandler) UpdateFields(w http.ResponseWriter, r *http.Request) {
 	common.EncodeResponse(r.Context(), w, entity)
 }
 
+// Delete moves a document to the trash, with purge=true it is deleted for good straight away.
 func (h *documentHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
@@ -93,7 +185,26 @@ func (h *documentHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.Delete(ctx, id); err != nil {
+	purge := false
+	if v := r.URL.Query().Get("purge"); v != "" {
+		var err error
+		if purge, err = strconv.ParseBool(v); err != nil {
+			common.MakeError(w, http.StatusBadRequest, "document", fmt.Sprintf("invalid purge %q", v), "delete")
+			return
+		}
+	}
+
+	var err error
+	if purge {
+		err = h.service.Purge(ctx, id)
+	} else {
+		err = h.service.Delete(ctx, id)
+	}
+	if err == ErrNotFound {
+		common.MakeError(w, http.StatusNotFound, "document", err.Error(), "delete")
+		return
+	}
+	if err != nil {
 		common.MakeError(w, http.StatusInternalServerError, "document", "Server Error", "delete")
 		return
 	}
@@ -101,11 +212,42 @@ func (h *documentHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	common.EncodeResponse(r.Context(), w, map[string]string{"status": "success"})
 }
 
+func (h *documentHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	entity, err := h.service.Restore(ctx, id)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		common.MakeError(w, http.StatusNotFound, "document", err.Error(), "restore")
+		return
+	case ErrNotDeleted:
+		common.MakeError(w, http.StatusConflict, "document", err.Error(), "restore")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "document", "Server Error", "restore")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entity)
+}
+
 func (h *documentHandler) FindAll(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	entity, err := h.service.FindAll(ctx, nil)
+	opts, err := ParseListOptions(r)
+	if err != nil {
+		common.MakeError(w, http.StatusBadRequest, "document", err.Error(), "findall")
+		return
+	}
+
+	entity, err := h.service.FindPage(ctx, opts)
 
+	if err == ErrInvalidSort {
+		common.MakeError(w, http.StatusBadRequest, "document", err.Error(), "findall")
+		return
+	}
 	if err != nil {
 		common.MakeError(w, http.StatusInternalServerError, "document", "Server Error", "findall")
 		return
@@ -117,12 +259,145 @@ func (h *documentHandler) FindAll(w http.ResponseWriter, r *http.Request) {
 func (h *documentHandler) Scan(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	err := h.service.Scan(ctx)
+	opts := ScanOptions{}
+	for param, v := range map[string]*bool{"prune": &opts.Prune, "dry_run": &opts.DryRun} {
+		raw := r.URL.Query().Get(param)
+		if raw == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			common.MakeError(w, http.StatusBadRequest, "document", fmt.Sprintf("invalid %s %q", param, raw), "scan")
+			return
+		}
+		*v = b
+	}
+
+	scan, err := h.service.Scan(ctx, opts)
 
 	if err != nil {
 		common.MakeError(w, http.StatusInternalServerError, "document", "Server Error", "scan")
 		return
 	}
 
-	common.EncodeResponse(r.Context(), w, map[string]string{"status": "success"})
+	w.WriteHeader(http.StatusAccepted)
+	common.EncodeResponse(r.Context(), w, scan)
+}
+
+func (h *documentHandler) FindScan(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	scan, err := h.service.FindScan(ctx, id)
+	if err == ErrScanNotFound {
+		common.MakeError(w, http.StatusNotFound, "scan", err.Error(), "findbyid")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "scan", "Server Error", "findbyid")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, scan)
+}
+
+func (h *documentHandler) CancelScan(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	scan, err := h.service.CancelScan(ctx, id)
+	switch err {
+	case nil:
+	case ErrScanNotFound:
+		common.MakeError(w, http.StatusNotFound, "scan", err.Error(), "cancel")
+		return
+	case ErrScanFinished:
+		common.MakeError(w, http.StatusConflict, "scan", err.Error(), "cancel")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "scan", "Server Error", "cancel")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	common.EncodeResponse(r.Context(), w, scan)
+}
+
+// ParseListOptions reads paging, sorting and filters from the query string:
+// limit, offset, sort (display_name, created, updated), order (asc, desc),
+// type, format, tag, name (display name prefix), created_after and created_before (RFC3339 or YYYY-MM-DD).
+func ParseListOptions(r *http.Request) (ListOptions, error) {
+	q := r.URL.Query()
+	opts := ListOptions{
+		Filter: map[string]interface{}{},
+		Sort:   q.Get("sort"),
+	}
+
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if opts.Limit, err = strconv.Atoi(v); err != nil {
+			return opts, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if opts.Offset, err = strconv.Atoi(v); err != nil {
+			return opts, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, fmt.Errorf("invalid order %q", q.Get("order"))
+	}
+
+	if v := q.Get("type"); v != "" {
+		opts.Filter["type"] = v
+	}
+	if v := q.Get("format"); v != "" {
+		opts.Filter["format"] = v
+	}
+	if v := q.Get("series"); v != "" {
+		opts.Filter["series"] = v
+	}
+	if v := q.Get("tag"); v != "" {
+		opts.Filter[TagFilter] = v
+	}
+	if v := q.Get("name"); v != "" {
+		opts.Filter[NamePrefixFilter] = v
+	}
+	switch v := q.Get("trash"); v {
+	case "":
+	case TrashOnly, TrashIncluded:
+		opts.Filter[TrashFilter] = v
+	default:
+		return opts, fmt.Errorf("invalid trash %q", v)
+	}
+	if v := q.Get("missing"); v != "" {
+		missing, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid missing %q", v)
+		}
+		opts.Filter[MissingFilter] = missing
+	}
+	for param, filter := range map[string]string{"created_after": CreatedAfterFilter, "created_before": CreatedBeforeFilter} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		t, err := parseTime(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q", param, v)
+		}
+		opts.Filter[filter] = t
+	}
+	return opts, nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
 }
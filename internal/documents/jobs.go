@@ -0,0 +1,143 @@
+package documents
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/extract"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Background work queued for documents.
+const (
+	ExtractJob = "document.extract" // index the text of a document for search
+	CoverJob   = "document.cover"   // create the cover thumbnail
+	ScanJob    = "document.scan"    // run a tracked import of new files from the bucket
+	PurgeJob   = "document.purge"   // delete documents that have been in the trash past the retention
+)
+
+type documentJob struct {
+	DocumentID string `json:"document_id"`
+}
+
+// enqueueProcessing queues the work that follows adding a document and returns the job ids.
+func (s *documentService) enqueueProcessing(ctx context.Context, id string) []string {
+	return s.enqueue(ctx, id, ExtractJob, CoverJob)
+}
+
+// enqueue queues document jobs and returns the ids of those queued, the document is already
+// stored so failures are only logged.
+func (s *documentService) enqueue(ctx context.Context, id string, jobTypes ...string) []string {
+	ids := []string{}
+	for _, jobType := range jobTypes {
+		job, err := s.jobs.Enqueue(ctx, jobType, documentJob{DocumentID: id})
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"id": id, "type": jobType}).Error("unable to queue document processing")
+			continue
+		}
+		ids = append(ids, job.ID)
+	}
+	return ids
+}
+
+// jobDocument loads the document a job is for, nil when it has been deleted since.
+func (s *documentService) jobDocument(ctx context.Context, job *jobs.Job) (*Document, error) {
+	payload := documentJob{}
+	if err := job.Decode(&payload); err != nil {
+		return nil, errors.Wrap(err, "invalid job payload")
+	}
+	doc, err := s.repo.FindByID(ctx, payload.DocumentID)
+	if err == ErrNotFound {
+		logrus.WithField("id", payload.DocumentID).Info("document removed before job ran")
+		return nil, nil
+	}
+	return doc, err
+}
+
+// extractJob stores the text of the document for search, until it succeeds the document is
+// searchable by its metadata only.
+func (s *documentService) extractJob(ctx context.Context, job *jobs.Job) error {
+	doc, err := s.jobDocument(ctx, job)
+	if doc == nil || err != nil {
+		return err
+	}
+
+	file, err := s.readFile(ctx, doc.Path)
+	if err != nil {
+		return err
+	}
+	text, err := extract.Text(file, file.Size(), FormatMIME(doc.Format))
+	if err == extract.ErrUnsupported {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to extract text")
+	}
+	return s.repo.UpdateContent(ctx, doc.ID, text)
+}
+
+func (s *documentService) coverJob(ctx context.Context, job *jobs.Job) error {
+	doc, err := s.jobDocument(ctx, job)
+	if doc == nil || err != nil {
+		return err
+	}
+
+	err = s.covers.Generate(ctx, doc)
+	switch errors.Cause(err) {
+	case nil:
+		logrus.WithField("id", doc.ID).Info("cover created")
+	case extract.ErrNoCover, extract.ErrUnsupported:
+		// retrying won't find one
+		logrus.WithError(err).WithField("id", doc.ID).Info("document has no cover")
+		return nil
+	}
+	return err
+}
+
+// schedulePurge queues a purge of the trash at start and every purge interval until done is closed.
+func (s *documentService) schedulePurge(done <-chan struct{}) {
+	ticker := time.NewTicker(s.trash.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.jobs.Enqueue(common.SystemContext(context.Background()), PurgeJob, struct{}{}); err != nil {
+			logrus.WithError(err).Error("unable to queue trash purge")
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeJob deletes the documents that have been in the trash longer than the retention period,
+// a failed document doesn't stop the rest and the job is retried.
+func (s *documentService) purgeJob(ctx context.Context, job *jobs.Job) error {
+	ctx = common.SystemContext(ctx)
+	docs, err := s.repo.FindAll(ctx, map[string]interface{}{TrashFilter: TrashOnly})
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-s.trash.Retention)
+	purged, failed := 0, 0
+	for _, doc := range docs {
+		if doc.Deleted.After(cutoff) {
+			continue
+		}
+		if err := s.purge(ctx, doc); err != nil {
+			logrus.WithError(err).WithField("id", doc.ID).Error("unable to purge document")
+			failed++
+			continue
+		}
+		purged++
+	}
+	if purged > 0 || failed > 0 {
+		logrus.WithFields(logrus.Fields{"purged": purged, "failed": failed}).Info("trash purged")
+	}
+	if failed > 0 {
+		return errors.Errorf("unable to purge %d documents", failed)
+	}
+	return nil
+}
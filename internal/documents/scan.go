@@ -0,0 +1,521 @@
+package documents
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ScanStatus string
+
+const (
+	ScanPending   ScanStatus = "pending"
+	ScanRunning   ScanStatus = "running"
+	ScanCompleted ScanStatus = "completed"
+	ScanFailed    ScanStatus = "failed"
+	ScanCancelled ScanStatus = "cancelled"
+)
+
+// Changes a scan makes to the catalog, a dry run only reports them.
+const (
+	ScanImport  = "import"  // a new file was added as a document
+	ScanMove    = "move"    // a missing document was found under a new path
+	ScanFound   = "found"   // a missing document is back at its path
+	ScanMissing = "missing" // a document's file is no longer in the bucket
+	ScanPrune   = "prune"   // a document whose file is gone was removed
+)
+
+const (
+	// scanProgressInterval is how many files are processed between saving progress and
+	// checking for cancellation.
+	scanProgressInterval = 25
+	// maxScanErrors bounds the per file errors kept on a scan.
+	maxScanErrors = 100
+	// maxScanChanges bounds the changes kept in the report of a scan.
+	maxScanChanges = 1000
+)
+
+var (
+	ErrScanNotFound = errors.New("scan not found")
+	ErrScanFinished = errors.New("scan already finished")
+)
+
+// ScanOptions control how a scan reconciles the catalog with the bucket.
+type ScanOptions struct {
+	Prune  bool // remove documents whose files are gone instead of flagging them
+	DryRun bool // report the changes without making them
+}
+
+// Scan tracks a reconciliation of the catalog with the files in the bucket.
+type Scan struct {
+	ID              string       `json:"id"`
+	JobID           string       `json:"job_id"`
+	Status          ScanStatus   `json:"status"`
+	Prune           bool         `json:"prune"`
+	DryRun          bool         `json:"dry_run"`
+	Seen            int          `json:"seen"`
+	Imported        int          `json:"imported"`
+	Skipped         int          `json:"skipped"`
+	Failed          int          `json:"failed"`
+	Found           int          `json:"found"`
+	Moved           int          `json:"moved"`
+	Missing         int          `json:"missing"`
+	Pruned          int          `json:"pruned"`
+	Errors          []ScanError  `json:"errors"`
+	Changes         []ScanChange `json:"changes"`
+	Error           string       `json:"error"`
+	CancelRequested bool         `json:"cancel_requested"`
+	Created         time.Time    `json:"created"`
+	Started         *time.Time   `json:"started"`
+	Finished        *time.Time   `json:"finished"`
+	UserID          string       `json:"user_id"` // who started the scan, new files are added to their library
+}
+
+type ScanError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type ScanChange struct {
+	Action     string `json:"action"`
+	Path       string `json:"path"`
+	From       string `json:"from,omitempty"` // previous path of a moved document
+	DocumentID string `json:"document_id,omitempty"`
+}
+
+func (s *Scan) Done() bool {
+	return s.Status == ScanCompleted || s.Status == ScanFailed || s.Status == ScanCancelled
+}
+
+func (s *Scan) fail(path string, err error) {
+	s.Failed++
+	if len(s.Errors) < maxScanErrors {
+		s.Errors = append(s.Errors, ScanError{Path: path, Error: err.Error()})
+	}
+}
+
+func (s *Scan) change(change ScanChange) {
+	if len(s.Changes) < maxScanChanges {
+		s.Changes = append(s.Changes, change)
+	}
+}
+
+// ScanRepository methods are prefixed so a single database type can also implement the document repository.
+type ScanRepository interface {
+	InsertScan(ctx context.Context, scan *Scan) error
+	FindScanByID(ctx context.Context, id string) (*Scan, error)
+	// UpdateScan saves status and progress, it leaves the cancel flag alone.
+	UpdateScan(ctx context.Context, scan Scan) error
+	RequestScanCancel(ctx context.Context, id string) error
+}
+
+type scanJobPayload struct {
+	ScanID string `json:"scan_id"`
+}
+
+// Scan queues a reconciliation of the catalog with the files in the bucket.
+func (s *documentService) Scan(ctx context.Context, opts ScanOptions) (*Scan, error) {
+	scan := &Scan{
+		ID:      uuid.New().String(),
+		Status:  ScanPending,
+		Prune:   opts.Prune,
+		DryRun:  opts.DryRun,
+		Errors:  []ScanError{},
+		Changes: []ScanChange{},
+		Created: time.Now(),
+		UserID:  common.UserID(ctx),
+	}
+	if err := s.scans.InsertScan(ctx, scan); err != nil {
+		logrus.WithError(err).Error("unable to save scan")
+		return nil, errors.Wrap(err, "unable to save scan")
+	}
+
+	job, err := s.jobs.Enqueue(ctx, ScanJob, scanJobPayload{ScanID: scan.ID})
+	if err != nil {
+		return nil, err
+	}
+	scan.JobID = job.ID
+	if err := s.scans.UpdateScan(ctx, *scan); err != nil {
+		logrus.WithError(err).WithField("id", scan.ID).Error("unable to save scan job")
+		return nil, errors.Wrap(err, "unable to save scan")
+	}
+	return scan, nil
+}
+
+func (s *documentService) FindScan(ctx context.Context, id string) (*Scan, error) {
+	scan, err := s.scans.FindScanByID(ctx, id)
+	if err == ErrScanNotFound {
+		return nil, err
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to fetch scan from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return scan, nil
+}
+
+// CancelScan flags a scan to stop, the scan notices between batches of files.
+func (s *documentService) CancelScan(ctx context.Context, id string) (*Scan, error) {
+	scan, err := s.FindScan(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if scan.Done() {
+		return scan, ErrScanFinished
+	}
+	if err := s.scans.RequestScanCancel(ctx, id); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to cancel scan")
+		return nil, errors.Wrap(err, "unable to cancel scan")
+	}
+	scan.CancelRequested = true
+	return scan, nil
+}
+
+func (s *documentService) scanJob(ctx context.Context, job *jobs.Job) error {
+	// the bucket holds every library, files of other users must not look new
+	ctx = common.SystemContext(ctx)
+	payload := scanJobPayload{}
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(errors.Wrap(err, "invalid job payload"))
+	}
+	scan, err := s.scans.FindScanByID(ctx, payload.ScanID)
+	if err != nil {
+		return err
+	}
+	if scan.Done() {
+		return nil
+	}
+
+	// an interrupted scan starts over, files it already imported are skipped this time
+	now := time.Now()
+	scan.Status = ScanRunning
+	scan.Started = &now
+	scan.Seen, scan.Imported, scan.Skipped, scan.Failed = 0, 0, 0, 0
+	scan.Found, scan.Moved, scan.Missing, scan.Pruned = 0, 0, 0, 0
+	scan.Errors = []ScanError{}
+	scan.Changes = []ScanChange{}
+	if scan.CancelRequested {
+		scan.Status = ScanCancelled
+		scan.Finished = &now
+	}
+	if err := s.scans.UpdateScan(ctx, *scan); err != nil {
+		return err
+	}
+	if scan.Done() {
+		return nil
+	}
+
+	err = s.scan(ctx, scan)
+	finished := time.Now()
+	scan.Finished = &finished
+	switch {
+	case err == context.Canceled && scan.CancelRequested:
+		scan.Status = ScanCancelled
+		err = nil
+	case ctx.Err() != nil:
+		// shutting down, the job is picked up again on the next start
+		scan.Status = ScanPending
+		scan.Finished = nil
+		if uerr := s.scans.UpdateScan(context.Background(), *scan); uerr != nil {
+			logrus.WithError(uerr).WithField("id", scan.ID).Error("unable to save scan")
+		}
+		return ctx.Err()
+	case err != nil:
+		scan.Status = ScanFailed
+		scan.Error = err.Error()
+	default:
+		scan.Status = ScanCompleted
+	}
+	// the job context is cancelled on shutdown, the outcome still needs saving
+	if uerr := s.scans.UpdateScan(context.Background(), *scan); uerr != nil {
+		logrus.WithError(uerr).WithField("id", scan.ID).Error("unable to save scan")
+	}
+	logrus.WithFields(logrus.Fields{
+		"id":       scan.ID,
+		"status":   scan.Status,
+		"dry_run":  scan.DryRun,
+		"seen":     scan.Seen,
+		"imported": scan.Imported,
+		"skipped":  scan.Skipped,
+		"failed":   scan.Failed,
+		"found":    scan.Found,
+		"moved":    scan.Moved,
+		"missing":  scan.Missing,
+		"pruned":   scan.Pruned,
+	}).Info("scan finished")
+	if err != nil {
+		// a scan is restarted by hand rather than retried
+		return jobs.Permanent(err)
+	}
+	return nil
+}
+
+// scan reconciles the catalog with the bucket. The whole bucket is listed before anything
+// is removed or flagged so a new path can be matched to a document whose file went missing,
+// files that match nothing are imported and documents left unmatched are flagged or pruned.
+func (s *documentService) scan(ctx context.Context, scan *Scan) error {
+	docs, err := s.repo.FindAll(ctx, map[string]interface{}{TrashFilter: TrashIncluded})
+	if err != nil {
+		return errors.Wrap(err, "unable to fetch documents")
+	}
+	byPath := make(map[string]*Document, len(docs))
+	for _, doc := range docs {
+		byPath[doc.Path] = doc
+	}
+
+	processed := 0
+	checkpoint := func() error {
+		processed++
+		if processed%scanProgressInterval != 0 {
+			return ctx.Err()
+		}
+		if err := s.scans.UpdateScan(ctx, *scan); err != nil {
+			logrus.WithError(err).WithField("id", scan.ID).Warn("unable to save scan progress")
+		}
+		if current, err := s.scans.FindScanByID(ctx, scan.ID); err == nil && current.CancelRequested {
+			scan.CancelRequested = true
+			return context.Canceled
+		}
+		return ctx.Err()
+	}
+
+	listed := make(map[string]bool)
+	var added []string
+	err = s.storage.List(ctx, func(path string) error {
+		if strings.HasPrefix(path, coverPrefix) || strings.HasPrefix(path, uploadPrefix) || strings.HasPrefix(path, common.BackupPrefix) {
+			return nil
+		}
+		scan.Seen++
+		listed[path] = true
+		if doc, ok := byPath[path]; ok {
+			s.scanExisting(ctx, scan, doc)
+		} else if _, ok := formatFromExt(filepath.Ext(path)); ok {
+			added = append(added, path)
+		} else {
+			scan.Skipped++
+		}
+		return checkpoint()
+	})
+	if err == context.Canceled || ctx.Err() != nil {
+		return context.Canceled
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to list bucket")
+	}
+
+	missing := newMissingDocuments()
+	for _, doc := range docs {
+		// files of deleted documents are skipped above but a deleted document isn't looked for
+		if !listed[doc.Path] && doc.Deleted == nil && !doc.IsPlaceholder() {
+			missing.add(doc)
+		}
+	}
+	for _, path := range added {
+		s.scanFile(ctx, scan, path, missing)
+		if err := checkpoint(); err != nil {
+			return err
+		}
+	}
+	for _, doc := range missing.remaining() {
+		s.scanMissing(ctx, scan, doc)
+	}
+	return nil
+}
+
+// scanExisting clears the missing flag of a document whose file is back and records the
+// hash of files stored before hashes were kept, so later moves can be matched.
+func (s *documentService) scanExisting(ctx context.Context, scan *Scan, doc *Document) {
+	if doc.Missing == nil && doc.Hash != "" {
+		scan.Skipped++
+		return
+	}
+	if doc.Missing != nil {
+		scan.Found++
+		scan.change(ScanChange{Action: ScanFound, Path: doc.Path, DocumentID: doc.ID})
+	} else {
+		scan.Skipped++
+	}
+	if scan.DryRun {
+		return
+	}
+
+	updated := *doc
+	updated.Missing = nil
+	if doc.Hash == "" {
+		hash, size, err := s.hashFile(ctx, doc.Path)
+		if err != nil {
+			scan.fail(doc.Path, err)
+			return
+		}
+		updated.Hash, updated.Size = hash, size
+	}
+	if err := s.repo.UpdateFile(ctx, updated); err != nil {
+		scan.fail(doc.Path, err)
+	}
+}
+
+// scanFile imports a file that isn't in the catalog, unless it is the file of a missing
+// document under a new path.
+func (s *documentService) scanFile(ctx context.Context, scan *Scan, path string, missing *missingDocuments) {
+	ext := filepath.Ext(path)
+	format, _ := formatFromExt(ext)
+	hash, size, err := s.hashFile(ctx, path)
+	if err != nil {
+		scan.fail(path, err)
+		return
+	}
+
+	if doc := missing.match(hash, size, format); doc != nil {
+		scan.Moved++
+		scan.change(ScanChange{Action: ScanMove, Path: path, From: doc.Path, DocumentID: doc.ID})
+		if scan.DryRun {
+			return
+		}
+		moved := *doc
+		moved.Path = path
+		moved.Hash = hash
+		moved.Size = size
+		moved.Missing = nil
+		if err := s.repo.UpdateFile(ctx, moved); err != nil {
+			scan.fail(path, err)
+		}
+		return
+	}
+
+	doc := &Document{
+		ID:      uuid.New().String(),
+		Name:    strings.TrimSuffix(filepath.Base(path), ext),
+		Path:    path,
+		Type:    "book",
+		Format:  format,
+		UserID:  scan.UserID,
+		Size:    size,
+		Hash:    hash,
+		Created: time.Now(),
+	}
+	// only a new document is loaded, the extractors need random access to read its metadata
+	file, err := s.readFile(ctx, path)
+	if err != nil {
+		scan.fail(path, err)
+		return
+	}
+	if detected, ok := detectFormat(file, size); ok {
+		doc.Format = detected
+	}
+	applyMetadata(doc, file, size)
+	if doc.DisplayName == "" {
+		doc.DisplayName = doc.Name
+	}
+	scan.Imported++
+	scan.change(ScanChange{Action: ScanImport, Path: path, DocumentID: doc.ID})
+	if scan.DryRun {
+		return
+	}
+	if err := s.repo.Insert(ctx, doc); err != nil {
+		scan.Imported--
+		scan.fail(path, err)
+		return
+	}
+	s.enqueueProcessing(ctx, doc.ID)
+}
+
+// scanMissing flags or prunes a document whose file wasn't found anywhere in the bucket.
+func (s *documentService) scanMissing(ctx context.Context, scan *Scan, doc *Document) {
+	if scan.Prune {
+		scan.Pruned++
+		scan.change(ScanChange{Action: ScanPrune, Path: doc.Path, DocumentID: doc.ID})
+		if scan.DryRun {
+			return
+		}
+		// purged like the trash is so the cover goes too
+		if err := s.purge(ctx, doc); err != nil {
+			scan.Pruned--
+			scan.fail(doc.Path, err)
+		}
+		return
+	}
+
+	scan.Missing++
+	if doc.Missing != nil {
+		// flagged by an earlier scan
+		return
+	}
+	scan.change(ScanChange{Action: ScanMissing, Path: doc.Path, DocumentID: doc.ID})
+	if scan.DryRun {
+		return
+	}
+	now := time.Now()
+	flagged := *doc
+	flagged.Missing = &now
+	if err := s.repo.UpdateFile(ctx, flagged); err != nil {
+		scan.fail(doc.Path, err)
+	}
+}
+
+// missingDocuments indexes the documents whose files weren't listed so new paths can be
+// matched to them. Documents with a hash only match by hash, older ones without a hash
+// fall back to the size and format and only when that picks out a single document.
+type missingDocuments struct {
+	docs   map[string]*Document
+	byHash map[string][]*Document
+	bySize map[int64][]*Document
+}
+
+func newMissingDocuments() *missingDocuments {
+	return &missingDocuments{
+		docs:   make(map[string]*Document),
+		byHash: make(map[string][]*Document),
+		bySize: make(map[int64][]*Document),
+	}
+}
+
+func (m *missingDocuments) add(doc *Document) {
+	m.docs[doc.ID] = doc
+	switch {
+	case doc.Hash != "":
+		m.byHash[doc.Hash] = append(m.byHash[doc.Hash], doc)
+	case doc.Size > 0:
+		m.bySize[doc.Size] = append(m.bySize[doc.Size], doc)
+	}
+}
+
+// match claims the missing document stored with the given content, nil if there is none.
+func (m *missingDocuments) match(hash string, size int64, format string) *Document {
+	for _, doc := range m.byHash[hash] {
+		if m.docs[doc.ID] != nil {
+			delete(m.docs, doc.ID)
+			return doc
+		}
+	}
+	var found *Document
+	for _, doc := range m.bySize[size] {
+		if m.docs[doc.ID] == nil || doc.Format != format {
+			continue
+		}
+		if found != nil {
+			// ambiguous, leave both to be flagged
+			return nil
+		}
+		found = doc
+	}
+	if found != nil {
+		delete(m.docs, found.ID)
+	}
+	return found
+}
+
+func (m *missingDocuments) remaining() []*Document {
+	docs := make([]*Document, 0, len(m.docs))
+	for _, doc := range m.docs {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Path < docs[j].Path })
+	return docs
+}
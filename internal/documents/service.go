@@ -1,67 +1,219 @@
 package documents
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
-	"github.com/go-resty/resty/v2"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/google/uuid"
-	"github.com/h2non/filetype"
-	"github.com/h2non/filetype/matchers"
 	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/extract"
+	"github.com/holmes89/book-organizer/internal/jobs"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"gocloud.dev/gcerrors"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
-	"net/http"
-	"path/filepath"
 	"strings"
 	"time"
 )
 
+// Filters that are not plain column equality checks.
+const (
+	TagFilter           = "tag"            // documents tagged with the given tag id
+	NamePrefixFilter    = "name_prefix"    // display names starting with the value, case insensitive
+	CreatedAfterFilter  = "created_after"  // created at or after the time
+	CreatedBeforeFilter = "created_before" // created before the time
+	MissingFilter       = "missing"        // whether the stored file has vanished from the bucket
+	TrashFilter         = "trash"          // TrashOnly or TrashIncluded, deleted documents are left out without it
+)
+
+const (
+	TrashOnly     = "only"
+	TrashIncluded = "include"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// MaxRating is the top of the rating scale, ratings are stars out of five and may be halves.
+const MaxRating = 5
+
+// SortFields are the keys documents can be ordered by.
+var SortFields = map[string]bool{"display_name": true, "created": true, "updated": true}
+
 var (
 	ErrInvalidFileType = errors.New("invalid file type")
+	ErrNotFound        = errors.New("document not found")
+	ErrInvalidSort     = errors.New("invalid sort field")
+	ErrCoverNotFound   = errors.New("cover not found")
+	ErrNotDeleted      = errors.New("document is not in the trash")
+	ErrInvalidRating   = errors.New("rating must be between 0 and 5")
+	ErrMissingTitle    = errors.New("title required")
+	ErrNoFile          = errors.New("document has no file")
 )
 
+// DuplicateError is returned when an upload has the same content as a document in the catalog.
+type DuplicateError struct {
+	Existing *Document
+}
+
+func (e *DuplicateError) Error() string {
+	return "document already exists"
+}
+
 type Document struct {
 	ID          string     `json:"id"`
 	DisplayName string     `json:"display_name"`
 	Name        string     `json:"name"`
-	Path        string     `json:"path"`
+	Path        string     `json:"path"` // empty for placeholders, which have no file
 	Type        string     `json:"type"`
 	Description string     `json:"description"`
+	Title       string     `json:"title"`
+	Authors     []string   `json:"authors"`
+	Publisher   string     `json:"publisher"`
+	Language    string     `json:"language"`
+	ISBN        string     `json:"isbn"`
+	Series      string     `json:"series"`
+	SeriesIndex float64    `json:"series_index"` // position in the series, fractional for novellas between volumes
+	Rating      float64    `json:"rating"`       // out of MaxRating, zero when unrated
+	Review      string     `json:"review"`
+	Format      string     `json:"format"`
+	PageCount   int        `json:"page_count"`
+	Size        int64      `json:"size"`
+	Hash        string     `json:"hash"`          // hex SHA-256 of the file
+	Missing     *time.Time `json:"missing_since"` // set while a scan can't find the file
+	Deleted     *time.Time `json:"deleted"`       // set while the document is in the trash
 	Tags        []string   `json:"tag_ids"`
 	Created     time.Time  `json:"created"`
 	Updated     *time.Time `json:"updated"`
+	UserID      string     `json:"user_id"`        // owner, documents are only visible to their owner
+	Jobs        []string   `json:"jobs,omitempty"` // ids of the processing queued when the document was added, not stored
+}
+
+// IsPlaceholder reports whether the document stands in for a book without a file, such as one
+// on a wishlist.
+func (d *Document) IsPlaceholder() bool {
+	return d.Path == ""
+}
+
+// ListOptions filters, orders and pages a document listing.
+type ListOptions struct {
+	Filter     map[string]interface{}
+	Sort       string
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+type DocumentPage struct {
+	Items  []*Document `json:"items"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
 }
 
 type DocumentService interface {
 	FindAll(ctx context.Context, filter map[string]interface{}) ([]*Document, error)
+	FindPage(ctx context.Context, opts ListOptions) (*DocumentPage, error)
 	FindByID(ctx context.Context, id string) (*Document, error)
 	Add(ctx context.Context, file multipart.File, document *Document) error
+	Import(ctx context.Context, file multipart.File, document *Document, cover io.Reader) error
+	AddPlaceholder(ctx context.Context, document *Document) error
 	Delete(ctx context.Context, id string) error
-	Scan(ctx context.Context) error
+	Restore(ctx context.Context, id string) (*Document, error)
+	Purge(ctx context.Context, id string) error
+	Scan(ctx context.Context, opts ScanOptions) (*Scan, error)
+	FindScan(ctx context.Context, id string) (*Scan, error)
+	CancelScan(ctx context.Context, id string) (*Scan, error)
 	UpdateFields(ctx context.Context, id string, docs Document) (Document, error)
+	Cover(ctx context.Context, id string) (io.ReadCloser, error)
+	Content(ctx context.Context, id string) (*Document, *common.Object, error)
 }
 
 type DocumentRepository interface {
 	FindAll(ctx context.Context, filter map[string]interface{}) ([]*Document, error)
+	FindPage(ctx context.Context, opts ListOptions) (*DocumentPage, error)
 	FindByID(ctx context.Context, id string) (*Document, error)
 	Insert(ctx context.Context, document *Document) error
+	// Delete removes a document along with its tag links and search entry.
 	Delete(ctx context.Context, id string) error
+	// UpdateDeleted moves a document into the trash, or out of it when deleted is nil.
+	UpdateDeleted(ctx context.Context, id string, deleted *time.Time) error
 	UpdateDocument(ctx context.Context, document Document) (Document, error)
-	UpsertStream(ctx context.Context, input <-chan *Document) error
+	// UpdateFile saves the path, size, hash and missing flag of the stored file.
+	UpdateFile(ctx context.Context, document Document) error
+	UpdateContent(ctx context.Context, id string, content string) error
+}
+
+// CoverGenerator creates the cover thumbnail of a document and stores it at CoverPath.
+type CoverGenerator interface {
+	Generate(ctx context.Context, doc *Document) error
+}
+
+// coverPrefix keeps covers apart from documents in the bucket.
+const coverPrefix = "covers/"
+
+// contentPrefix keeps uploads, which are stored by their hash, apart from files added to the bucket directly.
+const contentPrefix = "library/"
+
+// uploadPrefix holds files while they are uploaded, before their hash is known.
+const uploadPrefix = "uploads/"
+
+// ContentPath is where an upload is stored, identical files share a key so they are only stored once.
+func ContentPath(hash string, format string) string {
+	return contentPrefix + hash[:2] + "/" + hash + "." + format
+}
+
+// ContentURL is where the file of a document is streamed from by this server.
+func ContentURL(id string) string {
+	return "/documents/" + id + "/content"
+}
+
+// CoverPath is where the cover of a document is kept in storage.
+func CoverPath(id string) string {
+	return coverPrefix + id + ".jpg"
 }
 
 type documentService struct {
 	storage common.DocumentStorage
 	repo    DocumentRepository
+	scans   ScanRepository
+	covers  CoverGenerator
+	jobs    jobs.JobService
+	trash   common.TrashConfig
 }
 
-func NewDocumentService(storage common.DocumentStorage, repo DocumentRepository) DocumentService {
-	return &documentService{
+func NewDocumentService(lc fx.Lifecycle, storage common.DocumentStorage, repo DocumentRepository, scans ScanRepository, covers CoverGenerator, jobService jobs.JobService, trash common.TrashConfig) DocumentService {
+	s := &documentService{
 		storage: storage,
 		repo:    repo,
+		scans:   scans,
+		covers:  covers,
+		jobs:    jobService,
+		trash:   trash,
 	}
+	jobService.Register(ExtractJob, s.extractJob)
+	jobService.Register(CoverJob, s.coverJob)
+	jobService.Register(ScanJob, s.scanJob)
+	jobService.Register(PurgeJob, s.purgeJob)
+
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go s.schedulePurge(done)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			close(done)
+			return nil
+		},
+	})
+	return s
 }
 
 func (s *documentService) FindAll(ctx context.Context, filter map[string]interface{}) ([]*Document, error) {
@@ -73,130 +225,372 @@ func (s *documentService) FindAll(ctx context.Context, filter map[string]interfa
 	return entities, nil
 }
 
+func (s *documentService) FindPage(ctx context.Context, opts ListOptions) (*DocumentPage, error) {
+	if opts.Sort == "" {
+		opts.Sort = "display_name"
+	}
+	if !SortFields[opts.Sort] {
+		return nil, ErrInvalidSort
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultPageSize
+	}
+	if opts.Limit > MaxPageSize {
+		opts.Limit = MaxPageSize
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+
+	page, err := s.repo.FindPage(ctx, opts)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch document page from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return page, nil
+}
+
 func (s *documentService) FindByID(ctx context.Context, id string) (*Document, error) {
 	entity, err := s.repo.FindByID(ctx, id)
+	if err == ErrNotFound {
+		return nil, err
+	}
 	if err != nil {
 		logrus.WithError(err).WithField("id", id).Error("unable to fetch doc from repository")
 		return nil, errors.Wrap(err, "unable to fetch from repository")
 	}
 
-	filePath, err := s.storage.Get(ctx, entity.Path)
-	if err != nil {
-		logrus.WithError(err).WithField("id", id).Error("unable to get path from storage")
-		return nil, errors.Wrap(err, "unable to get path from storage")
+	if entity.IsPlaceholder() {
+		return entity, nil
 	}
-	entity.Path = filePath
+	// files are always streamed through the server so access is checked on every read, signed
+	// urls would hand out the file to anyone holding the link
+	entity.Path = ContentURL(entity.ID)
 	return entity, nil
 }
 
+// Add stores an upload under a key derived from its content, an upload matching a document
+// already in the catalog is rejected with a DuplicateError unless that document's file has
+// gone missing, in which case the upload takes its place.
 func (s *documentService) Add(ctx context.Context, file multipart.File, doc *Document) error {
-	if !isSupported(file) {
+	return s.add(ctx, file, doc, nil)
+}
+
+// Import adds a document catalogued elsewhere, the metadata already set on it wins over what is
+// embedded in the file and the cover, when there is one, is stored instead of generating one.
+func (s *documentService) Import(ctx context.Context, file multipart.File, doc *Document, cover io.Reader) error {
+	return s.add(ctx, file, doc, cover)
+}
+
+func (s *documentService) add(ctx context.Context, file multipart.File, doc *Document, cover io.Reader) error {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		logrus.WithError(err).Error("unable to determine file size")
+		return errors.Wrap(err, "unable to determine file size")
+	}
+	file.Seek(0, io.SeekStart)
+
+	format, ok := detectFormat(file, size)
+	if !ok {
 		return ErrInvalidFileType
 	}
-	path, err := s.storage.Save(ctx, doc.Name, file)
+	doc.Format = format
+
+	// the file is hashed while it is uploaded, its key depends on the hash so it is moved there
+	// once it is known not to be a duplicate
+	file.Seek(0, io.SeekStart)
+	hash := sha256.New()
+	upload := uploadPrefix + uuid.New().String()
+	if _, err := s.storage.Save(ctx, upload, io.TeeReader(file, hash)); err != nil {
+		logrus.WithError(err).Error("unable to write to storage")
+		return errors.Wrap(err, "failed to write to storage")
+	}
+	doc.Hash, doc.Size = hex.EncodeToString(hash.Sum(nil)), size
+
+	// documents in the trash aren't duplicates, the new one shares their file until they are purged
+	existing, err := s.repo.FindAll(ctx, map[string]interface{}{"hash": doc.Hash})
 	if err != nil {
+		s.storage.Delete(ctx, upload)
+		logrus.WithError(err).Error("unable to check for duplicates")
+		return errors.Wrap(err, "unable to check for duplicates")
+	}
+	var missing *Document
+	for _, e := range existing {
+		if e.Missing == nil {
+			s.storage.Delete(ctx, upload)
+			return &DuplicateError{Existing: e}
+		}
+		missing = e
+	}
+
+	doc.Path = ContentPath(doc.Hash, doc.Format)
+	if err := s.storage.Move(ctx, upload, doc.Path); err != nil {
+		s.storage.Delete(ctx, upload)
 		logrus.WithError(err).Error("unable to write to storage")
 		return errors.Wrap(err, "failed to write to storage")
 	}
 
+	if missing != nil {
+		return s.reattach(ctx, missing, doc)
+	}
+
+	applyMetadata(doc, file, size)
 	doc.ID = uuid.New().String()
-	doc.Path = path
+	doc.UserID = common.UserID(ctx)
 	t := time.Now()
 	doc.Created = t
 	doc.Updated = &t
 
 	if err := s.repo.Insert(ctx, doc); err != nil {
 		logrus.WithError(err).Error("unable to save to repo")
+		s.discard(ctx, doc.Path)
 		return errors.Wrap(err, "failed to store data in repo")
 	}
 
-	go s.CreateCover(doc.ID, doc.Path)
+	if cover == nil {
+		doc.Jobs = s.enqueueProcessing(ctx, doc.ID)
+		return nil
+	}
+	if _, err := s.storage.Save(ctx, CoverPath(doc.ID), cover); err != nil {
+		// the document is stored, generate a cover instead
+		logrus.WithError(err).WithField("id", doc.ID).Warn("unable to save cover")
+		doc.Jobs = s.enqueueProcessing(ctx, doc.ID)
+		return nil
+	}
+	doc.Jobs = s.enqueue(ctx, doc.ID, ExtractJob)
 	return nil
 }
 
-func (s *documentService) CreateCover(id, path string) {
-	url := common.GetEnv("COVER_ENDPOINT", "")
-	if url == "" {
-		logrus.Panic("cover endpoint not set")
+// discard deletes a stored file that didn't make it into the repository unless another document,
+// possibly of another user, already holds the same content.
+func (s *documentService) discard(ctx context.Context, path string) {
+	shared, err := s.repo.FindAll(common.SystemContext(ctx), map[string]interface{}{"path": path, TrashFilter: TrashIncluded})
+	if err != nil {
+		logrus.WithError(err).WithField("path", path).Warn("unable to check for shared files, leaving file in storage")
+		return
+	}
+	if len(shared) > 0 {
+		return
+	}
+	if err := s.storage.Delete(ctx, path); err != nil {
+		logrus.WithError(err).WithField("path", path).Warn("unable to delete file")
 	}
+}
 
-	if !strings.Contains(url, "http") {
-		url = "https" + url
+// AddPlaceholder adds a document that has only metadata, a book that is uploaded later becomes
+// a document of its own.
+func (s *documentService) AddPlaceholder(ctx context.Context, doc *Document) error {
+	doc.Title = strings.TrimSpace(doc.Title)
+	if doc.Title == "" {
+		return ErrMissingTitle
 	}
-	url = url + "/thumbnail/"
-	client := resty.New()
-	client.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	if doc.DisplayName == "" {
+		doc.DisplayName = doc.Title
+	}
+	doc.Path, doc.Format, doc.Size, doc.Hash = "", "", 0, ""
+	doc.ID = uuid.New().String()
+	doc.UserID = common.UserID(ctx)
+	t := time.Now()
+	doc.Created = t
+	doc.Updated = &t
 
-	logrus.Infof("calling %s", url)
-	resp, err := client.
-		R().
-		SetBody(coverRequest{ID: id, Path: path}).
-		Post(url)
+	if err := s.repo.Insert(ctx, doc); err != nil {
+		logrus.WithError(err).Error("unable to save to repo")
+		return errors.Wrap(err, "failed to store data in repo")
+	}
+	return nil
+}
 
+// reattach points a document whose file went missing at a new upload of the same content.
+func (s *documentService) reattach(ctx context.Context, missing *Document, doc *Document) error {
+	missing.Path = doc.Path
+	missing.Size = doc.Size
+	missing.Hash = doc.Hash
+	missing.Missing = nil
+	if err := s.repo.UpdateFile(ctx, *missing); err != nil {
+		logrus.WithError(err).WithField("id", missing.ID).Error("unable to save to repo")
+		return errors.Wrap(err, "failed to store data in repo")
+	}
+	logrus.WithField("id", missing.ID).Info("missing document restored by upload")
+	*doc = *missing
+	return nil
+}
+
+// applyMetadata fills in the bibliographic fields embedded in the file that aren't already set,
+// a display name the client didn't set falls back to the title.
+func applyMetadata(doc *Document, file io.ReaderAt, size int64) {
+	meta, err := extract.ReadMetadata(file, size, formatMIME[doc.Format])
+	if err == extract.ErrUnsupported {
+		err = nil
+	}
 	if err != nil {
-		logrus.WithError(err).Error("unable to create cover")
+		logrus.WithError(err).WithField("name", doc.Name).Warn("unable to read metadata")
 		return
 	}
-	if err := resp.Error(); err != nil {
-		logrus.WithField("err", err).Error("unable to create cover")
-		return
+	if doc.Title == "" {
+		doc.Title = meta.Title
 	}
-
-	if resp.StatusCode() != http.StatusCreated {
-		logrus.WithField("code", resp.StatusCode()).Error("request failed")
-		return
+	if len(doc.Authors) == 0 {
+		doc.Authors = meta.Authors
+	}
+	if doc.Publisher == "" {
+		doc.Publisher = meta.Publisher
+	}
+	if doc.Language == "" {
+		doc.Language = meta.Language
+	}
+	if doc.ISBN == "" {
+		doc.ISBN = meta.ISBN
 	}
+	if doc.PageCount == 0 {
+		doc.PageCount = meta.PageCount
+	}
+	if doc.DisplayName == "" {
+		doc.DisplayName = doc.Title
+	}
+	if doc.DisplayName == "" {
+		doc.DisplayName = doc.Name
+	}
+}
 
-	logrus.Info("cover created")
+func (s *documentService) Cover(ctx context.Context, id string) (io.ReadCloser, error) {
+	if _, err := s.repo.FindByID(ctx, id); err != nil {
+		return nil, err
+	}
+	r, err := s.storage.Reader(ctx, CoverPath(id))
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Debug("unable to open cover")
+		return nil, ErrCoverNotFound
+	}
+	return r, nil
 }
 
-type coverRequest struct {
-	ID   string `json:"id"`
-	Path string `json:"path"`
+// Content opens the file of a document for streaming, placeholders and documents whose file has
+// gone missing have none.
+func (s *documentService) Content(ctx context.Context, id string) (*Document, *common.Object, error) {
+	doc, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.IsPlaceholder() {
+		return nil, nil, ErrNoFile
+	}
+	file, err := s.storage.Open(ctx, doc.Path)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, nil, ErrNoFile
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to open file")
+		return nil, nil, errors.Wrap(err, "unable to open file")
+	}
+	return doc, file, nil
 }
 
+// Delete moves a document to the trash, it can be restored until the trash is purged.
 func (s *documentService) Delete(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
-}
-
-func (s *documentService) Scan(ctx context.Context) error {
-	fileNameStream := s.storage.List(ctx)
-	docStream := make(chan *Document)
-	go func() {
-		defer close(docStream)
-		for path := range fileNameStream {
-			ext := filepath.Ext(path)
-			if ext != ".pdf" {
-				continue
-			}
-			name := strings.ReplaceAll(path, ext, "")
-			name = strings.ReplaceAll(name, filepath.Dir(path), "")
-			if name[0] == '/' {
-				name = name[1:]
-			}
-			doc := &Document{
-				ID:          uuid.New().String(),
-				DisplayName: name,
-				Name:        name,
-				Path:        path,
-				Type:        "book",
-				Created:     time.Now(),
+	doc, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if doc.Deleted != nil {
+		return nil
+	}
+	now := time.Now()
+	if err := s.repo.UpdateDeleted(ctx, id, &now); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to move document to trash")
+		return errors.Wrap(err, "unable to move document to trash")
+	}
+	return nil
+}
+
+func (s *documentService) Restore(ctx context.Context, id string) (*Document, error) {
+	doc, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Deleted == nil {
+		return doc, ErrNotDeleted
+	}
+	if err := s.repo.UpdateDeleted(ctx, id, nil); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to restore document")
+		return nil, errors.Wrap(err, "unable to restore document")
+	}
+	doc.Deleted = nil
+	return doc, nil
+}
+
+// Purge deletes a document for good, whether or not it is in the trash.
+func (s *documentService) Purge(ctx context.Context, id string) error {
+	doc, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.purge(ctx, doc)
+}
+
+// purge removes the stored file and cover before the document so a failure leaves the document
+// in place to be purged again, storage ignores files that are already gone.
+func (s *documentService) purge(ctx context.Context, doc *Document) error {
+	if !doc.IsPlaceholder() {
+		// uploads are stored by hash so other users may have the same file
+		shared, err := s.repo.FindAll(common.SystemContext(ctx), map[string]interface{}{"path": doc.Path, TrashFilter: TrashIncluded})
+		if err != nil {
+			return errors.Wrap(err, "unable to check for shared files")
+		}
+		if len(shared) <= 1 {
+			if err := s.storage.Delete(ctx, doc.Path); err != nil {
+				return err
 			}
-			docStream <- doc
 		}
-	}()
-	return s.repo.UpsertStream(ctx, docStream)
+	}
+	if err := s.storage.Delete(ctx, CoverPath(doc.ID)); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, doc.ID); err != nil {
+		logrus.WithError(err).WithField("id", doc.ID).Error("unable to delete document")
+		return errors.Wrap(err, "unable to delete document")
+	}
+	logrus.WithField("id", doc.ID).Info("document purged")
+	return nil
 }
 
-func (s *documentService) UpdateFields(ctx context.Context, id string, updatedDoc Document) (doc Document, err error) {
-	entity, err := s.repo.FindByID(ctx, id)
+// readFile loads a stored file into memory since the extractors need random access.
+func (s *documentService) readFile(ctx context.Context, path string) (*bytes.Reader, error) {
+	r, err := s.storage.Reader(ctx, path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open file")
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
 	if err != nil {
-		logrus.WithError(err).Error("unable to find entity")
-		return doc, errors.New("unable to find entity")
+		return nil, errors.Wrap(err, "unable to read file")
 	}
+	return bytes.NewReader(b), nil
+}
 
-	if entity == nil {
-		return doc, errors.New("entity does not exist")
+// hashFile streams a stored file through SHA-256 and returns the hex hash and its length.
+func (s *documentService) hashFile(ctx context.Context, path string) (string, int64, error) {
+	r, err := s.storage.Reader(ctx, path)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "unable to open file")
+	}
+	defer r.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "unable to read file")
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func (s *documentService) UpdateFields(ctx context.Context, id string, updatedDoc Document) (doc Document, err error) {
+	entity, err := s.repo.FindByID(ctx, id)
+	if err == ErrNotFound {
+		return doc, err
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to fetch doc from repository")
+		return doc, errors.Wrap(err, "unable to fetch from repository")
 	}
 
 	if updatedDoc.Description != "" {
@@ -205,6 +599,39 @@ func (s *documentService) UpdateFields(ctx context.Context, id string, updatedDo
 	if updatedDoc.DisplayName != "" {
 		entity.DisplayName = updatedDoc.DisplayName
 	}
+	if updatedDoc.Title != "" {
+		entity.Title = updatedDoc.Title
+	}
+	if len(updatedDoc.Authors) > 0 {
+		entity.Authors = updatedDoc.Authors
+	}
+	if updatedDoc.Publisher != "" {
+		entity.Publisher = updatedDoc.Publisher
+	}
+	if updatedDoc.Language != "" {
+		entity.Language = updatedDoc.Language
+	}
+	if updatedDoc.ISBN != "" {
+		entity.ISBN = updatedDoc.ISBN
+	}
+	if updatedDoc.PageCount > 0 {
+		entity.PageCount = updatedDoc.PageCount
+	}
+	if updatedDoc.Series != "" {
+		entity.Series = updatedDoc.Series
+	}
+	if updatedDoc.SeriesIndex > 0 {
+		entity.SeriesIndex = updatedDoc.SeriesIndex
+	}
+	if updatedDoc.Review != "" {
+		entity.Review = updatedDoc.Review
+	}
+	if updatedDoc.Rating != 0 {
+		if updatedDoc.Rating < 0 || updatedDoc.Rating > MaxRating {
+			return doc, ErrInvalidRating
+		}
+		entity.Rating = updatedDoc.Rating
+	}
 	if updatedDoc.Type != "" {
 		if updatedDoc.Type == "book" || updatedDoc.Type == "paper" {
 			entity.Type = updatedDoc.Type
@@ -216,27 +643,3 @@ func (s *documentService) UpdateFields(ctx context.Context, id string, updatedDo
 	return s.repo.UpdateDocument(ctx, *entity)
 
 }
-
-func isSupported(file multipart.File) bool {
-	head := make([]byte, 261)
-	if bytesRead, err := io.ReadFull(file, head); err == io.EOF {
-		logrus.WithField("bytesRead", bytesRead).WithError(err).Error("couldn't read file header: unexpected EOF")
-		return false
-	} else if err != nil {
-		logrus.WithField("bytesRead", bytesRead).WithError(err).Error("couldn't read file header")
-		return false
-	}
-
-	file.Seek(0, io.SeekStart)
-
-	if kind, err := filetype.Match(head); err != nil {
-		logrus.WithError(err).Error("unable to determine file type")
-		return false
-	} else {
-		if kind != matchers.TypeEpub && kind != matchers.TypePdf {
-			logrus.WithFields(logrus.Fields{"mime": kind.MIME.Value, "ext": kind.Extension}).WithError(err).Error("file type not supported")
-			return false
-		}
-	} // TODO mobi check
-	return true
-}
@@ -0,0 +1,48 @@
+package extract
+
+import (
+	"archive/zip"
+	"github.com/pkg/errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var comicImageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".bmp": true}
+
+// IsComicArchive reports whether a zip holds the page images of a comic rather than an EPUB
+// or some other document that happens to use zip.
+func IsComicArchive(file io.ReaderAt, size int64) bool {
+	zr, err := zip.NewReader(file, size)
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Name == "mimetype" || f.Name == "META-INF/container.xml" {
+			return false
+		}
+	}
+	return len(comicPages(zr)) > 0
+}
+
+func comicPages(zr *zip.Reader) []*zip.File {
+	var pages []*zip.File
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+		if comicImageExts[strings.ToLower(path.Ext(f.Name))] {
+			pages = append(pages, f)
+		}
+	}
+	return pages
+}
+
+// cbzMetadataOf counts the pages of a comic, any other metadata lives outside the archive.
+func cbzMetadataOf(file io.ReaderAt, size int64) (Metadata, error) {
+	zr, err := zip.NewReader(file, size)
+	if err != nil {
+		return Metadata{}, errors.Wrap(err, "unable to open comic archive")
+	}
+	return Metadata{PageCount: len(comicPages(zr))}, nil
+}
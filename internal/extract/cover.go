@@ -0,0 +1,259 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"image"
+	_ "image/gif" // decoders for cover images
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var pdfDrawXObject = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+Do\b`)
+
+// minCoverWidth skips icons and decorations when looking for a cover among a document's images.
+const minCoverWidth = 100
+
+// maxCoverPixels rejects images whose header claims dimensions that would take too much memory
+// to decode.
+const maxCoverPixels = 50 * 1000 * 1000
+
+var (
+	ErrNoCover = errors.New("no cover image found")
+)
+
+// Cover returns the cover image of a document: the image the EPUB or MOBI marks as its
+// cover, the first page of a comic, or the largest image drawn on the first page of a PDF.
+func Cover(file io.ReaderAt, size int64, mime string) (image.Image, error) {
+	switch mime {
+	case MIMEEpub:
+		return epubCover(file, size)
+	case MIMEPdf:
+		return pdfCover(file, size)
+	case MIMEMobi, MIMEAzw3:
+		return mobiCover(file, size)
+	case MIMECbz:
+		return cbzCover(file, size)
+	}
+	return nil, ErrUnsupported
+}
+
+func decodeImage(b []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode cover")
+	}
+	if config.Width*config.Height > maxCoverPixels {
+		return nil, errors.Wrap(ErrTooLarge, "cover dimensions")
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode cover")
+	}
+	return img, nil
+}
+
+// epubCover follows the EPUB 3 cover-image property, then the EPUB 2 cover meta, then falls
+// back to the first image named like a cover.
+func epubCover(file io.ReaderAt, size int64) (image.Image, error) {
+	e, err := openEpub(file, size)
+	if err != nil {
+		return nil, err
+	}
+
+	coverID := ""
+	for _, item := range e.pkg.Metadata.Meta {
+		if item.Name == "cover" {
+			coverID = item.Content
+		}
+	}
+
+	href := ""
+	fallback := ""
+	for _, item := range e.pkg.Manifest {
+		if !strings.HasPrefix(item.MediaType, "image/") {
+			continue
+		}
+		if strings.Contains(" "+item.Properties+" ", " cover-image ") || (coverID != "" && item.ID == coverID) {
+			href = item.Href
+			break
+		}
+		if fallback == "" && strings.Contains(strings.ToLower(item.ID+item.Href), "cover") {
+			fallback = item.Href
+		}
+	}
+	if href == "" {
+		href = fallback
+	}
+	if href == "" {
+		return nil, ErrNoCover
+	}
+
+	b, err := e.read(e.resolve(href))
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(b)
+}
+
+// pdfCover returns the largest image drawn on the first page, pages aren't rendered so a first
+// page without one has no cover even when later pages do.
+func pdfCover(file io.ReaderAt, size int64) (image.Image, error) {
+	data, err := readPdf(file, size)
+	if err != nil {
+		return nil, err
+	}
+	objects := pdfObjectStreams(data)
+	page, resources := pdfFirstPage(data, objects)
+	if page == nil {
+		return nil, ErrNoCover
+	}
+
+	// images the page can draw by name
+	names := make(map[string]int)
+	xobjects := pdfResolve(data, objects, pdfDictValue(resources, "XObject"))
+	for _, m := range pdfNamedRefs.FindAllSubmatch(xobjects, -1) {
+		names[string(m[1])] = atoi(string(m[2]))
+	}
+	if len(names) == 0 {
+		return nil, ErrNoCover
+	}
+
+	// of those, the ones its content actually draws
+	contents := make(map[int]bool)
+	value := pdfDictValue(page, "Contents")
+	if pdfRef.Match(value) {
+		if array := pdfResolve(data, objects, value); len(array) > 0 && array[0] == '[' {
+			// an indirect array of content streams
+			value = array
+		}
+	}
+	for _, m := range pdfRefs.FindAllSubmatch(value, -1) {
+		contents[atoi(string(m[1]))] = true
+	}
+	drawn := make(map[int]bool)
+	pdfEachStream(data, isContentDict, func(stream pdfStream) bool {
+		if contents[stream.num] {
+			for _, m := range pdfDrawXObject.FindAllSubmatch(stream.data, -1) {
+				if num, ok := names[string(m[1])]; ok {
+					drawn[num] = true
+				}
+			}
+		}
+		return true
+	})
+	if len(drawn) == 0 {
+		return nil, ErrNoCover
+	}
+
+	isImage := func(dict string) bool {
+		return (strings.Contains(dict, "/Subtype /Image") || strings.Contains(dict, "/Subtype/Image")) &&
+			pdfDictInt(dict, "Width") >= minCoverWidth
+	}
+	var cover image.Image
+	largest := 0
+	pdfEachStream(data, isImage, func(stream pdfStream) bool {
+		if !drawn[stream.num] {
+			return true
+		}
+		if img := pdfImage(stream); img != nil {
+			if b := img.Bounds(); b.Dx()*b.Dy() > largest {
+				cover, largest = img, b.Dx()*b.Dy()
+			}
+		}
+		return true
+	})
+	if cover == nil {
+		return nil, ErrNoCover
+	}
+	return cover, nil
+}
+
+// pdfImage decodes JPEG images and 8 bit RGB or gray samples, other color spaces are skipped.
+func pdfImage(stream pdfStream) image.Image {
+	if strings.Contains(stream.dict, "/DCTDecode") {
+		img, err := decodeImage(stream.data)
+		if err != nil {
+			return nil
+		}
+		return img
+	}
+
+	width := pdfDictInt(stream.dict, "Width")
+	height := pdfDictInt(stream.dict, "Height")
+	if width <= 0 || height <= 0 || width*height > maxCoverPixels {
+		return nil
+	}
+	if pdfDictInt(stream.dict, "BitsPerComponent") != 8 || strings.Contains(stream.dict, "/DecodeParms") {
+		// predictors would need undoing before the samples are usable
+		return nil
+	}
+	rect := image.Rect(0, 0, width, height)
+	switch {
+	case strings.Contains(stream.dict, "/DeviceRGB") && len(stream.data) >= width*height*3:
+		img := image.NewRGBA(rect)
+		for i := 0; i < width*height; i++ {
+			img.Pix[i*4] = stream.data[i*3]
+			img.Pix[i*4+1] = stream.data[i*3+1]
+			img.Pix[i*4+2] = stream.data[i*3+2]
+			img.Pix[i*4+3] = 0xff
+		}
+		return img
+	case strings.Contains(stream.dict, "/DeviceGray") && len(stream.data) >= width*height:
+		img := image.NewGray(rect)
+		copy(img.Pix, stream.data)
+		return img
+	}
+	return nil
+}
+
+// mobiCover reads the image record the EXTH cover offset points at, relative to the first
+// image record.
+func mobiCover(file io.ReaderAt, size int64) (image.Image, error) {
+	h, err := readMobiHeader(file, size)
+	if err != nil {
+		return nil, err
+	}
+	offsets := h.exth()[exthCoverOffset]
+	if len(offsets) == 0 || len(offsets[0]) < 4 || len(h.record) < 112 {
+		return nil, ErrNoCover
+	}
+	firstImage := binary.BigEndian.Uint32(h.record[108:112])
+	index := firstImage + binary.BigEndian.Uint32(offsets[0])
+
+	b, err := mobiRecord(file, h.offsets, int(index))
+	if err != nil {
+		return nil, ErrNoCover
+	}
+	return decodeImage(b)
+}
+
+// cbzCover returns the first page in name order, which is how readers order comic pages.
+func cbzCover(file io.ReaderAt, size int64) (image.Image, error) {
+	zr, err := zip.NewReader(file, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open comic archive")
+	}
+	pages := comicPages(zr)
+	if len(pages) == 0 {
+		return nil, ErrNoCover
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Name < pages[j].Name })
+
+	rc, err := pages[0].Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open comic page")
+	}
+	defer rc.Close()
+	b, err := readLimited(rc)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read comic page")
+	}
+	return decodeImage(b)
+}
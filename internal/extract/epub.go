@@ -0,0 +1,234 @@
+package extract
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"io"
+	"path"
+	"strings"
+)
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Metadata epubMetadata `xml:"metadata"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+type epubMetadata struct {
+	Titles      []string `xml:"title"`
+	Creators    []string `xml:"creator"`
+	Publishers  []string `xml:"publisher"`
+	Languages   []string `xml:"language"`
+	Identifiers []struct {
+		Scheme string `xml:"scheme,attr"`
+		Value  string `xml:",chardata"`
+	} `xml:"identifier"`
+	Meta []struct {
+		Name     string `xml:"name,attr"`
+		Content  string `xml:"content,attr"`
+		Property string `xml:"property,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"meta"`
+}
+
+// epub is an opened archive with its package document parsed.
+type epub struct {
+	files   map[string]*zip.File
+	pkg     epubPackage
+	pkgPath string
+}
+
+func openEpub(file io.ReaderAt, size int64) (*epub, error) {
+	zr, err := zip.NewReader(file, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open epub archive")
+	}
+	e := &epub{
+		files: make(map[string]*zip.File),
+	}
+	for _, f := range zr.File {
+		e.files[f.Name] = f
+	}
+
+	container := epubContainer{}
+	if err := e.decode("META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, errors.New("epub container has no rootfile")
+	}
+	e.pkgPath = container.Rootfiles[0].FullPath
+	if err := e.decode(e.pkgPath, &e.pkg); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *epub) read(name string) ([]byte, error) {
+	f, ok := e.files[name]
+	if !ok {
+		return nil, errors.Errorf("epub missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open %s", name)
+	}
+	defer rc.Close()
+	b, err := readLimited(rc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %s", name)
+	}
+	return b, nil
+}
+
+func (e *epub) decode(name string, v interface{}) error {
+	b, err := e.read(name)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(b, v); err != nil {
+		return errors.Wrapf(err, "unable to parse %s", name)
+	}
+	return nil
+}
+
+// resolve returns the archive path of a manifest href, which is relative to the package document.
+func (e *epub) resolve(href string) string {
+	if i := strings.IndexAny(href, "#?"); i >= 0 {
+		href = href[:i]
+	}
+	return path.Join(path.Dir(e.pkgPath), href)
+}
+
+func epubText(file io.ReaderAt, size int64) (string, error) {
+	e, err := openEpub(file, size)
+	if err != nil {
+		return "", err
+	}
+
+	hrefs := make(map[string]string)
+	for _, item := range e.pkg.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+
+	var b strings.Builder
+	for _, ref := range e.pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		content, err := e.read(e.resolve(href))
+		if err != nil {
+			continue
+		}
+		b.WriteString(htmlText(content))
+		b.WriteByte('\n')
+		if b.Len() > MaxTextLength {
+			break
+		}
+	}
+	return b.String(), nil
+}
+
+// htmlText returns the character data of an xhtml chapter, skipping scripts and styles.
+func htmlText(content []byte) string {
+	d := xml.NewDecoder(strings.NewReader(string(content)))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var b strings.Builder
+	skip := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "script", "style", "head":
+				skip++
+			case "p", "div", "br", "li", "h1", "h2", "h3", "h4", "h5", "h6", "tr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "script", "style", "head":
+				if skip > 0 {
+					skip--
+				}
+			}
+		case xml.CharData:
+			if skip == 0 {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String()
+}
+
+func epubMetadataOf(file io.ReaderAt, size int64) (Metadata, error) {
+	e, err := openEpub(file, size)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	m := e.pkg.Metadata
+	meta := Metadata{
+		Title:     first(m.Titles),
+		Publisher: first(m.Publishers),
+		Language:  first(m.Languages),
+	}
+	for _, creator := range m.Creators {
+		if creator = strings.TrimSpace(creator); creator != "" {
+			meta.Authors = append(meta.Authors, creator)
+		}
+	}
+	for _, id := range m.Identifiers {
+		if strings.EqualFold(id.Scheme, "isbn") || strings.HasPrefix(strings.ToLower(strings.TrimSpace(id.Value)), "urn:isbn:") {
+			if isbn := normalizeISBN(id.Value); isbn != "" {
+				meta.ISBN = isbn
+				break
+			}
+		}
+	}
+	if meta.ISBN == "" {
+		// plenty of epubs store the isbn as a bare identifier
+		for _, id := range m.Identifiers {
+			if isbn := normalizeISBN(id.Value); isbn != "" {
+				meta.ISBN = isbn
+				break
+			}
+		}
+	}
+	for _, item := range m.Meta {
+		if item.Property == "schema:numberOfPages" {
+			meta.PageCount = atoi(item.Value)
+		}
+	}
+	return meta, nil
+}
+
+func first(values []string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
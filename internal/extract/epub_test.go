@@ -0,0 +1,220 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/pkg/errors"
+	"image"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const epubContainerXML = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`
+
+const epubPackageXML = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>A Wizard of Earthsea</dc:title>
+    <dc:creator>Ursula K. Le Guin</dc:creator>
+    <dc:creator> </dc:creator>
+    <dc:publisher>Parnassus</dc:publisher>
+    <dc:language>en</dc:language>
+    <dc:identifier>uuid:0b5c6e9a</dc:identifier>
+    <dc:identifier>urn:isbn:978-0-547-72202-3</dc:identifier>
+    <meta property="schema:numberOfPages">183</meta>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="text/ch1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch2" href="text/ch2.xhtml#start" media-type="application/xhtml+xml"/>
+    <item id="missing" href="text/missing.xhtml" media-type="application/xhtml+xml"/>
+    <item id="img" href="images/cover.png" media-type="image/png" properties="cover-image"/>
+  </manifest>
+  <spine><itemref idref="ch1"/><itemref idref="missing"/><itemref idref="unknown"/><itemref idref="ch2"/></spine>
+</package>`
+
+func pngFixture(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipFixture writes the entries in the given order, names and contents alternating.
+func zipFixture(t *testing.T, entries ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w, err := zw.Create(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entries[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sampleEpub(t *testing.T) []byte {
+	return zipFixture(t,
+		"mimetype", MIMEEpub,
+		"META-INF/container.xml", epubContainerXML,
+		"OEBPS/content.opf", epubPackageXML,
+		"OEBPS/text/ch1.xhtml", `<html><head><title>Skipped</title></head><body><h1>The Warriors in the Mist</h1><script>var skipped;</script><p>The island of Gont&mdash;a single mountain</p></body></html>`,
+		"OEBPS/text/ch2.xhtml", `<html><body><p>Shadow<br>and<br/>light</p></body></html>`,
+		"OEBPS/images/cover.png", string(pngFixture(t, 120, 180)),
+	)
+}
+
+func TestEpubMetadata(t *testing.T) {
+	data := sampleEpub(t)
+	meta, err := ReadMetadata(bytes.NewReader(data), int64(len(data)), MIMEEpub)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Metadata{
+		Title:     "A Wizard of Earthsea",
+		Authors:   []string{"Ursula K. Le Guin"},
+		Publisher: "Parnassus",
+		Language:  "en",
+		ISBN:      "9780547722023",
+		PageCount: 183,
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("got %+v, want %+v", meta, want)
+	}
+}
+
+func TestEpubText(t *testing.T) {
+	data := sampleEpub(t)
+	text, err := Text(bytes.NewReader(data), int64(len(data)), MIMEEpub)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "The Warriors in the Mist The island of Gont—a single mountain Shadow and light"
+	if text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
+
+func TestEpubCover(t *testing.T) {
+	data := sampleEpub(t)
+	img, err := Cover(bytes.NewReader(data), int64(len(data)), MIMEEpub)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 120 || b.Dy() != 180 {
+		t.Errorf("cover is %dx%d, want 120x180", b.Dx(), b.Dy())
+	}
+}
+
+func TestEpubMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data func(t *testing.T) []byte
+	}{
+		{"not a zip", func(t *testing.T) []byte { return []byte("%PDF-1.4 not a zip") }},
+		{"missing container", func(t *testing.T) []byte {
+			return zipFixture(t, "mimetype", MIMEEpub, "OEBPS/content.opf", epubPackageXML)
+		}},
+		{"container without rootfile", func(t *testing.T) []byte {
+			return zipFixture(t, "META-INF/container.xml", `<container><rootfiles/></container>`)
+		}},
+		{"container not xml", func(t *testing.T) []byte {
+			return zipFixture(t, "META-INF/container.xml", "\x00\x01garbage")
+		}},
+		{"missing package", func(t *testing.T) []byte {
+			return zipFixture(t, "META-INF/container.xml", epubContainerXML)
+		}},
+		{"package not xml", func(t *testing.T) []byte {
+			return zipFixture(t, "META-INF/container.xml", epubContainerXML, "OEBPS/content.opf", "<package><metadata>")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.data(t)
+			r := bytes.NewReader(data)
+			size := int64(len(data))
+			if _, err := Text(r, size, MIMEEpub); err == nil {
+				t.Error("Text succeeded on a malformed epub")
+			}
+			if _, err := ReadMetadata(r, size, MIMEEpub); err == nil {
+				t.Error("ReadMetadata succeeded on a malformed epub")
+			}
+			if _, err := Cover(r, size, MIMEEpub); err == nil {
+				t.Error("Cover succeeded on a malformed epub")
+			}
+		})
+	}
+}
+
+func TestEpubBrokenContent(t *testing.T) {
+	data := zipFixture(t,
+		"META-INF/container.xml", epubContainerXML,
+		"OEBPS/content.opf", epubPackageXML,
+		"OEBPS/text/ch1.xhtml", `<html><body><p>unclosed <b>tags & stray entities &nope;`,
+		"OEBPS/images/cover.png", "\x89PNG\r\n\x1a\n truncated",
+	)
+	r := bytes.NewReader(data)
+	size := int64(len(data))
+
+	text, err := Text(r, size, MIMEEpub)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(text, "unclosed tags") {
+		t.Errorf("text = %q, want the readable part of the chapter", text)
+	}
+	if _, err := Cover(r, size, MIMEEpub); err == nil {
+		t.Error("Cover decoded a truncated image")
+	}
+}
+
+func TestEpubTruncated(t *testing.T) {
+	data := sampleEpub(t)
+	for n := 0; n < len(data); n++ {
+		r := bytes.NewReader(data[:n])
+		// every prefix has to be handled without panicking, the result itself doesn't matter
+		Text(r, int64(n), MIMEEpub)
+		ReadMetadata(r, int64(n), MIMEEpub)
+		Cover(r, int64(n), MIMEEpub)
+	}
+}
+
+func TestEpubEntryLimit(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("OEBPS/text/bomb.xhtml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(make([]byte, maxDecodedSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &epub{files: map[string]*zip.File{}}
+	for _, f := range zr.File {
+		e.files[f.Name] = f
+	}
+	if _, err := e.read("OEBPS/text/bomb.xhtml"); errors.Cause(err) != ErrTooLarge {
+		t.Errorf("read error = %v, want %v", err, ErrTooLarge)
+	}
+}
@@ -0,0 +1,96 @@
+package extract
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// MaxTextLength caps extracted text so it fits comfortably in a search index.
+const MaxTextLength = 512 * 1024
+
+// maxDecodedSize caps how far a single compressed stream or archive entry may expand, so a
+// small crafted file can't exhaust memory.
+const maxDecodedSize = 32 << 20
+
+const (
+	MIMEPdf  = "application/pdf"
+	MIMEEpub = "application/epub+zip"
+	MIMEMobi = "application/x-mobipocket-ebook"
+	MIMEAzw3 = "application/vnd.amazon.mobi8-ebook"
+	MIMECbz  = "application/vnd.comicbook+zip"
+	MIMECbr  = "application/vnd.comicbook-rar"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported format for extraction")
+	ErrTooLarge    = errors.New("decoded content exceeds size limit")
+)
+
+// Text returns the readable body text of a document, truncated to MaxTextLength.
+func Text(file io.ReaderAt, size int64, mime string) (string, error) {
+	var (
+		text string
+		err  error
+	)
+	switch mime {
+	case MIMEEpub:
+		text, err = epubText(file, size)
+	case MIMEPdf:
+		text, err = pdfText(file, size)
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncate(normalizeSpace(text), MaxTextLength), nil
+}
+
+// HTMLText is the plain text of an HTML fragment, such as a description kept as markup.
+func HTMLText(content string) string {
+	return normalizeSpace(htmlText([]byte(content)))
+}
+
+// normalizeSpace collapses runs of whitespace so markup indentation doesn't bloat the text.
+func normalizeSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if !unicode.IsPrint(r) {
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	// drop any rune cut in half
+	return strings.ToValidUTF8(s[:max], "")
+}
+
+// readLimited reads r to the end, failing once more than maxDecodedSize bytes come out of it.
+func readLimited(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxDecodedSize {
+		return nil, ErrTooLarge
+	}
+	return b, nil
+}
@@ -0,0 +1,68 @@
+package extract
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Metadata is the bibliographic information embedded in a document.
+type Metadata struct {
+	Title     string
+	Authors   []string
+	Publisher string
+	Language  string
+	ISBN      string
+	PageCount int
+}
+
+// ReadMetadata reads EPUB OPF metadata, the PDF Info dictionary and XMP packet, MOBI EXTH
+// records or the page count of a comic archive.
+func ReadMetadata(file io.ReaderAt, size int64, mime string) (Metadata, error) {
+	switch mime {
+	case MIMEEpub:
+		return epubMetadataOf(file, size)
+	case MIMEPdf:
+		return pdfMetadataOf(file, size)
+	case MIMEMobi, MIMEAzw3:
+		return mobiMetadataOf(file, size)
+	case MIMECbz:
+		return cbzMetadataOf(file, size)
+	}
+	return Metadata{}, ErrUnsupported
+}
+
+// normalizeISBN strips prefixes and separators, returning an empty string when the value
+// isn't shaped like an ISBN-10 or ISBN-13.
+func normalizeISBN(value string) string {
+	value = strings.TrimSpace(strings.ToLower(value))
+	value = strings.TrimPrefix(value, "urn:isbn:")
+	value = strings.TrimPrefix(value, "isbn:")
+	value = strings.TrimPrefix(value, "isbn")
+
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == 'x':
+			b.WriteRune('X')
+		case r == '-' || r == ' ':
+		default:
+			return ""
+		}
+	}
+	isbn := b.String()
+	if len(isbn) == 13 && !strings.Contains(isbn, "X") {
+		return isbn
+	}
+	if len(isbn) == 10 && !strings.Contains(isbn[:9], "X") {
+		return isbn
+	}
+	return ""
+}
+
+func atoi(value string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(value))
+	return n
+}
@@ -0,0 +1,180 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	mobiEncodingUTF8 = 65001
+
+	exthAuthor      = 100
+	exthPublisher   = 101
+	exthISBN        = 104
+	exthCoverOffset = 201
+	exthTitle       = 503
+	exthLanguage    = 524
+)
+
+// mobiHeader is the part of the first record of a MOBI file needed to identify it and read its
+// EXTH metadata. Offsets are relative to the start of the record.
+type mobiHeader struct {
+	record   []byte
+	offsets  []int64 // start of each record followed by the end of the file
+	version  uint32
+	encoding uint32
+}
+
+// IsMobi reports whether a file header is a PalmDB container holding a MOBI book.
+func IsMobi(head []byte) bool {
+	return len(head) >= 68 && bytes.Equal(head[60:68], []byte("BOOKMOBI"))
+}
+
+// MobiFormat tells apart the legacy MOBI format from KF8 books, which are sold as AZW3.
+// Combined files carry both and are reported as MOBI since any reader can open them.
+func MobiFormat(file io.ReaderAt, size int64) (string, error) {
+	h, err := readMobiHeader(file, size)
+	if err != nil {
+		return "", err
+	}
+	if h.version >= 8 {
+		return MIMEAzw3, nil
+	}
+	return MIMEMobi, nil
+}
+
+func readMobiHeader(file io.ReaderAt, size int64) (*mobiHeader, error) {
+	palm := make([]byte, 78)
+	if _, err := file.ReadAt(palm, 0); err != nil {
+		return nil, errors.Wrap(err, "unable to read palm database header")
+	}
+	if !IsMobi(palm) {
+		return nil, errors.New("missing mobi header")
+	}
+	records := int(binary.BigEndian.Uint16(palm[76:78]))
+	if records < 1 {
+		return nil, errors.New("mobi has no records")
+	}
+
+	list := make([]byte, 8*records)
+	if _, err := file.ReadAt(list, 78); err != nil {
+		return nil, errors.Wrap(err, "unable to read mobi record list")
+	}
+	offsets := make([]int64, records+1)
+	for i := 0; i < records; i++ {
+		offsets[i] = int64(binary.BigEndian.Uint32(list[i*8 : i*8+4]))
+	}
+	offsets[records] = size
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] || offsets[i] > size {
+			return nil, errors.New("invalid mobi record offsets")
+		}
+	}
+
+	record, err := mobiRecord(file, offsets, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(record) < 40 || !bytes.Equal(record[16:20], []byte("MOBI")) {
+		return nil, errors.New("missing mobi header")
+	}
+	return &mobiHeader{
+		record:   record,
+		offsets:  offsets,
+		encoding: binary.BigEndian.Uint32(record[28:32]),
+		version:  binary.BigEndian.Uint32(record[36:40]),
+	}, nil
+}
+
+func mobiRecord(file io.ReaderAt, offsets []int64, i int) ([]byte, error) {
+	if i < 0 || i+1 >= len(offsets) {
+		return nil, errors.Errorf("mobi record %d out of range", i)
+	}
+	if offsets[i+1]-offsets[i] > maxDecodedSize {
+		return nil, errors.Wrapf(ErrTooLarge, "mobi record %d", i)
+	}
+	record := make([]byte, offsets[i+1]-offsets[i])
+	if _, err := file.ReadAt(record, offsets[i]); err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "unable to read mobi record %d", i)
+	}
+	return record, nil
+}
+
+// mobiMetadataOf reads the full name from the MOBI header and the rest from EXTH records.
+func mobiMetadataOf(file io.ReaderAt, size int64) (Metadata, error) {
+	h, err := readMobiHeader(file, size)
+	if err != nil {
+		return Metadata{}, err
+	}
+	r := h.record
+
+	meta := Metadata{}
+	if len(r) >= 92 {
+		offset := binary.BigEndian.Uint32(r[84:88])
+		length := binary.BigEndian.Uint32(r[88:92])
+		if int(offset+length) <= len(r) {
+			meta.Title = h.text(r[offset : offset+length])
+		}
+	}
+
+	for typ, values := range h.exth() {
+		switch typ {
+		case exthAuthor:
+			for _, v := range values {
+				meta.Authors = append(meta.Authors, splitAuthors(h.text(v))...)
+			}
+		case exthPublisher:
+			meta.Publisher = h.text(values[0])
+		case exthISBN:
+			meta.ISBN = normalizeISBN(h.text(values[0]))
+		case exthTitle:
+			meta.Title = h.text(values[0])
+		case exthLanguage:
+			meta.Language = h.text(values[0])
+		}
+	}
+	return meta, nil
+}
+
+// exth returns the EXTH records by type, empty when the header doesn't have the EXTH flag set.
+func (h *mobiHeader) exth() map[uint32][][]byte {
+	r := h.record
+	records := make(map[uint32][][]byte)
+	if len(r) < 132 || binary.BigEndian.Uint32(r[128:132])&0x40 == 0 {
+		return records
+	}
+
+	start := 16 + int(binary.BigEndian.Uint32(r[20:24]))
+	if start+12 > len(r) || !bytes.Equal(r[start:start+4], []byte("EXTH")) {
+		return records
+	}
+	count := int(binary.BigEndian.Uint32(r[start+8 : start+12]))
+	pos := start + 12
+	for i := 0; i < count && pos+8 <= len(r); i++ {
+		typ := binary.BigEndian.Uint32(r[pos : pos+4])
+		length := int(binary.BigEndian.Uint32(r[pos+4 : pos+8]))
+		if length < 8 || pos+length > len(r) {
+			break
+		}
+		records[typ] = append(records[typ], r[pos+8:pos+length])
+		pos += length
+	}
+	return records
+}
+
+// text decodes a header string, older books use cp1252 which is close enough to Latin-1 for metadata.
+func (h *mobiHeader) text(b []byte) string {
+	b = bytes.TrimRight(b, "\x00")
+	if h.encoding == mobiEncodingUTF8 && utf8.Valid(b) {
+		return strings.TrimSpace(string(b))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.TrimSpace(string(runes))
+}
@@ -0,0 +1,230 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+)
+
+type exthRecord struct {
+	typ   uint32
+	value []byte
+}
+
+// mobiHeaderRecord builds the first record of a MOBI file: the PalmDOC header, a MOBI header
+// with the full name after it and, when there are any, EXTH records in between.
+func mobiHeaderRecord(version uint32, encoding uint32, name string, exth ...exthRecord) []byte {
+	const headerLength = 232
+	r := make([]byte, 16+headerLength)
+	copy(r[16:20], "MOBI")
+	binary.BigEndian.PutUint32(r[20:24], headerLength)
+	binary.BigEndian.PutUint32(r[28:32], encoding)
+	binary.BigEndian.PutUint32(r[36:40], version)
+	binary.BigEndian.PutUint32(r[108:112], 1) // the first image is the record after this one
+
+	if len(exth) > 0 {
+		binary.BigEndian.PutUint32(r[128:132], 0x40)
+		var records bytes.Buffer
+		for _, rec := range exth {
+			binary.Write(&records, binary.BigEndian, rec.typ)
+			binary.Write(&records, binary.BigEndian, uint32(8+len(rec.value)))
+			records.Write(rec.value)
+		}
+		r = append(r, "EXTH"...)
+		r = append(r, make([]byte, 8)...)
+		binary.BigEndian.PutUint32(r[len(r)-8:len(r)-4], uint32(12+records.Len()))
+		binary.BigEndian.PutUint32(r[len(r)-4:], uint32(len(exth)))
+		r = append(r, records.Bytes()...)
+	}
+
+	binary.BigEndian.PutUint32(r[84:88], uint32(len(r)))
+	binary.BigEndian.PutUint32(r[88:92], uint32(len(name)))
+	return append(r, name...)
+}
+
+// palmDatabase wraps records in a PalmDB container typed as a MOBI book.
+func palmDatabase(records ...[]byte) []byte {
+	header := make([]byte, 78)
+	copy(header, "Test Book")
+	copy(header[60:68], "BOOKMOBI")
+	binary.BigEndian.PutUint16(header[76:78], uint16(len(records)))
+
+	offset := len(header) + 8*len(records) + 2
+	list := make([]byte, 8*len(records)+2)
+	for i, rec := range records {
+		binary.BigEndian.PutUint32(list[i*8:], uint32(offset))
+		binary.BigEndian.PutUint32(list[i*8+4:], uint32(2*i))
+		offset += len(rec)
+	}
+
+	data := append(header, list...)
+	for _, rec := range records {
+		data = append(data, rec...)
+	}
+	return data
+}
+
+func sampleMobi(t *testing.T, version uint32) []byte {
+	return palmDatabase(
+		mobiHeaderRecord(version, mobiEncodingUTF8, "Full Name",
+			exthRecord{exthAuthor, []byte("Jemisin, N. K. & Someone Else")},
+			exthRecord{exthPublisher, []byte("Orbit")},
+			exthRecord{exthISBN, []byte("978-0-316-22929-6")},
+			exthRecord{exthTitle, []byte("The Fifth Season\x00\x00")},
+			exthRecord{exthLanguage, []byte("en")},
+			exthRecord{exthCoverOffset, []byte{0, 0, 0, 0}},
+		),
+		pngFixture(t, 100, 150),
+	)
+}
+
+func TestMobiFormat(t *testing.T) {
+	tests := []struct {
+		version uint32
+		want    string
+	}{
+		{6, MIMEMobi},
+		{7, MIMEMobi},
+		{8, MIMEAzw3},
+	}
+	for _, tt := range tests {
+		data := sampleMobi(t, tt.version)
+		got, err := MobiFormat(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("version %d: unexpected error: %v", tt.version, err)
+		}
+		if got != tt.want {
+			t.Errorf("version %d: got %s, want %s", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestMobiMetadata(t *testing.T) {
+	data := sampleMobi(t, 6)
+	meta, err := ReadMetadata(bytes.NewReader(data), int64(len(data)), MIMEMobi)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Metadata{
+		Title:     "The Fifth Season",
+		Authors:   []string{"Jemisin, N. K.", "Someone Else"},
+		Publisher: "Orbit",
+		Language:  "en",
+		ISBN:      "9780316229296",
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("got %+v, want %+v", meta, want)
+	}
+}
+
+func TestMobiFullNameAndLatin1(t *testing.T) {
+	data := palmDatabase(mobiHeaderRecord(6, 1252, "Caf\xe9 Stories"))
+	meta, err := ReadMetadata(bytes.NewReader(data), int64(len(data)), MIMEMobi)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Title != "Café Stories" {
+		t.Errorf("title = %q, want %q", meta.Title, "Café Stories")
+	}
+}
+
+func TestMobiCover(t *testing.T) {
+	data := sampleMobi(t, 8)
+	img, err := Cover(bytes.NewReader(data), int64(len(data)), MIMEAzw3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 150 {
+		t.Errorf("cover is %dx%d, want 100x150", b.Dx(), b.Dy())
+	}
+
+	data = palmDatabase(mobiHeaderRecord(6, mobiEncodingUTF8, "No Cover", exthRecord{exthCoverOffset, []byte{0, 0, 0, 5}}))
+	if _, err := Cover(bytes.NewReader(data), int64(len(data)), MIMEMobi); err != ErrNoCover {
+		t.Errorf("cover record out of range: error = %v, want %v", err, ErrNoCover)
+	}
+}
+
+func TestMobiMalformed(t *testing.T) {
+	valid := palmDatabase(mobiHeaderRecord(6, mobiEncodingUTF8, "Name"))
+	withRecordCount := func(n uint16) []byte {
+		data := append([]byte(nil), valid...)
+		binary.BigEndian.PutUint16(data[76:78], n)
+		return data
+	}
+	withOffset := func(offset uint32) []byte {
+		data := append([]byte(nil), valid...)
+		binary.BigEndian.PutUint32(data[78:82], offset)
+		return data
+	}
+	notMobi := append([]byte(nil), valid...)
+	copy(notMobi[60:68], "TEXtREAd")
+	noMobiHeader := palmDatabase(make([]byte, 64))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", valid[:40]},
+		{"not a mobi", notMobi},
+		{"no records", withRecordCount(0)},
+		{"more records than listed", withRecordCount(400)},
+		{"offset past the end", withOffset(uint32(len(valid) + 1))},
+		{"record without mobi header", noMobiHeader},
+		{"record too short", palmDatabase([]byte("MOBI"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.data)
+			size := int64(len(tt.data))
+			if _, err := MobiFormat(r, size); err == nil {
+				t.Error("MobiFormat succeeded on a malformed file")
+			}
+			if _, err := ReadMetadata(r, size, MIMEMobi); err == nil {
+				t.Error("ReadMetadata succeeded on a malformed file")
+			}
+			if _, err := Cover(r, size, MIMEMobi); err == nil {
+				t.Error("Cover succeeded on a malformed file")
+			}
+		})
+	}
+}
+
+func TestMobiBrokenExth(t *testing.T) {
+	record := mobiHeaderRecord(6, mobiEncodingUTF8, "Name",
+		exthRecord{exthPublisher, []byte("Orbit")},
+		exthRecord{exthTitle, []byte("Lost")},
+	)
+	// the second record claims to run past the end of the header record
+	second := bytes.LastIndex(record, []byte("Lost")) - 4
+	binary.BigEndian.PutUint32(record[second:], 1<<20)
+	data := palmDatabase(record)
+
+	meta, err := ReadMetadata(bytes.NewReader(data), int64(len(data)), MIMEMobi)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Publisher != "Orbit" || meta.Title != "Name" {
+		t.Errorf("got %+v, want the publisher and the full name", meta)
+	}
+}
+
+func TestMobiTruncated(t *testing.T) {
+	data := sampleMobi(t, 6)
+	for n := 0; n < len(data); n++ {
+		r := bytes.NewReader(data[:n])
+		// every prefix has to be handled without panicking, the result itself doesn't matter
+		MobiFormat(r, int64(n))
+		ReadMetadata(r, int64(n), MIMEMobi)
+		Cover(r, int64(n), MIMEMobi)
+	}
+}
+
+func TestMobiRecordLimit(t *testing.T) {
+	offsets := []int64{0, maxDecodedSize + 1}
+	if _, err := mobiRecord(bytes.NewReader(nil), offsets, 0); errors.Cause(err) != ErrTooLarge {
+		t.Errorf("error = %v, want %v", err, ErrTooLarge)
+	}
+}
@@ -0,0 +1,910 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// maxPdfDecoded bounds the inflated size of all the streams of one walk over a file, many small
+// streams can add up as well as a single large one.
+const maxPdfDecoded = 4 * maxDecodedSize
+
+var (
+	pdfStreamKeyword = []byte("stream")
+	pdfEndStream     = []byte("endstream")
+	pdfObj           = []byte(" obj")
+)
+
+// readPdf loads the whole file with a single read, a stored object fetches each read separately.
+func readPdf(file io.ReaderAt, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := file.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "unable to read pdf")
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return nil, errors.New("missing pdf header")
+	}
+	return data, nil
+}
+
+// pdfText pulls the strings drawn by text operators out of the page content streams. It doesn't
+// interpret font encodings, so text in embedded CID fonts without a unicode mapping is skipped.
+func pdfText(file io.ReaderAt, size int64) (string, error) {
+	data, err := readPdf(file, size)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, content := range pdfContentStreams(data) {
+		b.WriteString(contentText(content))
+		b.WriteByte('\n')
+		if b.Len() > MaxTextLength {
+			break
+		}
+	}
+	return b.String(), nil
+}
+
+// pdfContentStreams returns the decoded streams that may hold page content, skipping images,
+// fonts and other binary data.
+func pdfContentStreams(data []byte) [][]byte {
+	var streams [][]byte
+	for _, stream := range pdfStreams(data, isContentDict) {
+		streams = append(streams, stream.data)
+	}
+	return streams
+}
+
+type pdfStream struct {
+	num  int // object number, -1 when the object header couldn't be read
+	dict string
+	data []byte
+}
+
+// pdfStreams decodes every stream whose dictionary is accepted by want.
+func pdfStreams(data []byte, want func(dict string) bool) []pdfStream {
+	var streams []pdfStream
+	pdfEachStream(data, want, func(stream pdfStream) bool {
+		streams = append(streams, stream)
+		return true
+	})
+	return streams
+}
+
+// pdfEachStream walks the stream objects in file order, decoding the ones whose dictionary is
+// accepted by want and passing them to fn until it returns false. Streams using filters other
+// than FlateDecode are skipped, except DCTDecode which is left as the JPEG it already is. The
+// walk stops once maxPdfDecoded bytes have been inflated.
+func pdfEachStream(data []byte, want func(dict string) bool, fn func(stream pdfStream) bool) {
+	pos := 0
+	decoded := 0
+	for {
+		i := bytes.Index(data[pos:], pdfStreamKeyword)
+		if i < 0 {
+			return
+		}
+		start := pos + i
+		pos = start + len(pdfStreamKeyword)
+		// ignore the keyword when it is part of endstream
+		if start >= 3 && bytes.Equal(data[start-3:start], []byte("end")) {
+			continue
+		}
+
+		body := pos
+		if body < len(data) && data[body] == '\r' {
+			body++
+		}
+		if body < len(data) && data[body] == '\n' {
+			body++
+		}
+		end := bytes.Index(data[body:], pdfEndStream)
+		if end < 0 {
+			return
+		}
+		raw := data[body : body+end]
+		pos = body + end + len(pdfEndStream)
+
+		dictStart := bytes.LastIndex(data[:start], pdfObj)
+		if dictStart < 0 {
+			continue
+		}
+		dict := string(data[dictStart:start])
+		if !want(dict) {
+			continue
+		}
+
+		if strings.Contains(dict, "/FlateDecode") {
+			out, ok := inflate(raw)
+			if !ok {
+				continue
+			}
+			if decoded += len(out); decoded > maxPdfDecoded {
+				return
+			}
+			raw = out
+		} else if strings.Contains(dict, "/Filter") && !strings.Contains(dict, "/DCTDecode") {
+			continue
+		}
+		if !fn(pdfStream{num: pdfObjectNumber(data[:dictStart]), dict: dict, data: raw}) {
+			return
+		}
+	}
+}
+
+// pdfObjectNumber reads the object number from the "num gen" header that data ends with.
+func pdfObjectNumber(data []byte) int {
+	m := pdfObjNumber.FindSubmatch(data[len(data)-minInt(len(data), 32):])
+	if m == nil {
+		return -1
+	}
+	return atoi(string(m[1]))
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func isContentDict(dict string) bool {
+	for _, skip := range []string{"/Subtype", "/Length1", "/Length2", "/Type /XRef", "/Type/XRef", "/Type /ObjStm", "/Type/ObjStm", "/Type /Metadata", "/Type/Metadata"} {
+		if strings.Contains(dict, skip) {
+			return false
+		}
+	}
+	return true
+}
+
+// inflate decodes a flate stream, keeping whatever was decoded before any corruption. Streams
+// expanding past maxDecodedSize are rejected rather than cut short.
+func inflate(raw []byte) ([]byte, bool) {
+	r, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, false
+	}
+	defer r.Close()
+	out, _ := ioutil.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if len(out) > maxDecodedSize {
+		return nil, false
+	}
+	return out, len(out) > 0
+}
+
+// contentText runs a small tokenizer over a content stream and collects the operands of the
+// text showing operators Tj, TJ, ' and ".
+func contentText(content []byte) string {
+	var (
+		b        strings.Builder
+		operands []interface{}
+		array    []interface{}
+		inArray  bool
+	)
+	push := func(v interface{}) {
+		if inArray {
+			array = append(array, v)
+			return
+		}
+		operands = append(operands, v)
+	}
+	write := func(s []byte) {
+		if text, ok := pdfString(s); ok {
+			b.WriteString(text)
+		}
+	}
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case isPdfSpace(c):
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, n := literalString(content[i:])
+			push(s)
+			i += n
+		case c == '<' && i+1 < len(content) && content[i+1] == '<':
+			// inline dictionaries only appear as operands to marked content, skip them
+			depth := 0
+			for i < len(content) {
+				if bytes.HasPrefix(content[i:], []byte("<<")) {
+					depth++
+					i += 2
+				} else if bytes.HasPrefix(content[i:], []byte(">>")) {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+		case c == '<':
+			s, n := hexString(content[i:])
+			push(s)
+			i += n
+		case c == '[':
+			inArray = true
+			array = nil
+			i++
+		case c == ']':
+			inArray = false
+			operands = append(operands, array)
+			i++
+		case c == '/' || c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(content) && !isPdfSpace(content[j]) && !isPdfDelimiter(content[j]) {
+				j++
+			}
+			if c != '/' {
+				push(parseNumber(content[i:j]))
+			}
+			i = j
+		default:
+			j := i
+			for j < len(content) && !isPdfSpace(content[j]) && !isPdfDelimiter(content[j]) {
+				j++
+			}
+			if j == i {
+				j++
+			}
+			op := string(content[i:j])
+			i = j
+
+			// inline images hold binary data until EI
+			if op == "BI" {
+				if k := bytes.Index(content[i:], []byte("EI")); k >= 0 {
+					i += k + 2
+				} else {
+					i = len(content)
+				}
+			}
+
+			switch op {
+			case "Tj":
+				if s, ok := lastString(operands); ok {
+					write(s)
+				}
+			case "'", "\"":
+				b.WriteByte('\n')
+				if s, ok := lastString(operands); ok {
+					write(s)
+				}
+			case "TJ":
+				if len(operands) > 0 {
+					if arr, ok := operands[len(operands)-1].([]interface{}); ok {
+						for _, v := range arr {
+							switch t := v.(type) {
+							case []byte:
+								write(t)
+							case float64:
+								if t < -200 {
+									b.WriteByte(' ')
+								}
+							}
+						}
+					}
+				}
+			case "Td", "TD", "T*", "Tm":
+				b.WriteByte(' ')
+			case "ET":
+				b.WriteByte('\n')
+			}
+			operands = operands[:0]
+		}
+	}
+	return b.String()
+}
+
+func lastString(operands []interface{}) ([]byte, bool) {
+	for i := len(operands) - 1; i >= 0; i-- {
+		if s, ok := operands[i].([]byte); ok {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func parseNumber(b []byte) float64 {
+	var (
+		n       float64
+		neg     bool
+		decimal float64
+	)
+	for _, c := range b {
+		switch {
+		case c == '-':
+			neg = true
+		case c == '.':
+			decimal = 1
+		case c >= '0' && c <= '9':
+			if decimal > 0 {
+				decimal /= 10
+				n += float64(c-'0') * decimal
+			} else {
+				n = n*10 + float64(c-'0')
+			}
+		}
+	}
+	if neg {
+		return -n
+	}
+	return n
+}
+
+// literalString parses a (string) with nested parentheses and escapes, returning the bytes
+// and how much input was consumed.
+func literalString(in []byte) ([]byte, int) {
+	var out []byte
+	depth := 0
+	i := 0
+	for i < len(in) {
+		c := in[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+			i++
+		case ')':
+			depth--
+			i++
+			if depth == 0 {
+				return out, i
+			}
+			out = append(out, c)
+		case '\\':
+			i++
+			if i >= len(in) {
+				return out, i
+			}
+			e := in[i]
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				// line continuation
+				if e == '\r' && i+1 < len(in) && in[i+1] == '\n' {
+					i++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					n := 0
+					for n < 3 && i < len(in) && in[i] >= '0' && in[i] <= '7' {
+						v = v*8 + int(in[i]-'0')
+						i++
+						n++
+					}
+					out = append(out, byte(v))
+					continue
+				}
+				out = append(out, e)
+			}
+			i++
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	return out, i
+}
+
+func hexString(in []byte) ([]byte, int) {
+	var out []byte
+	var hi byte
+	half := false
+	i := 1
+	for i < len(in) && in[i] != '>' {
+		v, ok := hexValue(in[i])
+		i++
+		if !ok {
+			continue
+		}
+		if half {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, hi<<4)
+	}
+	return out, i + 1
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// pdfString decodes a string as UTF-16 when it has a byte order mark or looks like two byte
+// codes, otherwise as Latin-1. Strings that are mostly unprintable are rejected since they
+// come from fonts with custom encodings.
+func pdfString(s []byte) (string, bool) {
+	if len(s) == 0 {
+		return "", false
+	}
+	var text string
+	if len(s) >= 2 && ((s[0] == 0xfe && s[1] == 0xff) || looksUTF16(s)) {
+		if s[0] == 0xfe && s[1] == 0xff {
+			s = s[2:]
+		}
+		codes := make([]uint16, 0, len(s)/2)
+		for i := 0; i+1 < len(s); i += 2 {
+			codes = append(codes, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		text = string(utf16.Decode(codes))
+	} else {
+		runes := make([]rune, len(s))
+		for i, c := range s {
+			runes[i] = rune(c)
+		}
+		text = string(runes)
+	}
+
+	printable := 0
+	total := 0
+	for _, r := range text {
+		total++
+		if unicode.IsPrint(r) || unicode.IsSpace(r) {
+			printable++
+		}
+	}
+	return text, total > 0 && printable*10 >= total*8
+}
+
+func looksUTF16(s []byte) bool {
+	if len(s)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(s); i += 2 {
+		if s[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func isPdfSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPdfDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+var (
+	pdfInfoRef   = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfPagesType = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfCount     = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfObjHeader = regexp.MustCompile(`\d+`)
+	pdfObjNumber = regexp.MustCompile(`(?:^|[^0-9])(\d+)\s+\d+\s*$`)
+	pdfRootRef   = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	pdfRef       = regexp.MustCompile(`^\s*(\d+)\s+(\d+)\s+R\b`)
+	pdfRefs      = regexp.MustCompile(`(\d+)\s+(\d+)\s+R\b`)
+	pdfNamedRefs = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R\b`)
+)
+
+// pdfMetadataOf reads the Info dictionary and falls back to the XMP packet for anything it
+// doesn't set. The page count comes from the root of the page tree.
+func pdfMetadataOf(file io.ReaderAt, size int64) (Metadata, error) {
+	data, err := readPdf(file, size)
+	if err != nil {
+		return Metadata{}, err
+	}
+	objects := pdfObjectStreams(data)
+
+	meta := Metadata{}
+	if info := pdfInfoDict(data, objects); info != nil {
+		meta.Title = pdfDictString(info, "Title")
+		meta.Authors = splitAuthors(pdfDictString(info, "Author"))
+	}
+
+	xmp := xmpMetadata(data)
+	if meta.Title == "" {
+		meta.Title = xmp.Title
+	}
+	if len(meta.Authors) == 0 {
+		meta.Authors = xmp.Authors
+	}
+	meta.Publisher = xmp.Publisher
+	meta.Language = xmp.Language
+	meta.ISBN = xmp.ISBN
+
+	meta.PageCount = pdfPageCount(data, objects)
+	return meta, nil
+}
+
+// pdfObjectStreams unpacks compressed object streams, keyed by object number. Newer files keep
+// the Info dictionary and page tree in these instead of the file body.
+func pdfObjectStreams(data []byte) map[int][]byte {
+	objects := make(map[int][]byte)
+	isObjStm := func(dict string) bool {
+		return strings.Contains(dict, "/Type /ObjStm") || strings.Contains(dict, "/Type/ObjStm")
+	}
+	for _, stream := range pdfStreams(data, isObjStm) {
+		n := pdfDictInt(stream.dict, "N")
+		first := pdfDictInt(stream.dict, "First")
+		if n <= 0 || first <= 0 || first > len(stream.data) {
+			continue
+		}
+		header := pdfObjHeader.FindAll(stream.data[:first], 2*n)
+		for i := 0; i+1 < len(header); i += 2 {
+			num := atoi(string(header[i]))
+			start := first + atoi(string(header[i+1]))
+			end := len(stream.data)
+			if i+3 < len(header) {
+				end = first + atoi(string(header[i+3]))
+			}
+			if start < end && end <= len(stream.data) {
+				objects[num] = stream.data[start:end]
+			}
+		}
+	}
+	return objects
+}
+
+// pdfInfoDict finds the object the trailer names as /Info. Incrementally updated files append
+// newer versions of objects so the last definition wins.
+func pdfInfoDict(data []byte, objects map[int][]byte) []byte {
+	refs := pdfInfoRef.FindAllSubmatch(data, -1)
+	if len(refs) == 0 {
+		return nil
+	}
+	ref := refs[len(refs)-1]
+	return pdfObject(data, objects, atoi(string(ref[1])), atoi(string(ref[2])))
+}
+
+// pdfObject returns the body of an object, from its last definition in the file or else from
+// an object stream, nil when it isn't defined.
+func pdfObject(data []byte, objects map[int][]byte, num int, gen int) []byte {
+	def := regexp.MustCompile(`(?:^|[^0-9])` + strconv.Itoa(num) + `\s+` + strconv.Itoa(gen) + `\s+obj\b`)
+	if locs := def.FindAllIndex(data, -1); len(locs) > 0 {
+		start := locs[len(locs)-1][1]
+		end := bytes.Index(data[start:], []byte("endobj"))
+		if end < 0 {
+			end = len(data) - start
+		}
+		return data[start : start+end]
+	}
+	return objects[num]
+}
+
+// pdfResolve follows an indirect reference to the value of the object it points at, any other
+// value is returned as it is.
+func pdfResolve(data []byte, objects map[int][]byte, value []byte) []byte {
+	m := pdfRef.FindSubmatch(value)
+	if m == nil {
+		return value
+	}
+	return pdfValue(pdfObject(data, objects, atoi(string(m[1])), atoi(string(m[2]))))
+}
+
+// pdfDictValue returns the raw value of a key of the outermost dictionary in dict, keys of
+// nested dictionaries are skipped. Dictionaries and arrays are returned whole.
+func pdfDictValue(dict []byte, key string) []byte {
+	name := []byte("/" + key)
+	depth, arrays := 0, 0
+	for i := 0; i < len(dict); {
+		c := dict[i]
+		switch {
+		case c == '(':
+			_, n := literalString(dict[i:])
+			i += n
+		case c == '<' && i+1 < len(dict) && dict[i+1] == '<':
+			depth++
+			i += 2
+		case c == '>' && i+1 < len(dict) && dict[i+1] == '>':
+			depth--
+			i += 2
+		case c == '<':
+			_, n := hexString(dict[i:])
+			i += n
+		case c == '[':
+			arrays++
+			i++
+		case c == ']':
+			arrays--
+			i++
+		case c == '/' && depth == 1 && arrays == 0 && bytes.HasPrefix(dict[i:], name):
+			end := i + len(name)
+			if end < len(dict) && !isPdfSpace(dict[end]) && !isPdfDelimiter(dict[end]) {
+				// a longer name sharing the prefix
+				i = end
+				continue
+			}
+			return pdfValue(dict[end:])
+		default:
+			i++
+		}
+	}
+	return nil
+}
+
+// pdfValue returns the value at the start of b: a dictionary or array with everything nested
+// in it, an indirect reference or a single token.
+func pdfValue(b []byte) []byte {
+	start := 0
+	for start < len(b) && isPdfSpace(b[start]) {
+		start++
+	}
+	if start == len(b) {
+		return nil
+	}
+	b = b[start:]
+	if loc := pdfRef.FindIndex(b); loc != nil {
+		return b[:loc[1]]
+	}
+	if b[0] == '(' {
+		_, n := literalString(b)
+		return b[:n]
+	}
+	if b[0] != '<' && b[0] != '[' {
+		end := 1
+		for end < len(b) && !isPdfSpace(b[end]) && !isPdfDelimiter(b[end]) {
+			end++
+		}
+		return b[:end]
+	}
+
+	depth := 0
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == '(':
+			_, n := literalString(b[i:])
+			i += n
+			continue
+		case c == '<' && i+1 < len(b) && b[i+1] == '<':
+			depth++
+			i += 2
+		case c == '>' && i+1 < len(b) && b[i+1] == '>':
+			depth--
+			i += 2
+		case c == '<':
+			_, n := hexString(b[i:])
+			i += n
+			continue
+		case c == '[':
+			depth++
+			i++
+		case c == ']':
+			depth--
+			i++
+		default:
+			i++
+			continue
+		}
+		if depth == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
+
+// pdfFirstPage follows the first kid of each node of the page tree down to the first page and
+// returns its dictionary with the resources it uses, which may be inherited from the nodes above.
+func pdfFirstPage(data []byte, objects map[int][]byte) (page []byte, resources []byte) {
+	refs := pdfRootRef.FindAllSubmatch(data, -1)
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	ref := refs[len(refs)-1]
+	catalog := pdfValue(pdfObject(data, objects, atoi(string(ref[1])), atoi(string(ref[2]))))
+	node := pdfResolve(data, objects, pdfDictValue(catalog, "Pages"))
+	// a malformed tree may loop, real ones are nowhere near this deep
+	for depth := 0; depth < 64 && node != nil; depth++ {
+		if r := pdfDictValue(node, "Resources"); r != nil {
+			resources = pdfResolve(data, objects, r)
+		}
+		kids := pdfResolve(data, objects, pdfDictValue(node, "Kids"))
+		if kids == nil {
+			return node, resources
+		}
+		first := pdfRefs.FindSubmatch(kids)
+		if first == nil {
+			return nil, nil
+		}
+		node = pdfValue(pdfObject(data, objects, atoi(string(first[1])), atoi(string(first[2]))))
+	}
+	return nil, nil
+}
+
+// pdfDictString returns a string entry of a dictionary, decoding literal and hex strings.
+func pdfDictString(dict []byte, key string) string {
+	name := []byte("/" + key)
+	for pos := 0; ; {
+		i := bytes.Index(dict[pos:], name)
+		if i < 0 {
+			return ""
+		}
+		pos += i + len(name)
+		if pos < len(dict) && !isPdfSpace(dict[pos]) && !isPdfDelimiter(dict[pos]) {
+			// a longer name sharing the prefix
+			continue
+		}
+		for pos < len(dict) && isPdfSpace(dict[pos]) {
+			pos++
+		}
+		if pos >= len(dict) {
+			return ""
+		}
+
+		var raw []byte
+		switch {
+		case dict[pos] == '(':
+			raw, _ = literalString(dict[pos:])
+		case dict[pos] == '<' && (pos+1 >= len(dict) || dict[pos+1] != '<'):
+			raw, _ = hexString(dict[pos:])
+		default:
+			// indirect references and other types are not followed
+			return ""
+		}
+		text, ok := pdfString(raw)
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(text)
+	}
+}
+
+func pdfDictInt(dict string, key string) int {
+	m := regexp.MustCompile(`/` + key + `\s+(\d+)`).FindStringSubmatch(dict)
+	if m == nil {
+		return 0
+	}
+	return atoi(m[1])
+}
+
+// pdfPageCount returns the largest /Count of any page tree node, which is the root's.
+func pdfPageCount(data []byte, objects map[int][]byte) int {
+	count := 0
+	check := func(body []byte) {
+		for _, loc := range pdfPagesType.FindAllIndex(body, -1) {
+			start := bytes.LastIndex(body[:loc[0]], []byte("<<"))
+			if start < 0 {
+				start = 0
+			}
+			end := bytes.Index(body[loc[1]:], []byte(">>"))
+			if end < 0 {
+				end = len(body) - loc[1]
+			}
+			if m := pdfCount.FindSubmatch(body[start : loc[1]+end]); m != nil {
+				if n := atoi(string(m[1])); n > count {
+					count = n
+				}
+			}
+		}
+	}
+	check(data)
+	for _, body := range objects {
+		check(body)
+	}
+	return count
+}
+
+// splitAuthors breaks an Info /Author value listing several people.
+func splitAuthors(value string) []string {
+	var authors []string
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '&' }) {
+		for _, name := range strings.Split(part, " and ") {
+			if name = strings.TrimSpace(name); name != "" {
+				authors = append(authors, name)
+			}
+		}
+	}
+	return authors
+}
+
+// xmpMetadata reads the dublin core properties of the XMP packet, which is usually stored
+// uncompressed but may sit in a flate encoded metadata stream.
+func xmpMetadata(data []byte) Metadata {
+	packet := xmpPacket(data)
+	if packet == nil {
+		isMetadata := func(dict string) bool {
+			return strings.Contains(dict, "/Type /Metadata") || strings.Contains(dict, "/Type/Metadata")
+		}
+		for _, stream := range pdfStreams(data, isMetadata) {
+			if packet = xmpPacket(stream.data); packet != nil {
+				break
+			}
+		}
+	}
+	if packet == nil {
+		return Metadata{}
+	}
+
+	values := make(map[string][]string)
+	d := xml.NewDecoder(bytes.NewReader(packet))
+	d.Strict = false
+	var stack []string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if text == "" {
+				continue
+			}
+			// values are either direct children or list items in rdf:Alt, rdf:Seq and rdf:Bag
+			for i := len(stack) - 1; i >= 0; i-- {
+				switch stack[i] {
+				case "li", "Alt", "Seq", "Bag":
+					continue
+				}
+				values[stack[i]] = append(values[stack[i]], text)
+				break
+			}
+		}
+	}
+
+	meta := Metadata{
+		Title:     first(values["title"]),
+		Authors:   values["creator"],
+		Publisher: first(values["publisher"]),
+		Language:  first(values["language"]),
+		ISBN:      normalizeISBN(first(values["isbn"])),
+	}
+	if meta.ISBN == "" {
+		for _, id := range values["identifier"] {
+			if isbn := normalizeISBN(id); isbn != "" {
+				meta.ISBN = isbn
+				break
+			}
+		}
+	}
+	return meta
+}
+
+func xmpPacket(data []byte) []byte {
+	start := bytes.Index(data, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return nil
+	}
+	end := bytes.Index(data[start:], []byte("</x:xmpmeta>"))
+	if end < 0 {
+		return nil
+	}
+	return data[start : start+end+len("</x:xmpmeta>")]
+}
@@ -0,0 +1,272 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func deflate(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pdfFixture numbers the objects from 1 and appends a trailer pointing at info when it is set.
+func pdfFixture(info int, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	if info > 0 {
+		fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\n", len(objects)+1, info)
+	}
+	b.WriteString("%%EOF\n")
+	return b.Bytes()
+}
+
+func pdfStreamObject(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func samplePdf(t *testing.T) []byte {
+	content := deflate(t, []byte("BT /F1 12 Tf 72 712 Td (Hello, World) Tj ET\nBT [(Second ) -250 (page)] TJ ET"))
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+		`<dc:publisher><rdf:Bag><rdf:li>Tor</rdf:li></rdf:Bag></dc:publisher>` +
+		`<dc:language><rdf:Bag><rdf:li>en</rdf:li></rdf:Bag></dc:language>` +
+		`<dc:identifier>urn:isbn:978-0-7653-1178-8</dc:identifier>` +
+		`</rdf:Description></rdf:RDF></x:xmpmeta>`
+	return pdfFixture(5,
+		"<< /Type /Catalog /Pages 2 0 R /Metadata 6 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 3 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		pdfStreamObject("/Filter /FlateDecode", content),
+		"<< /Title (The Name of the Wind) /Author (Patrick Rothfuss and Someone Else) >>",
+		pdfStreamObject("/Type /Metadata /Subtype /XML", []byte(xmp)),
+	)
+}
+
+func TestPdfText(t *testing.T) {
+	data := samplePdf(t)
+	text, err := Text(bytes.NewReader(data), int64(len(data)), MIMEPdf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"Hello, World", "Second page"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text %q missing %q", text, want)
+		}
+	}
+}
+
+func TestPdfMetadata(t *testing.T) {
+	data := samplePdf(t)
+	meta, err := ReadMetadata(bytes.NewReader(data), int64(len(data)), MIMEPdf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Metadata{
+		Title:     "The Name of the Wind",
+		Authors:   []string{"Patrick Rothfuss", "Someone Else"},
+		Publisher: "Tor",
+		Language:  "en",
+		ISBN:      "9780765311788",
+		PageCount: 3,
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("got %+v, want %+v", meta, want)
+	}
+}
+
+func TestPdfObjectStreamMetadata(t *testing.T) {
+	info := "<< /Title <FEFF0044007500620069006E> /Author (Ann Leckie; Becky Chambers) >>"
+	objects := fmt.Sprintf("5 0 6 %d ", len(info))
+	pages := "<< /Type /Pages /Kids [] /Count 12 >>"
+	body := deflate(t, []byte(objects+info+pages))
+	data := pdfFixture(5,
+		"<< /Type /Catalog /Pages 6 0 R >>",
+		pdfStreamObject(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(objects)), body),
+	)
+
+	meta, err := ReadMetadata(bytes.NewReader(data), int64(len(data)), MIMEPdf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Title != "Dubin" {
+		t.Errorf("title = %q, want Dubin", meta.Title)
+	}
+	if want := []string{"Ann Leckie", "Becky Chambers"}; !reflect.DeepEqual(meta.Authors, want) {
+		t.Errorf("authors = %q, want %q", meta.Authors, want)
+	}
+	if meta.PageCount != 12 {
+		t.Errorf("page count = %d, want 12", meta.PageCount)
+	}
+}
+
+func TestPdfMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"empty", nil, true},
+		{"not a pdf", []byte("PK\x03\x04 not a pdf"), true},
+		{"header only", []byte("%PDF-1.7\n"), false},
+		{"missing endstream", []byte("%PDF-1.4\n1 0 obj\n<< /Length 10 >>\nstream\nBT (Hi) Tj"), false},
+		{"stream without object", []byte("%PDF-1.4\nstream\nBT (Hi) Tj ET\nendstream\n"), false},
+		{"corrupt flate", pdfFixture(0, pdfStreamObject("/Filter /FlateDecode", []byte("x\x9cnot flate at all"))), false},
+		{"unsupported filter", pdfFixture(0, pdfStreamObject("/Filter /LZWDecode", []byte("\x80\x0b\x60\x50"))), false},
+		{"unterminated string", pdfFixture(0, pdfStreamObject("", []byte("BT (never closed Tj ET"))), false},
+		{"unterminated dictionary", []byte("%PDF-1.4\ntrailer\n<< /Info 1 0 R"), false},
+		{"dangling info reference", pdfFixture(9, "<< /Type /Catalog >>"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.data)
+			size := int64(len(tt.data))
+			if _, err := Text(r, size, MIMEPdf); (err != nil) != tt.wantErr {
+				t.Errorf("Text error = %v, want error %v", err, tt.wantErr)
+			}
+			if _, err := ReadMetadata(r, size, MIMEPdf); (err != nil) != tt.wantErr {
+				t.Errorf("ReadMetadata error = %v, want error %v", err, tt.wantErr)
+			}
+			if _, err := Cover(r, size, MIMEPdf); err == nil {
+				t.Error("Cover found an image in a file without one")
+			}
+		})
+	}
+}
+
+func TestPdfTruncated(t *testing.T) {
+	data := samplePdf(t)
+	for n := 0; n < len(data); n++ {
+		r := bytes.NewReader(data[:n])
+		// every prefix has to be handled without panicking, the result itself doesn't matter
+		Text(r, int64(n), MIMEPdf)
+		ReadMetadata(r, int64(n), MIMEPdf)
+		Cover(r, int64(n), MIMEPdf)
+	}
+}
+
+func TestInflateLimit(t *testing.T) {
+	if out, ok := inflate(deflate(t, make([]byte, 1024))); !ok || len(out) != 1024 {
+		t.Errorf("inflate = %d bytes, %v, want 1024 bytes", len(out), ok)
+	}
+	if _, ok := inflate(deflate(t, make([]byte, maxDecodedSize+1))); ok {
+		t.Error("inflate accepted a stream larger than maxDecodedSize")
+	}
+
+	data := pdfFixture(0, pdfStreamObject("/Filter /FlateDecode", deflate(t, append(make([]byte, maxDecodedSize), "BT (bomb) Tj ET"...))))
+	text, err := Text(bytes.NewReader(data), int64(len(data)), MIMEPdf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(text, "bomb") {
+		t.Error("text was extracted from a stream over the limit")
+	}
+}
+
+func pdfGrayImage(width int, height int) string {
+	return pdfStreamObject(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8", width, height),
+		make([]byte, width*height))
+}
+
+func TestPdfCover(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []string
+		width   int // zero when there should be no cover
+	}{
+		{
+			name: "image drawn on the first page",
+			objects: []string{
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+				"<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im1 5 0 R /Unused 8 0 R >> >> /Contents 6 0 R >>",
+				"<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im2 7 0 R >> >> /Contents 9 0 R >>",
+				pdfGrayImage(120, 160),
+				pdfStreamObject("", []byte("q 120 0 0 160 0 0 cm /Im1 Do Q")),
+				pdfGrayImage(200, 300),
+				pdfGrayImage(240, 360),
+				pdfStreamObject("", []byte("q /Im2 Do Q")),
+			},
+			width: 120,
+		},
+		{
+			name: "only later pages have images",
+			objects: []string{
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+				"<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im1 6 0 R >> >> /Contents 7 0 R >>",
+				pdfStreamObject("", []byte("BT (Abstract) Tj ET")),
+				pdfGrayImage(200, 300),
+				pdfStreamObject("", []byte("/Im1 Do")),
+			},
+		},
+		{
+			name: "inherited resources and content array",
+			objects: []string{
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources 4 0 R >>",
+				"<< /Type /Page /Parent 2 0 R /Contents [5 0 R 6 0 R] >>",
+				"<< /XObject << /Small 7 0 R /Cover 8 0 R >> >>",
+				pdfStreamObject("/Filter /FlateDecode", deflate(t, []byte("q /Small Do Q"))),
+				pdfStreamObject("", []byte("q /Cover Do Q")),
+				pdfGrayImage(110, 110),
+				pdfGrayImage(150, 220),
+			},
+			width: 150,
+		},
+		{
+			name: "indirect content array",
+			objects: []string{
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Resources << /XObject << /Im0 5 0 R >> >> /Contents 4 0 R >>",
+				"[6 0 R]",
+				pdfGrayImage(130, 200),
+				pdfStreamObject("", []byte("/Im0 Do")),
+			},
+			width: 130,
+		},
+		{
+			name: "page tree loops",
+			objects: []string{
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [2 0 R] /Count 1 >>",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := pdfFixture(0, tt.objects...)
+			data = append(data, "trailer\n<< /Root 1 0 R >>\n"...)
+			img, err := Cover(bytes.NewReader(data), int64(len(data)), MIMEPdf)
+			if tt.width == 0 {
+				if err != ErrNoCover {
+					t.Errorf("error = %v, want %v", err, ErrNoCover)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w := img.Bounds().Dx(); w != tt.width {
+				t.Errorf("cover is %d wide, want %d", w, tt.width)
+			}
+		})
+	}
+}
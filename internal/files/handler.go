@@ -0,0 +1,52 @@
+package files
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+)
+
+// MakeFileHandler serves files from storage that signs its own urls, such as local disk.
+func MakeFileHandler(mr *mux.Router, storage *common.BucketStorage) http.Handler {
+	r := mr.PathPrefix("/files").Subrouter()
+
+	h := &fileHandler{
+		storage: storage,
+	}
+
+	r.HandleFunc("/", h.Download).Methods("GET")
+
+	return r
+}
+
+type fileHandler struct {
+	storage *common.BucketStorage
+}
+
+func (h *fileHandler) Download(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	key, err := h.storage.KeyFromSignedURL(ctx, r.URL)
+	if err == common.ErrSignedURLUnsupported {
+		common.MakeError(w, http.StatusNotFound, "file", "Not Found", "download")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusForbidden, "file", "Invalid or expired link", "download")
+		return
+	}
+
+	reader, err := h.storage.Bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		common.MakeError(w, http.StatusNotFound, "file", "Not Found", "download")
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", reader.ContentType())
+	if _, err := io.Copy(w, reader); err != nil {
+		logrus.WithError(err).WithField("key", key).Error("unable to write file")
+	}
+}
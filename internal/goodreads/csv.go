@@ -0,0 +1,339 @@
+package goodreads
+
+import (
+	"encoding/csv"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts of reading history CSV files.
+const (
+	FormatGoodreads  = "goodreads"
+	FormatStoryGraph = "storygraph"
+)
+
+var formats = map[string]bool{FormatGoodreads: true, FormatStoryGraph: true}
+
+var goodreadsColumns = []string{"Book Id", "Title", "Author", "Author l-f", "Additional Authors", "ISBN", "ISBN13",
+	"My Rating", "Average Rating", "Publisher", "Binding", "Number of Pages", "Year Published", "Original Publication Year",
+	"Date Read", "Date Added", "Bookshelves", "Bookshelves with positions", "Exclusive Shelf", "My Review", "Spoiler",
+	"Private Notes", "Read Count", "Owned Copies"}
+
+var storyGraphColumns = []string{"Title", "Authors", "Contributors", "ISBN/UID", "Format", "Read Status", "Date Added",
+	"Last Date Read", "Dates Read", "Read Count", "Moods", "Pace", "Character- or Plot-Driven?",
+	"Strong Character Development?", "Loveable Characters?", "Diverse Characters?", "Flawed Characters?", "Star Rating",
+	"Review", "Content Warnings", "Content Warning Description", "Tags", "Owned?"}
+
+// dateFormat is how both sites write dates.
+const dateFormat = "2006/01/02"
+
+// shelfStatus maps the shelves that say how far a book has been read onto reading status, the
+// rest are kept as tags.
+var shelfStatus = map[string]progress.Status{
+	"to-read":           progress.StatusWantToRead,
+	"currently-reading": progress.StatusReading,
+	"paused":            progress.StatusReading,
+	"read":              progress.StatusFinished,
+	"did-not-finish":    progress.StatusAbandoned,
+	"dnf":               progress.StatusAbandoned,
+	"abandoned":         progress.StatusAbandoned,
+}
+
+var statusShelf = map[progress.Status]string{
+	progress.StatusWantToRead: "to-read",
+	progress.StatusReading:    "currently-reading",
+	progress.StatusFinished:   "read",
+	progress.StatusAbandoned:  "did-not-finish",
+}
+
+// Entry is a book in a reading history file.
+type Entry struct {
+	Title     string          `json:"title"`
+	Authors   []string        `json:"authors"`
+	ISBN      string          `json:"isbn"`
+	Publisher string          `json:"publisher"`
+	PageCount int             `json:"page_count"`
+	Rating    float64         `json:"rating"`
+	Status    progress.Status `json:"status"` // empty when the book isn't on a reading shelf
+	Shelves   []string        `json:"shelves"`
+	Review    string          `json:"review"`
+	Added     *time.Time      `json:"added"`
+	Started   *time.Time      `json:"started"`
+	Read      *time.Time      `json:"read"`
+
+	owned bool // has a file, only known on export
+}
+
+// Author is the first author of the book, the one matches are made on.
+func (e *Entry) Author() string {
+	if len(e.Authors) == 0 {
+		return ""
+	}
+	return e.Authors[0]
+}
+
+// readEntries parses a Goodreads or StoryGraph export, telling them apart by their columns.
+func readEntries(r io.Reader) (string, []*Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return "", nil, ErrNoEntries
+	}
+	if err != nil {
+		return "", nil, ErrInvalidFile
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	format := ""
+	switch {
+	case hasColumn(index, "Exclusive Shelf"):
+		format = FormatGoodreads
+	case hasColumn(index, "Read Status"):
+		format = FormatStoryGraph
+	default:
+		return "", nil, ErrInvalidFile
+	}
+
+	var entries []*Entry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, ErrInvalidFile
+		}
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		var entry *Entry
+		if format == FormatGoodreads {
+			entry = goodreadsEntry(field)
+		} else {
+			entry = storyGraphEntry(field)
+		}
+		if entry.Title != "" {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return format, nil, ErrNoEntries
+	}
+	return format, entries, nil
+}
+
+func hasColumn(index map[string]int, name string) bool {
+	_, ok := index[name]
+	return ok
+}
+
+func goodreadsEntry(field func(string) string) *Entry {
+	e := &Entry{
+		Title:     field("Title"),
+		Authors:   splitList(field("Author") + "," + field("Additional Authors")),
+		ISBN:      unquoteISBN(field("ISBN13")),
+		Publisher: field("Publisher"),
+		PageCount: atoi(field("Number of Pages")),
+		Rating:    parseFloat(field("My Rating")),
+		Status:    shelfStatus[field("Exclusive Shelf")],
+		Review:    strings.NewReplacer("<br/>", "\n", "<br />", "\n", "<br>", "\n").Replace(field("My Review")),
+		Added:     parseDate(field("Date Added")),
+		Read:      parseDate(field("Date Read")),
+	}
+	if e.ISBN == "" {
+		e.ISBN = unquoteISBN(field("ISBN"))
+	}
+	for _, shelf := range splitList(field("Bookshelves")) {
+		if _, ok := shelfStatus[shelf]; !ok {
+			e.Shelves = append(e.Shelves, shelf)
+		}
+	}
+	return e
+}
+
+func storyGraphEntry(field func(string) string) *Entry {
+	e := &Entry{
+		Title:   field("Title"),
+		Authors: splitList(field("Authors")),
+		ISBN:    unquoteISBN(field("ISBN/UID")),
+		Rating:  parseFloat(field("Star Rating")),
+		Status:  shelfStatus[field("Read Status")],
+		Shelves: splitList(field("Tags")),
+		Review:  field("Review"),
+		Added:   parseDate(field("Date Added")),
+		Read:    parseDate(field("Last Date Read")),
+	}
+	// the latest of the reads, written as start-end
+	if reads := splitList(field("Dates Read")); len(reads) > 0 {
+		if dates := strings.SplitN(reads[len(reads)-1], "-", 2); len(dates) == 2 {
+			e.Started = parseDate(dates[0])
+		}
+	}
+	return e
+}
+
+// writeEntries writes entries in the layout of the given site so they can be imported there.
+func writeEntries(w io.Writer, format string, entries []*Entry) error {
+	cw := csv.NewWriter(w)
+	columns, row := goodreadsColumns, goodreadsRow
+	if format == FormatStoryGraph {
+		columns, row = storyGraphColumns, storyGraphRow
+	}
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := cw.Write(row(e)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func goodreadsRow(e *Entry) []string {
+	author, additional := "", ""
+	if len(e.Authors) > 0 {
+		author, additional = e.Authors[0], strings.Join(e.Authors[1:], ", ")
+	}
+	isbn10, isbn13 := "", ""
+	switch len(e.ISBN) {
+	case 10:
+		isbn10 = e.ISBN
+	case 13:
+		isbn13 = e.ISBN
+	}
+	readCount := "0"
+	if e.Status == progress.StatusFinished {
+		readCount = "1"
+	}
+	shelf := statusShelf[e.Status]
+	if shelf == "" {
+		shelf = "to-read"
+	}
+	return []string{"", e.Title, author, lastFirst(author), additional, `="` + isbn10 + `"`, `="` + isbn13 + `"`,
+		strconv.Itoa(int(math.Round(e.Rating))), "", e.Publisher, "", itoa(e.PageCount), "", "",
+		formatDate(e.Read), formatDate(e.Added), strings.Join(e.Shelves, ", "), "", shelf,
+		strings.Replace(e.Review, "\n", "<br/>", -1), "", "", readCount, ownedCopies(e)}
+}
+
+func storyGraphRow(e *Entry) []string {
+	datesRead := ""
+	if e.Started != nil && e.Read != nil {
+		datesRead = formatDate(e.Started) + "-" + formatDate(e.Read)
+	}
+	readCount := "0"
+	if e.Status == progress.StatusFinished {
+		readCount = "1"
+	}
+	rating := ""
+	if e.Rating > 0 {
+		rating = strconv.FormatFloat(e.Rating, 'f', -1, 64)
+	}
+	owned := "No"
+	if ownedCopies(e) == "1" {
+		owned = "Yes"
+	}
+	return []string{e.Title, strings.Join(e.Authors, ", "), "", e.ISBN, "", statusShelf[e.Status], formatDate(e.Added),
+		formatDate(e.Read), datesRead, readCount, "", "", "", "", "", "", "", rating,
+		e.Review, "", "", strings.Join(e.Shelves, ", "), owned}
+}
+
+// ownedCopies is set on export from whether the document has a file, placeholders aren't owned.
+func ownedCopies(e *Entry) string {
+	if e.owned {
+		return "1"
+	}
+	return "0"
+}
+
+// lastFirst writes an author the way Goodreads sorts them, "Jane Doe" as "Doe, Jane". Names
+// already written that way are left alone.
+func lastFirst(author string) string {
+	i := strings.LastIndex(author, " ")
+	if i < 0 || strings.Contains(author, ",") {
+		return author
+	}
+	return author[i+1:] + ", " + author[:i]
+}
+
+// unquoteISBN strips the spreadsheet formula Goodreads wraps ISBNs in, ="0306406152".
+func unquoteISBN(v string) string {
+	v = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(v, "="), `"`), `"`)
+	return normalizeISBN(v)
+}
+
+func normalizeISBN(v string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(v))
+}
+
+// isbn13 converts an ISBN-10 so either form of the same book compares equal.
+func isbn13(isbn string) string {
+	isbn = normalizeISBN(isbn)
+	if len(isbn) != 10 {
+		return isbn
+	}
+	digits := "978" + isbn[:9]
+	sum := 0
+	for i, c := range digits {
+		d := int(c - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return digits + strconv.Itoa((10-sum%10)%10)
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseDate(v string) *time.Time {
+	t, err := time.Parse(dateFormat, strings.TrimSpace(v))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(dateFormat)
+}
+
+func parseFloat(v string) float64 {
+	f, _ := strconv.ParseFloat(v, 64)
+	return f
+}
+
+func atoi(v string) int {
+	i, _ := strconv.Atoi(v)
+	return i
+}
+
+func itoa(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
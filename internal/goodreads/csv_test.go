@@ -0,0 +1,197 @@
+package goodreads
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const goodreadsSample = "\ufeffBook Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Publisher,Binding,Number of Pages,Year Published,Original Publication Year,Date Read,Date Added,Bookshelves,Bookshelves with positions,Exclusive Shelf,My Review,Spoiler,Private Notes,Read Count,Owned Copies\n" +
+	`234225,Dune,Frank Herbert,"Herbert, Frank",,"=""0441013597""","=""9780441013593""",5,4.27,Ace Books,Paperback,604,2005,1965,2021/03/14,2020/12/01,"sci-fi, favourites","sci-fi (#3), favourites (#1)",read,"Fear is the mind-killer.<br/>Still holds up.",,,1,0` + "\n" +
+	`18007564,The Martian,Andy Weir,"Weir, Andy",,"=""""","=""9780553418026""",0,4.41,Crown,Hardcover,387,2014,2011,,2022/01/09,currently-reading,currently-reading (#2),currently-reading,,,,0,0` + "\n" +
+	`11,Good Omens,Terry Pratchett,"Pratchett, Terry",Neil Gaiman,"=""0060853980""","=""""",4,4.25,William Morrow,Paperback,491,2006,1990,,2019/07/30,"to-read, humour","to-read (#9), humour (#1)",to-read,,,,0,0` + "\n"
+
+const storyGraphSample = "Title,Authors,Contributors,ISBN/UID,Format,Read Status,Date Added,Last Date Read,Dates Read,Read Count,Moods,Pace,Character- or Plot-Driven?,Strong Character Development?,Loveable Characters?,Diverse Characters?,Flawed Characters?,Star Rating,Review,Content Warnings,Content Warning Description,Tags,Owned?\n" +
+	`Piranesi,Susanna Clarke,,9781635575637,hardcover,read,2021/01/02,2021/02/20,"2021/01/15-2021/02/02, 2021/02/10-2021/02/20",2,mysterious,medium,A mix,Yes,Yes,No,Yes,4.5,"A house of endless halls.",,,"fantasy, re-read",Yes` + "\n" +
+	`The Fifth Season,"N. K. Jemisin, Someone Else",,9780316229296,paperback,did-not-finish,2020/05/05,,,0,,,,,,,,,,,,,No` + "\n" +
+	`Untitled Draft,,,,,to-read,,,,0,,,,,,,,,,,,,No` + "\n"
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestReadGoodreads(t *testing.T) {
+	format, entries, err := readEntries(strings.NewReader(goodreadsSample))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if format != FormatGoodreads {
+		t.Errorf("format = %s, want %s", format, FormatGoodreads)
+	}
+	want := []*Entry{
+		{
+			Title:     "Dune",
+			Authors:   []string{"Frank Herbert"},
+			ISBN:      "9780441013593",
+			Publisher: "Ace Books",
+			PageCount: 604,
+			Rating:    5,
+			Status:    progress.StatusFinished,
+			Shelves:   []string{"sci-fi", "favourites"},
+			Review:    "Fear is the mind-killer.\nStill holds up.",
+			Added:     date(2020, time.December, 1),
+			Read:      date(2021, time.March, 14),
+		},
+		{
+			Title:     "The Martian",
+			Authors:   []string{"Andy Weir"},
+			ISBN:      "9780553418026",
+			Publisher: "Crown",
+			PageCount: 387,
+			Status:    progress.StatusReading,
+			Added:     date(2022, time.January, 9),
+		},
+		{
+			Title:     "Good Omens",
+			Authors:   []string{"Terry Pratchett", "Neil Gaiman"},
+			ISBN:      "0060853980",
+			Publisher: "William Morrow",
+			PageCount: 491,
+			Rating:    4,
+			Status:    progress.StatusWantToRead,
+			Shelves:   []string{"humour"},
+			Added:     date(2019, time.July, 30),
+		},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %s, want %s", dump(entries), dump(want))
+	}
+}
+
+func TestReadStoryGraph(t *testing.T) {
+	format, entries, err := readEntries(strings.NewReader(storyGraphSample))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if format != FormatStoryGraph {
+		t.Errorf("format = %s, want %s", format, FormatStoryGraph)
+	}
+	want := []*Entry{
+		{
+			Title:   "Piranesi",
+			Authors: []string{"Susanna Clarke"},
+			ISBN:    "9781635575637",
+			Rating:  4.5,
+			Status:  progress.StatusFinished,
+			Shelves: []string{"fantasy", "re-read"},
+			Review:  "A house of endless halls.",
+			Added:   date(2021, time.January, 2),
+			Started: date(2021, time.February, 10),
+			Read:    date(2021, time.February, 20),
+		},
+		{
+			Title:   "The Fifth Season",
+			Authors: []string{"N. K. Jemisin", "Someone Else"},
+			ISBN:    "9780316229296",
+			Status:  progress.StatusAbandoned,
+			Added:   date(2020, time.May, 5),
+		},
+		{
+			Title:  "Untitled Draft",
+			Status: progress.StatusWantToRead,
+		},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %s, want %s", dump(entries), dump(want))
+	}
+}
+
+// TestRoundTrip exports what was imported from each site and imports the export again, every
+// field the layout has a column for has to come back the same.
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample string
+		format string
+		lost   func(e *Entry) // clears what the export format has no column for
+	}{
+		{"goodreads", goodreadsSample, FormatGoodreads, func(e *Entry) {}},
+		{"storygraph", storyGraphSample, FormatStoryGraph, func(e *Entry) {}},
+		{"goodreads to storygraph", goodreadsSample, FormatStoryGraph, func(e *Entry) {
+			e.Publisher, e.PageCount = "", 0
+		}},
+		{"storygraph to goodreads", storyGraphSample, FormatGoodreads, func(e *Entry) {
+			e.Started = nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, entries, err := readEntries(strings.NewReader(tt.sample))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := writeEntries(&buf, tt.format, entries); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			format, got, err := readEntries(&buf)
+			if err != nil {
+				t.Fatalf("unable to read export: %v", err)
+			}
+			if format != tt.format {
+				t.Errorf("export read as %s, want %s", format, tt.format)
+			}
+
+			for _, e := range entries {
+				tt.lost(e)
+				if tt.format == FormatGoodreads {
+					// Goodreads ratings are whole stars
+					e.Rating = float64(int(e.Rating + 0.5))
+				}
+			}
+			if !reflect.DeepEqual(got, entries) {
+				t.Errorf("got %s, want %s", dump(got), dump(entries))
+			}
+		})
+	}
+}
+
+func TestWriteGoodreadsRow(t *testing.T) {
+	e := &Entry{
+		Title:   "Good Omens",
+		Authors: []string{"Terry Pratchett", "Neil Gaiman"},
+		ISBN:    "0060853980",
+		Rating:  3.5,
+		Status:  progress.StatusFinished,
+		Review:  "line one\nline two",
+		Read:    date(2021, time.March, 14),
+		owned:   true,
+	}
+	var buf bytes.Buffer
+	if err := writeEntries(&buf, FormatGoodreads, []*Entry{e}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want a header and a row", len(lines))
+	}
+	want := `,Good Omens,Terry Pratchett,"Pratchett, Terry",Neil Gaiman,"=""0060853980""","=""""",4,,,,,,,2021/03/14,,,,read,line one<br/>line two,,,1,1`
+	if lines[1] != want {
+		t.Errorf("got  %s\nwant %s", lines[1], want)
+	}
+}
+
+// dump prints entries with their pointers followed so a failure shows the dates.
+func dump(entries []*Entry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\n\t%+v added %s started %s read %s", *e, formatDate(e.Added), formatDate(e.Started), formatDate(e.Read))
+	}
+	return b.String()
+}
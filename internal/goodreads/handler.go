@@ -0,0 +1,97 @@
+package goodreads
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/sirupsen/logrus"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+func MakeGoodreadsHandler(mr *mux.Router, service GoodreadsService) http.Handler {
+	h := &goodreadsHandler{
+		service: service,
+	}
+
+	mr.HandleFunc("/books/import/csv", h.Import).Methods("POST")
+	mr.HandleFunc("/books/export/csv", h.Export).Methods("GET")
+
+	return mr
+}
+
+type goodreadsHandler struct {
+	service GoodreadsService
+}
+
+// Import takes a Goodreads or StoryGraph export in the file field. Books the import couldn't
+// match can be resolved by sending matches, a JSON object of titles to document ids, with the
+// same file. Unmatched books are added as placeholders unless placeholders is false.
+func (h *goodreadsHandler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		common.MakeError(w, http.StatusBadRequest, "goodreads", "Unable to parse form", "import")
+		return
+	}
+	defer file.Close()
+
+	opts := ImportOptions{Matches: map[string]string{}, Placeholders: true}
+	if v := r.FormValue("matches"); v != "" {
+		if err := json.Unmarshal([]byte(v), &opts.Matches); err != nil {
+			logrus.WithError(err).Error("unable to unmarshal matches")
+			common.MakeError(w, http.StatusBadRequest, "goodreads", "Invalid matches", "import")
+			return
+		}
+	}
+	if v := r.FormValue("placeholders"); v != "" {
+		if opts.Placeholders, err = strconv.ParseBool(v); err != nil {
+			common.MakeError(w, http.StatusBadRequest, "goodreads", "Invalid placeholders", "import")
+			return
+		}
+	}
+
+	result, err := h.service.Import(ctx, file, opts)
+	switch err {
+	case nil:
+	case ErrInvalidFile, ErrNoEntries:
+		common.MakeError(w, http.StatusBadRequest, "goodreads", err.Error(), "import")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "goodreads", "Server Error", "import")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, result)
+}
+
+// Export downloads the library as a CSV file in the layout given by format, Goodreads by default.
+func (h *goodreadsHandler) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatGoodreads
+	}
+
+	buf := &bytes.Buffer{}
+	err := h.service.Export(ctx, buf, format)
+	switch err {
+	case nil:
+	case ErrInvalidFormat:
+		common.MakeError(w, http.StatusBadRequest, "goodreads", err.Error(), "export")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "goodreads", "Server Error", "export")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": format + "_library_export.csv"}))
+	if _, err := io.Copy(w, buf); err != nil {
+		logrus.WithError(err).Warn("unable to write export")
+	}
+}
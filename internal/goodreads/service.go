@@ -0,0 +1,266 @@
+package goodreads
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/progress"
+	"github.com/holmes89/book-organizer/internal/search"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Reasons an entry couldn't be imported.
+const (
+	ReasonNoMatch         = "no matching document"
+	ReasonAmbiguous       = "more than one document matches"
+	ReasonUnknownDocument = "matched document not found"
+)
+
+var (
+	ErrInvalidFile   = errors.New("not a goodreads or storygraph export")
+	ErrNoEntries     = errors.New("no books found")
+	ErrInvalidFormat = errors.New("invalid export format")
+)
+
+// ImportOptions control how entries find their documents. Matches maps titles, as written in the
+// file, to document ids and takes precedence over matching. Without Placeholders entries that
+// match no document are reported instead of being added without a file.
+type ImportOptions struct {
+	Matches      map[string]string
+	Placeholders bool
+}
+
+// Import reports what an import of a reading history file did.
+type Import struct {
+	Format       string            `json:"format"`
+	Entries      int               `json:"entries"`
+	Updated      int               `json:"updated"`
+	Placeholders int               `json:"placeholders"`
+	Matched      []*EntryMatch     `json:"matched"`
+	Unmatched    []*UnmatchedEntry `json:"unmatched"`
+}
+
+// EntryMatch is a book in the file and the document its history was added to.
+type EntryMatch struct {
+	Title       string  `json:"title"`
+	DocumentID  string  `json:"document_id"`
+	Score       float64 `json:"score"`
+	Placeholder bool    `json:"placeholder"` // the document was added for the entry
+}
+
+// UnmatchedEntry is a book that wasn't imported, it can be matched by hand by importing the file
+// again with the title mapped to a document id.
+type UnmatchedEntry struct {
+	*Entry
+	Reason     string                   `json:"reason"`
+	DocumentID string                   `json:"document_id,omitempty"`
+	Candidates []*search.MatchCandidate `json:"candidates,omitempty"`
+}
+
+type GoodreadsService interface {
+	Import(ctx context.Context, r io.Reader, opts ImportOptions) (*Import, error)
+	Export(ctx context.Context, w io.Writer, format string) error
+}
+
+type goodreadsService struct {
+	docService      documents.DocumentService
+	progressService progress.ProgressService
+	tagService      tags.TagService
+}
+
+func NewGoodreadsService(docService documents.DocumentService, progressService progress.ProgressService, tagService tags.TagService) GoodreadsService {
+	return &goodreadsService{
+		docService:      docService,
+		progressService: progressService,
+		tagService:      tagService,
+	}
+}
+
+// Import carries the shelves, ratings, read dates and reviews of a Goodreads or StoryGraph export
+// over to the documents the books match, by ISBN and then by title and author. Importing a
+// file again updates the same documents.
+func (s *goodreadsService) Import(ctx context.Context, r io.Reader, opts ImportOptions) (*Import, error) {
+	format, entries, err := readEntries(r)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.docService.FindAll(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]*documents.Document{}
+	byISBN := map[string]*documents.Document{}
+	for _, doc := range docs {
+		byID[doc.ID] = doc
+		if doc.ISBN != "" {
+			byISBN[isbn13(doc.ISBN)] = doc
+		}
+	}
+
+	result := &Import{Format: format, Entries: len(entries), Matched: []*EntryMatch{}, Unmatched: []*UnmatchedEntry{}}
+	for _, entry := range entries {
+		var doc *documents.Document
+		var candidates []*search.MatchCandidate
+		score, reason, created := 1.0, "", false
+		if id, ok := opts.Matches[entry.Title]; ok {
+			if doc = byID[id]; doc == nil {
+				reason = ReasonUnknownDocument
+			}
+		} else if doc = byISBN[isbn13(entry.ISBN)]; doc == nil {
+			doc, score, candidates = search.MatchDocument(entry.Title, entry.Author(), docs)
+			if doc == nil {
+				reason = ReasonNoMatch
+				if len(candidates) > 1 && candidates[0].Score >= search.MatchThreshold {
+					reason = ReasonAmbiguous
+				}
+			}
+		}
+		if doc == nil && reason == ReasonNoMatch && opts.Placeholders {
+			if doc, err = s.placeholder(ctx, entry); err != nil {
+				return nil, err
+			}
+			score, created = 1, true
+			result.Placeholders++
+			// later rows for the same book update this document
+			docs = append(docs, doc)
+			if doc.ISBN != "" {
+				byISBN[isbn13(doc.ISBN)] = doc
+			}
+		}
+		if doc == nil {
+			result.Unmatched = append(result.Unmatched, &UnmatchedEntry{Entry: entry, Reason: reason, DocumentID: opts.Matches[entry.Title], Candidates: candidates})
+			continue
+		}
+
+		if err := s.apply(ctx, doc, entry); err != nil {
+			return nil, err
+		}
+		if !created {
+			result.Updated++
+		}
+		result.Matched = append(result.Matched, &EntryMatch{Title: entry.Title, DocumentID: doc.ID, Score: score, Placeholder: created})
+	}
+	logrus.WithFields(logrus.Fields{"format": format, "entries": result.Entries, "updated": result.Updated, "placeholders": result.Placeholders, "unmatched": len(result.Unmatched)}).Info("reading history imported")
+	return result, nil
+}
+
+// placeholder adds a document without a file for a book that isn't in the catalog.
+func (s *goodreadsService) placeholder(ctx context.Context, entry *Entry) (*documents.Document, error) {
+	doc := &documents.Document{
+		Type:      "book",
+		Title:     entry.Title,
+		Authors:   entry.Authors,
+		ISBN:      entry.ISBN,
+		Publisher: entry.Publisher,
+		PageCount: entry.PageCount,
+	}
+	if err := s.docService.AddPlaceholder(ctx, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// apply copies the history of an entry onto its document. Shelves that aren't reading status
+// become tags.
+func (s *goodreadsService) apply(ctx context.Context, doc *documents.Document, entry *Entry) error {
+	update := documents.Document{Review: entry.Review}
+	// Goodreads only has whole stars, a half star rating exported there comes back rounded
+	if entry.Rating > 0 && entry.Rating <= documents.MaxRating && entry.Rating != math.Round(doc.Rating) {
+		update.Rating = entry.Rating
+	}
+	if update.Review != "" || update.Rating != 0 {
+		if _, err := s.docService.UpdateFields(ctx, doc.ID, update); err != nil {
+			return errors.Wrap(err, "unable to update document")
+		}
+	}
+
+	for _, name := range entry.Shelves {
+		if err := s.tagService.Attach(ctx, doc.ID, &tags.Tag{Name: name}); err != nil {
+			return err
+		}
+	}
+
+	if entry.Status == "" {
+		return nil
+	}
+	p := progress.Progress{Status: entry.Status, Started: entry.Started, Finished: entry.Read}
+	if p.Started == nil && entry.Status != progress.StatusWantToRead {
+		// Goodreads doesn't export when a book was started, the day it was shelved is the closest
+		p.Started = entry.Added
+		if p.Started != nil && p.Finished != nil && p.Finished.Before(*p.Started) {
+			p.Started = p.Finished
+		}
+	}
+	if p.Finished == nil && entry.Status == progress.StatusFinished {
+		p.Finished = p.Started
+	}
+	if _, err := s.progressService.Update(ctx, doc.ID, p); err != nil {
+		return errors.Wrap(err, "unable to update progress")
+	}
+	return nil
+}
+
+// Export writes every book in the layout of the given site, books without a reading status are
+// on the to-read shelf as that is where either site puts a new book.
+func (s *goodreadsService) Export(ctx context.Context, w io.Writer, format string) error {
+	if !formats[format] {
+		return ErrInvalidFormat
+	}
+	docs, err := s.docService.FindAll(ctx, map[string]interface{}{"type": "book"})
+	if err != nil {
+		return err
+	}
+	progressList, err := s.progressService.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	byDocument := map[string]*progress.Progress{}
+	for _, p := range progressList {
+		byDocument[p.DocumentID] = p
+	}
+	tagList, err := s.tagService.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	tagNames := map[string]string{}
+	for _, tag := range tagList {
+		tagNames[tag.ID] = tag.Name
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return strings.ToLower(docs[i].DisplayName) < strings.ToLower(docs[j].DisplayName)
+	})
+	entries := make([]*Entry, 0, len(docs))
+	for _, doc := range docs {
+		entry := &Entry{
+			Title:     doc.Title,
+			Authors:   doc.Authors,
+			ISBN:      normalizeISBN(doc.ISBN),
+			Publisher: doc.Publisher,
+			PageCount: doc.PageCount,
+			Rating:    doc.Rating,
+			Review:    doc.Review,
+			Added:     &doc.Created,
+			owned:     !doc.IsPlaceholder(),
+		}
+		if entry.Title == "" {
+			entry.Title = doc.DisplayName
+		}
+		if p, ok := byDocument[doc.ID]; ok {
+			entry.Status, entry.Started, entry.Read = p.Status, p.Started, p.Finished
+		}
+		for _, id := range doc.Tags {
+			if name, ok := tagNames[id]; ok {
+				entry.Shelves = append(entry.Shelves, name)
+			}
+		}
+		sort.Strings(entry.Shelves)
+		entries = append(entries, entry)
+	}
+	return writeEntries(w, format, entries)
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"net/http"
+)
+
+func MakeJobHandler(mr *mux.Router, service JobService) http.Handler {
+	r := mr.PathPrefix("/jobs").Subrouter()
+
+	h := &jobHandler{
+		service: service,
+	}
+
+	r.HandleFunc("/{id}", h.FindByID).Methods("GET")
+
+	return r
+}
+
+type jobHandler struct {
+	service JobService
+}
+
+func (h *jobHandler) FindByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	entity, err := h.service.FindByID(ctx, id)
+	if err == ErrNotFound {
+		common.MakeError(w, http.StatusNotFound, "job", err.Error(), "findbyid")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "job", "Server Error", "findbyid")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entity)
+}
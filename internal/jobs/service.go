@@ -0,0 +1,335 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+const (
+	DefaultMaxAttempts = 5
+	retryBackoff       = 10 * time.Second
+	maxRetryBackoff    = 30 * time.Minute
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrNoUser   = errors.New("job queued without a user")
+)
+
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      Status          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Error       string          `json:"error"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedUntil *time.Time      `json:"locked_until"` // lease of a running job, renewed while its worker is alive
+	Created     time.Time       `json:"created"`
+	Updated     *time.Time      `json:"updated"`
+	UserID      string          `json:"user_id"`          // who queued the job, empty for work the server schedules itself
+	Result      json.RawMessage `json:"result,omitempty"` // what the handler reported back, kept with the job for whoever queued it
+}
+
+// Decode unmarshals the payload the job was enqueued with.
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// SetResult stores v as the result of the job, it is saved with the job once its handler returns.
+func (j *Job) SetResult(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode job result")
+	}
+	j.Result = b
+	return nil
+}
+
+type permanentError struct {
+	error
+}
+
+// Permanent marks an error that retrying won't fix, the job fails without further attempts.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Handler runs a job, returning an error schedules a retry until the attempts run out. The context
+// is scoped to the user who queued the job, or is a system context for jobs the server queued.
+type Handler func(ctx context.Context, job *Job) error
+
+type JobService interface {
+	Register(jobType string, handler Handler)
+	Enqueue(ctx context.Context, jobType string, payload interface{}) (*Job, error)
+	FindByID(ctx context.Context, id string) (*Job, error)
+}
+
+// JobRepository methods are prefixed so a single database type can also implement the document repository.
+type JobRepository interface {
+	InsertJob(ctx context.Context, job *Job) error
+	// FindJobByID only finds jobs queued by the user of the context, unless they are an admin.
+	FindJobByID(ctx context.Context, id string) (*Job, error)
+	// ClaimJob marks the oldest job due by now as running, locked until the given time, and returns
+	// it, nil when there is none. Running jobs whose lock has expired are claimed again since the
+	// worker holding them has died.
+	ClaimJob(ctx context.Context, now time.Time, lockedUntil time.Time) (*Job, error)
+	UpdateJob(ctx context.Context, job Job) error
+	// ExtendJobLease moves the lock of a running job forward.
+	ExtendJobLease(ctx context.Context, id string, lockedUntil time.Time) error
+	// DeleteFinishedJobs removes succeeded and failed jobs last updated before the given time
+	// and returns how many there were.
+	DeleteFinishedJobs(ctx context.Context, before time.Time) (int, error)
+}
+
+type jobService struct {
+	repo     JobRepository
+	config   common.JobConfig
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewJobService starts the workers with the application and waits for running jobs when it stops.
+// Instances sharing a database share the queue, a job is held by one worker at a time through a
+// lease its worker keeps renewing.
+func NewJobService(lc fx.Lifecycle, repo JobRepository, config common.JobConfig) JobService {
+	s := &jobService{
+		repo:     repo,
+		config:   config,
+		handlers: make(map[string]Handler),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			logrus.WithField("workers", config.Workers).Info("starting job workers")
+			for i := 0; i < config.Workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.work(ctx)
+				}()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.clean(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			logrus.Info("stopping job workers")
+			cancel()
+			wg.Wait()
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *jobService) Register(jobType string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[jobType] = handler
+}
+
+// Enqueue queues a job for the user of the context, work for every library has to be queued with
+// a system context.
+func (s *jobService) Enqueue(ctx context.Context, jobType string, payload interface{}) (*Job, error) {
+	if common.UserID(ctx) == "" && !common.IsSystem(ctx) {
+		return nil, ErrNoUser
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode job payload")
+	}
+	now := time.Now()
+	job := &Job{
+		ID:          uuid.New().String(),
+		Type:        jobType,
+		Payload:     b,
+		Status:      StatusPending,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       now,
+		Created:     now,
+		UserID:      common.UserID(ctx),
+	}
+	if err := s.repo.InsertJob(ctx, job); err != nil {
+		logrus.WithError(err).WithField("type", jobType).Error("unable to enqueue job")
+		return nil, errors.Wrap(err, "unable to enqueue job")
+	}
+	return job, nil
+}
+
+func (s *jobService) FindByID(ctx context.Context, id string) (*Job, error) {
+	job, err := s.repo.FindJobByID(ctx, id)
+	if err == ErrNotFound {
+		return nil, err
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to fetch job from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return job, nil
+}
+
+// work claims jobs until the context is cancelled, sleeping for the poll interval when the queue is empty.
+func (s *jobService) work(ctx context.Context) {
+	for {
+		now := time.Now()
+		job, err := s.repo.ClaimJob(ctx, now, now.Add(s.config.Lease))
+		if err != nil {
+			logrus.WithError(err).Error("unable to claim job")
+		}
+		if job != nil {
+			s.run(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.config.PollInterval):
+		}
+	}
+}
+
+func (s *jobService) run(ctx context.Context, job *Job) {
+	s.mu.RLock()
+	handler, ok := s.handlers[job.Type]
+	s.mu.RUnlock()
+
+	log := logrus.WithFields(logrus.Fields{"id": job.ID, "type": job.Type, "attempt": job.Attempts})
+	var err error
+	switch {
+	case !ok:
+		err = errors.Errorf("no handler for job type %q", job.Type)
+		job.Attempts = job.MaxAttempts
+	case job.Attempts > job.MaxAttempts:
+		// the lease of the last attempt ran out, the job may well be what brought its worker down
+		err = Permanent(errors.New("worker stopped during the last attempt"))
+	default:
+		done := make(chan struct{})
+		go s.heartbeat(job.ID, done)
+		err = runHandler(jobContext(ctx, job), handler, job)
+		close(done)
+	}
+
+	now := time.Now()
+	job.Updated = &now
+	job.LockedUntil = nil
+	switch {
+	case err == nil:
+		job.Status = StatusSucceeded
+		job.Error = ""
+		log.Info("job succeeded")
+	case ctx.Err() != nil:
+		// shutting down, let the next start pick it up again without using up an attempt
+		job.Status = StatusPending
+		job.Attempts--
+		log.Info("job interrupted")
+	case isPermanent(err) || job.Attempts >= job.MaxAttempts:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		log.WithError(err).Error("job failed")
+	default:
+		job.Status = StatusPending
+		job.Error = err.Error()
+		job.RunAt = now.Add(backoff(job.Attempts))
+		log.WithError(err).WithField("retry_at", job.RunAt).Warn("job failed, retrying")
+	}
+
+	// the worker context may be cancelled, the outcome still needs saving
+	if err := s.repo.UpdateJob(context.Background(), *job); err != nil {
+		log.WithError(err).Error("unable to save job status")
+	}
+}
+
+// heartbeat renews the lease of a running job until done is closed, a job whose lease runs out
+// is claimed again by another worker.
+func (s *jobService) heartbeat(id string, done <-chan struct{}) {
+	ticker := time.NewTicker(s.config.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := s.repo.ExtendJobLease(context.Background(), id, time.Now().Add(s.config.Lease)); err != nil {
+				logrus.WithError(err).WithField("id", id).Warn("unable to renew job lease")
+			}
+		}
+	}
+}
+
+// clean deletes finished jobs older than the retention period at start and every clean interval
+// until the context is cancelled.
+func (s *jobService) clean(ctx context.Context) {
+	ticker := time.NewTicker(s.config.CleanInterval)
+	defer ticker.Stop()
+	for {
+		deleted, err := s.repo.DeleteFinishedJobs(ctx, time.Now().Add(-s.config.Retention))
+		if err != nil {
+			logrus.WithError(err).Error("unable to delete finished jobs")
+		} else if deleted > 0 {
+			logrus.WithField("deleted", deleted).Info("finished jobs deleted")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// jobContext scopes the context a job runs with to the user who queued it.
+func jobContext(ctx context.Context, job *Job) context.Context {
+	if job.UserID == "" {
+		return common.SystemContext(ctx)
+	}
+	return common.ContextWithUser(ctx, common.User{ID: job.UserID})
+}
+
+// runHandler turns a panic in a handler into a failed attempt instead of killing the worker.
+func runHandler(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func isPermanent(err error) bool {
+	_, ok := err.(permanentError)
+	return ok
+}
+
+// backoff doubles the delay after each failed attempt.
+func backoff(attempts int) time.Duration {
+	delay := retryBackoff
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay
+}
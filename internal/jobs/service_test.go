@@ -0,0 +1,192 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/database"
+	"github.com/holmes89/book-organizer/internal/jobs"
+	"go.uber.org/fx/fxtest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var system = common.SystemContext(context.Background())
+
+// startWorkers runs a job service with one worker polling quickly against the in-memory database,
+// which imports jobs so the tests live outside the package. handler is registered for "test".
+func startWorkers(t *testing.T, handler jobs.Handler) (jobs.JobService, *database.MemoryDatabase) {
+	repo := database.NewMemoryDatabase().(*database.MemoryDatabase)
+	lc := fxtest.NewLifecycle(t)
+	s := jobs.NewJobService(lc, repo, common.JobConfig{
+		Workers:       1,
+		PollInterval:  5 * time.Millisecond,
+		Lease:         time.Minute,
+		Retention:     time.Hour,
+		CleanInterval: time.Hour,
+	})
+	s.Register("test", handler)
+	lc.RequireStart()
+	t.Cleanup(func() { lc.RequireStop() })
+	return s, repo
+}
+
+// waitFor polls the job until done reports true for it.
+func waitFor(t *testing.T, repo *database.MemoryDatabase, id string, done func(job *jobs.Job) bool) *jobs.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := repo.FindJobByID(system, id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if done(job) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job stuck as %s after %d attempts", job.Status, job.Attempts)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func finished(job *jobs.Job) bool {
+	return job.Status == jobs.StatusSucceeded || job.Status == jobs.StatusFailed
+}
+
+func TestPermanentFailure(t *testing.T) {
+	var calls int32
+	s, repo := startWorkers(t, func(ctx context.Context, job *jobs.Job) error {
+		atomic.AddInt32(&calls, 1)
+		return jobs.Permanent(errors.New("invalid payload"))
+	})
+
+	queued, err := s.Enqueue(system, "test", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	job := waitFor(t, repo, queued.ID, finished)
+	if job.Status != jobs.StatusFailed || job.Error != "invalid payload" {
+		t.Errorf("got %s with %q, want failed with %q", job.Status, job.Error, "invalid payload")
+	}
+	if job.Attempts != 1 || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("ran %d times in %d attempts, want once", calls, job.Attempts)
+	}
+	if job.LockedUntil != nil {
+		t.Errorf("failed job still locked until %s", job.LockedUntil)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	_, repo := startWorkers(t, func(ctx context.Context, job *jobs.Job) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("flaky")
+	})
+
+	now := time.Now()
+	queued := &jobs.Job{ID: "retried", Type: "test", Status: jobs.StatusPending, MaxAttempts: 3, RunAt: now, Created: now}
+	if err := repo.InsertJob(system, queued); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for attempt := 1; attempt < queued.MaxAttempts; attempt++ {
+		job := waitFor(t, repo, queued.ID, func(job *jobs.Job) bool {
+			return job.Status == jobs.StatusPending && job.Attempts == attempt
+		})
+		if job.Error != "flaky" {
+			t.Errorf("attempt %d: got error %q, want %q", attempt, job.Error, "flaky")
+		}
+		if delay := time.Until(job.RunAt); delay < 5*time.Second {
+			t.Errorf("attempt %d: retry in %s, want a backoff", attempt, delay)
+		}
+		// skip the backoff, the job isn't due so no worker touches it meanwhile
+		job.RunAt = time.Now()
+		if err := repo.UpdateJob(system, *job); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	job := waitFor(t, repo, queued.ID, finished)
+	if job.Status != jobs.StatusFailed || job.Error != "flaky" {
+		t.Errorf("got %s with %q, want failed with %q", job.Status, job.Error, "flaky")
+	}
+	if job.Attempts != 3 || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("ran %d times in %d attempts, want 3", calls, job.Attempts)
+	}
+}
+
+func TestExpiredLease(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		locked   time.Duration // lease left when the workers start
+		status   jobs.Status
+		ran      bool
+	}{
+		{"reclaimed", 1, -time.Second, jobs.StatusSucceeded, true},
+		{"last attempt fails", jobs.DefaultMaxAttempts, -time.Second, jobs.StatusFailed, false},
+		{"lease held", 1, time.Minute, jobs.StatusRunning, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			_, repo := startWorkers(t, func(ctx context.Context, job *jobs.Job) error {
+				atomic.AddInt32(&calls, 1)
+				return nil
+			})
+
+			now := time.Now()
+			locked := now.Add(tt.locked)
+			running := &jobs.Job{ID: "running", Type: "test", Status: jobs.StatusRunning, Attempts: tt.attempts,
+				MaxAttempts: jobs.DefaultMaxAttempts, RunAt: now, LockedUntil: &locked, Created: now}
+			if err := repo.InsertJob(system, running); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var job *jobs.Job
+			if tt.status == jobs.StatusRunning {
+				time.Sleep(50 * time.Millisecond)
+				job = waitFor(t, repo, running.ID, func(*jobs.Job) bool { return true })
+			} else {
+				job = waitFor(t, repo, running.ID, finished)
+			}
+			if job.Status != tt.status {
+				t.Errorf("got %s, want %s", job.Status, tt.status)
+			}
+			if ran := atomic.LoadInt32(&calls) > 0; ran != tt.ran {
+				t.Errorf("handler ran %v, want %v", ran, tt.ran)
+			}
+			if tt.status == jobs.StatusFailed && job.Error != "worker stopped during the last attempt" {
+				t.Errorf("got error %q", job.Error)
+			}
+		})
+	}
+}
+
+func TestHandlerContext(t *testing.T) {
+	users := make(chan string, 2)
+	s, repo := startWorkers(t, func(ctx context.Context, job *jobs.Job) error {
+		if common.IsSystem(ctx) {
+			users <- "system"
+		} else {
+			users <- common.UserID(ctx)
+		}
+		return nil
+	})
+
+	if _, err := s.Enqueue(context.Background(), "test", nil); err != jobs.ErrNoUser {
+		t.Errorf("got error %v queueing without a user, want %v", err, jobs.ErrNoUser)
+	}
+	for _, ctx := range []context.Context{common.ContextWithUser(context.Background(), common.User{ID: "alice"}), system} {
+		queued, err := s.Enqueue(ctx, "test", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		waitFor(t, repo, queued.ID, finished)
+	}
+	if got := []string{<-users, <-users}; got[0] != "alice" || got[1] != "system" {
+		t.Errorf("handlers ran for %q, want alice then system", got)
+	}
+}
@@ -0,0 +1,291 @@
+package opds
+
+import (
+	"encoding/xml"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"io"
+	"net/url"
+	"time"
+)
+
+// Relations of links to other feeds.
+const (
+	RelSubsection = "subsection"
+	RelSortNew    = "http://opds-spec.org/sort/new"
+)
+
+const (
+	atomNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	atomAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	openSearchType      = "application/opensearchdescription+xml"
+	coverType           = "image/jpeg"
+)
+
+// Feed is a catalog page independent of how it is written, either as an OPDS 1.2 Atom feed or
+// an OPDS 2.0 JSON feed. Hrefs are relative to the root of the catalog.
+type Feed struct {
+	ID           string
+	Title        string
+	Href         string
+	Up           string // empty for the root
+	Updated      time.Time
+	Page         int // set for acquisition feeds, which list publications a page at a time
+	Total        int
+	Navigation   []*Navigation
+	Publications []*Publication
+}
+
+// Navigation is a link to another feed.
+type Navigation struct {
+	ID          string
+	Title       string
+	Summary     string
+	Href        string
+	Rel         string
+	Acquisition bool // the feed lists publications rather than more navigation
+	Count       int  // publications in the feed, zero when not counted
+}
+
+// Publication is a document with where to download it and its cover.
+type Publication struct {
+	Document    *documents.Document
+	Tags        []string // names
+	Acquisition string   // absolute url from storage
+	Cover       string
+}
+
+func (f *Feed) paged() bool {
+	return f.Page > 0
+}
+
+func (f *Feed) lastPage() int {
+	if f.Total <= PageSize {
+		return 1
+	}
+	return (f.Total + PageSize - 1) / PageSize
+}
+
+// catalog turns hrefs relative to the catalog into paths under its root. A token the client
+// authenticated with is carried in every link as e-readers won't remember it between requests.
+type catalog struct {
+	root  string
+	token string
+}
+
+func (c catalog) href(path string) string {
+	if path == "/" {
+		path = ""
+	}
+	href := c.root + path
+	if c.token == "" {
+		return href
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	q := u.Query()
+	q.Set("token", c.token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+type atomFeed struct {
+	XMLName      xml.Name    `xml:"feed"`
+	Namespace    string      `xml:"xmlns,attr"`
+	DC           string      `xml:"xmlns:dc,attr"`
+	OPDS         string      `xml:"xmlns:opds,attr"`
+	OpenSearch   string      `xml:"xmlns:opensearch,attr"`
+	Thread       string      `xml:"xmlns:thr,attr"`
+	ID           string      `xml:"id"`
+	Title        string      `xml:"title"`
+	Updated      string      `xml:"updated"`
+	Author       atomAuthor  `xml:"author"`
+	TotalResults int         `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage int         `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex   int         `xml:"opensearch:startIndex,omitempty"`
+	Links        []atomLink  `xml:"link"`
+	Entries      []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Count int    `xml:"thr:count,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Publisher  string         `xml:"dc:publisher,omitempty"`
+	Identifier string         `xml:"dc:identifier,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+	Links      []atomLink     `xml:"link"`
+}
+
+// writeAtom writes the feed as an OPDS 1.2 catalog.
+func writeAtom(w io.Writer, c catalog, f *Feed) error {
+	updated := f.Updated
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	kind := atomNavigationType
+	if f.paged() {
+		kind = atomAcquisitionType
+	}
+
+	feed := atomFeed{
+		Namespace:  "http://www.w3.org/2005/Atom",
+		DC:         "http://purl.org/dc/terms/",
+		OPDS:       "http://opds-spec.org/2010/catalog",
+		OpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		Thread:     "http://purl.org/syndication/thread/1.0",
+		ID:         "urn:book-organizer:" + f.ID,
+		Title:      f.Title,
+		Updated:    updated.UTC().Format(time.RFC3339),
+		Author:     atomAuthor{Name: "book-organizer"},
+		Links: []atomLink{
+			{Rel: "self", Href: c.href(f.Href), Type: kind},
+			{Rel: "start", Href: c.href("/"), Type: atomNavigationType},
+			{Rel: "search", Href: c.href("/opensearch.xml"), Type: openSearchType},
+		},
+		Entries: []atomEntry{},
+	}
+	if f.Up != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "up", Href: c.href(f.Up), Type: atomNavigationType})
+	}
+	if f.paged() {
+		feed.TotalResults, feed.ItemsPerPage, feed.StartIndex = f.Total, PageSize, f.Offset()+1
+		feed.Links = append(feed.Links, atomLink{Rel: "first", Href: c.href(f.pageHref(1)), Type: kind})
+		if f.Page > 1 {
+			feed.Links = append(feed.Links, atomLink{Rel: "previous", Href: c.href(f.pageHref(f.Page - 1)), Type: kind})
+		}
+		if f.Page < f.lastPage() {
+			feed.Links = append(feed.Links, atomLink{Rel: "next", Href: c.href(f.pageHref(f.Page + 1)), Type: kind})
+		}
+		feed.Links = append(feed.Links, atomLink{Rel: "last", Href: c.href(f.pageHref(f.lastPage())), Type: kind})
+	}
+
+	for _, n := range f.Navigation {
+		entry := atomEntry{
+			Title:   n.Title,
+			ID:      "urn:book-organizer:" + n.ID,
+			Updated: feed.Updated,
+			Links:   []atomLink{{Rel: n.Rel, Href: c.href(n.Href), Type: atomNavigationType, Count: n.Count}},
+		}
+		if n.Acquisition {
+			entry.Links[0].Type = atomAcquisitionType
+		}
+		if n.Summary != "" {
+			entry.Content = &atomText{Type: "text", Text: n.Summary}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	for _, p := range f.Publications {
+		feed.Entries = append(feed.Entries, atomPublication(c, p))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
+
+func atomPublication(c catalog, p *Publication) atomEntry {
+	doc := p.Document
+	updated := doc.Created
+	if doc.Updated != nil {
+		updated = *doc.Updated
+	}
+	entry := atomEntry{
+		Title:     publicationTitle(doc),
+		ID:        "urn:uuid:" + doc.ID,
+		Updated:   updated.UTC().Format(time.RFC3339),
+		Language:  doc.Language,
+		Publisher: doc.Publisher,
+		Links: []atomLink{
+			{Rel: "http://opds-spec.org/image", Href: c.href(p.Cover), Type: coverType},
+			{Rel: "http://opds-spec.org/image/thumbnail", Href: c.href(p.Cover), Type: coverType},
+			{Rel: "http://opds-spec.org/acquisition", Href: p.Acquisition, Type: documents.FormatMIME(doc.Format)},
+		},
+	}
+	if doc.ISBN != "" {
+		entry.Identifier = "urn:isbn:" + doc.ISBN
+	}
+	for _, author := range doc.Authors {
+		entry.Authors = append(entry.Authors, atomAuthor{Name: author, URI: c.href("/authors/" + url.PathEscape(author))})
+	}
+	for _, tag := range p.Tags {
+		entry.Categories = append(entry.Categories, atomCategory{Term: tag, Label: tag})
+	}
+	if doc.Description != "" {
+		entry.Summary = &atomText{Type: "text", Text: doc.Description}
+	}
+	return entry
+}
+
+// publicationTitle falls back to the name the document is listed under when it has no title.
+func publicationTitle(doc *documents.Document) string {
+	if doc.Title != "" {
+		return doc.Title
+	}
+	return doc.DisplayName
+}
+
+type openSearchDescription struct {
+	XMLName        xml.Name      `xml:"OpenSearchDescription"`
+	Namespace      string        `xml:"xmlns,attr"`
+	ShortName      string        `xml:"ShortName"`
+	Description    string        `xml:"Description"`
+	InputEncoding  string        `xml:"InputEncoding"`
+	OutputEncoding string        `xml:"OutputEncoding"`
+	URL            openSearchURL `xml:"Url"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// writeOpenSearch describes how to search the catalog, template is the absolute search url with
+// the query left as {searchTerms}.
+func writeOpenSearch(w io.Writer, template string) error {
+	desc := openSearchDescription{
+		Namespace:      "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:      "Library",
+		Description:    "Search books and papers by title, author and text",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URL:            openSearchURL{Type: atomAcquisitionType, Template: template},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(desc)
+}
@@ -0,0 +1,194 @@
+package opds
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// version is a way of writing the catalog and where it is served.
+type version struct {
+	root        string
+	contentType string
+	write       func(w io.Writer, c catalog, f *Feed) error
+}
+
+var (
+	atomVersion  = version{root: "/opds", contentType: "application/atom+xml;profile=opds-catalog;charset=utf-8", write: writeAtom}
+	opds2Version = version{root: "/opds/v2", contentType: "application/opds+json", write: writeOPDS2}
+)
+
+// MakeOPDSHandler serves the catalog to e-readers as OPDS 1.2 under /opds and as OPDS 2.0
+// under /opds/v2.
+func MakeOPDSHandler(mr *mux.Router, service OPDSService, docService documents.DocumentService) http.Handler {
+	h := &opdsHandler{
+		service:    service,
+		docService: docService,
+	}
+
+	// the longer prefix first so /opds doesn't take its requests
+	for _, v := range []version{opds2Version, atomVersion} {
+		r := mr.PathPrefix(v.root).Subrouter()
+		r.HandleFunc("", h.feed(v, h.Root)).Methods("GET")
+		r.HandleFunc("/", h.feed(v, h.Root)).Methods("GET")
+		r.HandleFunc("/recent", h.feed(v, h.Recent)).Methods("GET")
+		r.HandleFunc("/authors", h.feed(v, h.Authors)).Methods("GET")
+		r.HandleFunc("/authors/{name:.+}", h.feed(v, h.Author)).Methods("GET")
+		r.HandleFunc("/tags", h.feed(v, h.Tags)).Methods("GET")
+		r.HandleFunc("/tags/{id}", h.feed(v, h.Tag)).Methods("GET")
+		r.HandleFunc("/types", h.feed(v, h.Types)).Methods("GET")
+		r.HandleFunc("/types/{type}", h.feed(v, h.Type)).Methods("GET")
+		r.HandleFunc("/search", h.feed(v, h.Search)).Methods("GET")
+		r.HandleFunc("/covers/{id}", h.Cover).Methods("GET")
+		if v.root == atomVersion.root {
+			r.HandleFunc("/opensearch.xml", h.OpenSearch).Methods("GET")
+		}
+	}
+
+	return mr
+}
+
+type opdsHandler struct {
+	service    OPDSService
+	docService documents.DocumentService
+}
+
+type feedFunc func(r *http.Request, page int) (*Feed, error)
+
+// feed writes the feed returned by fn in the format of the version.
+func (h *opdsHandler) feed(v version, fn feedFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			var err error
+			if page, err = strconv.Atoi(p); err != nil || page < 1 {
+				common.MakeError(w, http.StatusBadRequest, "opds", "Invalid page", "feed")
+				return
+			}
+		}
+
+		feed, err := fn(r, page)
+		switch err {
+		case nil:
+		case ErrNotFound:
+			common.MakeError(w, http.StatusNotFound, "opds", err.Error(), "feed")
+			return
+		case ErrMissingQuery:
+			common.MakeError(w, http.StatusBadRequest, "opds", err.Error(), "feed")
+			return
+		default:
+			common.MakeError(w, http.StatusInternalServerError, "opds", "Server Error", "feed")
+			return
+		}
+
+		buf := &bytes.Buffer{}
+		if err := v.write(buf, catalogOf(r, v), feed); err != nil {
+			logrus.WithError(err).Error("unable to write feed")
+			common.MakeError(w, http.StatusInternalServerError, "opds", "Server Error", "feed")
+			return
+		}
+		w.Header().Set("Content-Type", v.contentType)
+		if _, err := io.Copy(w, buf); err != nil {
+			logrus.WithError(err).Warn("unable to write feed")
+		}
+	}
+}
+
+func (h *opdsHandler) Root(r *http.Request, page int) (*Feed, error) {
+	return h.service.Root(r.Context())
+}
+
+func (h *opdsHandler) Recent(r *http.Request, page int) (*Feed, error) {
+	return h.service.Recent(r.Context(), page)
+}
+
+func (h *opdsHandler) Authors(r *http.Request, page int) (*Feed, error) {
+	return h.service.Authors(r.Context())
+}
+
+func (h *opdsHandler) Author(r *http.Request, page int) (*Feed, error) {
+	return h.service.Author(r.Context(), mux.Vars(r)["name"], page)
+}
+
+func (h *opdsHandler) Tags(r *http.Request, page int) (*Feed, error) {
+	return h.service.Tags(r.Context())
+}
+
+func (h *opdsHandler) Tag(r *http.Request, page int) (*Feed, error) {
+	return h.service.Tag(r.Context(), mux.Vars(r)["id"], page)
+}
+
+func (h *opdsHandler) Types(r *http.Request, page int) (*Feed, error) {
+	return h.service.Types(r.Context())
+}
+
+func (h *opdsHandler) Type(r *http.Request, page int) (*Feed, error) {
+	return h.service.Type(r.Context(), mux.Vars(r)["type"], page)
+}
+
+// Search takes the query as q from OpenSearch or query from the OPDS 2.0 template.
+func (h *opdsHandler) Search(r *http.Request, page int) (*Feed, error) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		q = r.URL.Query().Get("query")
+	}
+	return h.service.Search(r.Context(), q, page)
+}
+
+func (h *opdsHandler) Cover(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	cover, err := h.docService.Cover(ctx, id)
+	if err == documents.ErrNotFound || err == documents.ErrCoverNotFound {
+		common.MakeError(w, http.StatusNotFound, "opds", err.Error(), "cover")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "opds", "Server Error", "cover")
+		return
+	}
+	defer cover.Close()
+
+	w.Header().Set("Content-Type", coverType)
+	if _, err := io.Copy(w, cover); err != nil {
+		logrus.WithError(err).Warn("unable to write cover")
+	}
+}
+
+// OpenSearch describes the search of the Atom catalog. Clients resolve the template on its own
+// so it is written as an absolute url.
+func (h *opdsHandler) OpenSearch(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	href := scheme + "://" + r.Host + catalogOf(r, atomVersion).href("/search")
+	template := href + "?q={searchTerms}"
+	if catalogOf(r, atomVersion).token != "" {
+		template = href + "&q={searchTerms}"
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeOpenSearch(buf, template); err != nil {
+		logrus.WithError(err).Error("unable to write search description")
+		common.MakeError(w, http.StatusInternalServerError, "opds", "Server Error", "opensearch")
+		return
+	}
+	w.Header().Set("Content-Type", openSearchType)
+	if _, err := io.Copy(w, buf); err != nil {
+		logrus.WithError(err).Warn("unable to write search description")
+	}
+}
+
+func catalogOf(r *http.Request, v version) catalog {
+	return catalog{root: v.root, token: r.URL.Query().Get("token")}
+}
@@ -0,0 +1,174 @@
+package opds
+
+import (
+	"encoding/json"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const opds2Type = "application/opds+json"
+
+type opds2Feed struct {
+	Metadata     opds2Metadata      `json:"metadata"`
+	Links        []opds2Link        `json:"links"`
+	Navigation   []opds2Link        `json:"navigation,omitempty"`
+	Publications []opds2Publication `json:"publications,omitempty"`
+}
+
+type opds2Metadata struct {
+	Title         string `json:"title"`
+	Modified      string `json:"modified"`
+	NumberOfItems int    `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int    `json:"itemsPerPage,omitempty"`
+	CurrentPage   int    `json:"currentPage,omitempty"`
+}
+
+type opds2Link struct {
+	Rel        string           `json:"rel,omitempty"`
+	Href       string           `json:"href"`
+	Type       string           `json:"type,omitempty"`
+	Title      string           `json:"title,omitempty"`
+	Templated  bool             `json:"templated,omitempty"`
+	Properties *opds2Properties `json:"properties,omitempty"`
+}
+
+type opds2Properties struct {
+	NumberOfItems int `json:"numberOfItems"`
+}
+
+type opds2Publication struct {
+	Metadata opds2PublicationMetadata `json:"metadata"`
+	Links    []opds2Link              `json:"links"`
+	Images   []opds2Link              `json:"images"`
+}
+
+type opds2PublicationMetadata struct {
+	Type        string             `json:"@type"`
+	Identifier  string             `json:"identifier"`
+	Title       string             `json:"title"`
+	Author      []opds2Contributor `json:"author,omitempty"`
+	Publisher   string             `json:"publisher,omitempty"`
+	Language    string             `json:"language,omitempty"`
+	Modified    string             `json:"modified"`
+	Description string             `json:"description,omitempty"`
+	Subject     []opds2Subject     `json:"subject,omitempty"`
+	BelongsTo   *opds2BelongsTo    `json:"belongsTo,omitempty"`
+}
+
+type opds2Contributor struct {
+	Name  string      `json:"name"`
+	Links []opds2Link `json:"links,omitempty"`
+}
+
+type opds2Subject struct {
+	Name string `json:"name"`
+}
+
+type opds2BelongsTo struct {
+	Series []opds2Series `json:"series"`
+}
+
+type opds2Series struct {
+	Name     string  `json:"name"`
+	Position float64 `json:"position,omitempty"`
+}
+
+// writeOPDS2 writes the feed as an OPDS 2.0 catalog.
+func writeOPDS2(w io.Writer, c catalog, f *Feed) error {
+	updated := f.Updated
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed := opds2Feed{
+		Metadata: opds2Metadata{Title: f.Title, Modified: updated.UTC().Format(time.RFC3339)},
+		Links: []opds2Link{
+			{Rel: "self", Href: c.href(f.Href), Type: opds2Type},
+			{Rel: "start", Href: c.href("/"), Type: opds2Type},
+			// the query is left to the client as a URI template
+			{Rel: "search", Href: searchTemplate(c.href("/search")), Type: opds2Type, Templated: true},
+		},
+	}
+	if f.Up != "" {
+		feed.Links = append(feed.Links, opds2Link{Rel: "up", Href: c.href(f.Up), Type: opds2Type})
+	}
+	if f.paged() {
+		feed.Metadata.NumberOfItems, feed.Metadata.ItemsPerPage, feed.Metadata.CurrentPage = f.Total, PageSize, f.Page
+		feed.Links = append(feed.Links, opds2Link{Rel: "first", Href: c.href(f.pageHref(1)), Type: opds2Type})
+		if f.Page > 1 {
+			feed.Links = append(feed.Links, opds2Link{Rel: "previous", Href: c.href(f.pageHref(f.Page - 1)), Type: opds2Type})
+		}
+		if f.Page < f.lastPage() {
+			feed.Links = append(feed.Links, opds2Link{Rel: "next", Href: c.href(f.pageHref(f.Page + 1)), Type: opds2Type})
+		}
+		feed.Links = append(feed.Links, opds2Link{Rel: "last", Href: c.href(f.pageHref(f.lastPage())), Type: opds2Type})
+		// a feed without publications still needs one of the collections
+		feed.Publications = []opds2Publication{}
+	}
+
+	for _, n := range f.Navigation {
+		link := opds2Link{Rel: n.Rel, Href: c.href(n.Href), Type: opds2Type, Title: n.Title}
+		if n.Count > 0 {
+			link.Properties = &opds2Properties{NumberOfItems: n.Count}
+		}
+		feed.Navigation = append(feed.Navigation, link)
+	}
+	for _, p := range f.Publications {
+		feed.Publications = append(feed.Publications, opds2PublicationOf(c, p))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(feed)
+}
+
+func opds2PublicationOf(c catalog, p *Publication) opds2Publication {
+	doc := p.Document
+	updated := doc.Created
+	if doc.Updated != nil {
+		updated = *doc.Updated
+	}
+	meta := opds2PublicationMetadata{
+		Type:        "http://schema.org/Book",
+		Identifier:  "urn:uuid:" + doc.ID,
+		Title:       publicationTitle(doc),
+		Publisher:   doc.Publisher,
+		Language:    doc.Language,
+		Modified:    updated.UTC().Format(time.RFC3339),
+		Description: doc.Description,
+	}
+	if doc.ISBN != "" {
+		meta.Identifier = "urn:isbn:" + doc.ISBN
+	}
+	for _, author := range doc.Authors {
+		meta.Author = append(meta.Author, opds2Contributor{
+			Name:  author,
+			Links: []opds2Link{{Href: c.href("/authors/" + url.PathEscape(author)), Type: opds2Type}},
+		})
+	}
+	for _, tag := range p.Tags {
+		meta.Subject = append(meta.Subject, opds2Subject{Name: tag})
+	}
+	if doc.Series != "" {
+		meta.BelongsTo = &opds2BelongsTo{Series: []opds2Series{{Name: doc.Series, Position: doc.SeriesIndex}}}
+	}
+	return opds2Publication{
+		Metadata: meta,
+		Links: []opds2Link{
+			{Rel: "http://opds-spec.org/acquisition", Href: p.Acquisition, Type: documents.FormatMIME(doc.Format)},
+		},
+		Images: []opds2Link{
+			{Href: c.href(p.Cover), Type: coverType},
+		},
+	}
+}
+
+// searchTemplate adds the query to a search href as a URI template variable.
+func searchTemplate(href string) string {
+	if strings.Contains(href, "?") {
+		return href + "{&query}"
+	}
+	return href + "{?query}"
+}
@@ -0,0 +1,316 @@
+package opds
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/holmes89/book-organizer/internal/search"
+	"github.com/holmes89/book-organizer/internal/tags"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gocloud.dev/gcerrors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PageSize is how many books an acquisition feed lists per page.
+const PageSize = documents.DefaultPageSize
+
+var (
+	ErrNotFound     = errors.New("feed not found")
+	ErrMissingQuery = errors.New("search query required")
+)
+
+// types are the kinds of document the catalog can be browsed by.
+var types = []struct {
+	Type  string
+	Title string
+}{
+	{"book", "Books"},
+	{"paper", "Papers"},
+}
+
+type OPDSService interface {
+	Root(ctx context.Context) (*Feed, error)
+	Recent(ctx context.Context, page int) (*Feed, error)
+	Authors(ctx context.Context) (*Feed, error)
+	Author(ctx context.Context, name string, page int) (*Feed, error)
+	Tags(ctx context.Context) (*Feed, error)
+	Tag(ctx context.Context, id string, page int) (*Feed, error)
+	Types(ctx context.Context) (*Feed, error)
+	Type(ctx context.Context, docType string, page int) (*Feed, error)
+	Search(ctx context.Context, query string, page int) (*Feed, error)
+}
+
+type opdsService struct {
+	docService    documents.DocumentService
+	tagService    tags.TagService
+	searchService search.SearchService
+	storage       common.DocumentGet
+}
+
+func NewOPDSService(docService documents.DocumentService, tagService tags.TagService, searchService search.SearchService, storage common.DocumentStorage) OPDSService {
+	return &opdsService{
+		docService:    docService,
+		tagService:    tagService,
+		searchService: searchService,
+		storage:       storage,
+	}
+}
+
+func (s *opdsService) Root(ctx context.Context) (*Feed, error) {
+	return &Feed{
+		ID:    "root",
+		Title: "Library",
+		Navigation: []*Navigation{
+			{ID: "recent", Title: "Recently added", Href: "/recent", Rel: RelSortNew, Acquisition: true, Summary: "The newest books and papers"},
+			{ID: "authors", Title: "Authors", Href: "/authors", Rel: RelSubsection, Summary: "Browse by author"},
+			{ID: "tags", Title: "Tags", Href: "/tags", Rel: RelSubsection, Summary: "Browse by tag"},
+			{ID: "types", Title: "Types", Href: "/types", Rel: RelSubsection, Summary: "Books and papers"},
+		},
+	}, nil
+}
+
+func (s *opdsService) Recent(ctx context.Context, page int) (*Feed, error) {
+	feed := &Feed{ID: "recent", Title: "Recently added", Href: "/recent", Up: "/"}
+	return feed, s.fillPage(ctx, feed, documents.ListOptions{}, page)
+}
+
+// Authors lists every author with how many documents they wrote, by name.
+func (s *opdsService) Authors(ctx context.Context) (*Feed, error) {
+	docs, err := s.documents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, doc := range docs {
+		for _, author := range doc.Authors {
+			counts[author]++
+		}
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+
+	feed := &Feed{ID: "authors", Title: "Authors", Href: "/authors", Up: "/"}
+	for _, name := range names {
+		feed.Navigation = append(feed.Navigation, &Navigation{
+			ID:          "author:" + name,
+			Title:       name,
+			Href:        "/authors/" + url.PathEscape(name),
+			Rel:         RelSubsection,
+			Acquisition: true,
+			Count:       counts[name],
+		})
+	}
+	return feed, nil
+}
+
+// Author lists the documents by an author, newest first. Authors are kept as a list on each
+// document so they are filtered here rather than by the repository.
+func (s *opdsService) Author(ctx context.Context, name string, page int) (*Feed, error) {
+	docs, err := s.documents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var written []*documents.Document
+	for _, doc := range docs {
+		for _, author := range doc.Authors {
+			if author == name {
+				written = append(written, doc)
+				break
+			}
+		}
+	}
+	if len(written) == 0 {
+		return nil, ErrNotFound
+	}
+	sort.SliceStable(written, func(i, j int) bool {
+		return written[i].Created.After(written[j].Created)
+	})
+
+	feed := &Feed{ID: "author:" + name, Title: name, Href: "/authors/" + url.PathEscape(name), Up: "/authors"}
+	feed.setPage(page, len(written))
+	end := feed.Offset() + PageSize
+	if end > len(written) {
+		end = len(written)
+	}
+	if feed.Offset() < end {
+		return feed, s.fillPublications(ctx, feed, written[feed.Offset():end])
+	}
+	return feed, nil
+}
+
+func (s *opdsService) Tags(ctx context.Context) (*Feed, error) {
+	tagList, err := s.tagService.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.documents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, doc := range docs {
+		for _, id := range doc.Tags {
+			counts[id]++
+		}
+	}
+	sort.Slice(tagList, func(i, j int) bool {
+		return strings.ToLower(tagList[i].Name) < strings.ToLower(tagList[j].Name)
+	})
+
+	feed := &Feed{ID: "tags", Title: "Tags", Href: "/tags", Up: "/"}
+	for _, tag := range tagList {
+		if counts[tag.ID] == 0 {
+			continue
+		}
+		feed.Navigation = append(feed.Navigation, &Navigation{
+			ID:          "tag:" + tag.ID,
+			Title:       tag.Name,
+			Href:        "/tags/" + tag.ID,
+			Rel:         RelSubsection,
+			Acquisition: true,
+			Count:       counts[tag.ID],
+		})
+	}
+	return feed, nil
+}
+
+func (s *opdsService) Tag(ctx context.Context, id string, page int) (*Feed, error) {
+	tag, err := s.tagService.FindByID(ctx, id)
+	if err == tags.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	feed := &Feed{ID: "tag:" + tag.ID, Title: tag.Name, Href: "/tags/" + tag.ID, Up: "/tags"}
+	return feed, s.fillPage(ctx, feed, documents.ListOptions{Filter: map[string]interface{}{documents.TagFilter: tag.ID}}, page)
+}
+
+func (s *opdsService) Types(ctx context.Context) (*Feed, error) {
+	feed := &Feed{ID: "types", Title: "Types", Href: "/types", Up: "/"}
+	for _, t := range types {
+		feed.Navigation = append(feed.Navigation, &Navigation{
+			ID:          "type:" + t.Type,
+			Title:       t.Title,
+			Href:        "/types/" + t.Type,
+			Rel:         RelSubsection,
+			Acquisition: true,
+		})
+	}
+	return feed, nil
+}
+
+func (s *opdsService) Type(ctx context.Context, docType string, page int) (*Feed, error) {
+	for _, t := range types {
+		if t.Type != docType {
+			continue
+		}
+		feed := &Feed{ID: "type:" + t.Type, Title: t.Title, Href: "/types/" + t.Type, Up: "/types"}
+		return feed, s.fillPage(ctx, feed, documents.ListOptions{Filter: map[string]interface{}{"type": t.Type}}, page)
+	}
+	return nil, ErrNotFound
+}
+
+// Search lists the documents matching a query by rank.
+func (s *opdsService) Search(ctx context.Context, query string, page int) (*Feed, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, ErrMissingQuery
+	}
+	feed := &Feed{ID: "search:" + query, Title: "Search: " + query, Href: "/search?q=" + url.QueryEscape(query), Up: "/"}
+	feed.setPage(page, 0)
+	results, err := s.searchService.Search(ctx, search.Query{Text: query, Limit: PageSize, Offset: feed.Offset()})
+	if err != nil {
+		return nil, err
+	}
+	feed.Total = results.Total
+	docs := make([]*documents.Document, 0, len(results.Items))
+	for _, result := range results.Items {
+		docs = append(docs, result.Document)
+	}
+	return feed, s.fillPublications(ctx, feed, docs)
+}
+
+// fillPage lists a page of documents newest first.
+func (s *opdsService) fillPage(ctx context.Context, feed *Feed, opts documents.ListOptions, page int) error {
+	feed.setPage(page, 0)
+	opts.Sort, opts.Descending = "created", true
+	opts.Limit, opts.Offset = PageSize, feed.Offset()
+	docs, err := s.docService.FindPage(ctx, opts)
+	if err != nil {
+		return err
+	}
+	feed.Total = docs.Total
+	return s.fillPublications(ctx, feed, docs.Items)
+}
+
+// fillPublications adds documents to a feed with links to download them, placeholders have
+// nothing to download and are left out.
+func (s *opdsService) fillPublications(ctx context.Context, feed *Feed, docs []*documents.Document) error {
+	tagList, err := s.tagService.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	tagNames := map[string]string{}
+	for _, tag := range tagList {
+		tagNames[tag.ID] = tag.Name
+	}
+
+	feed.Publications = []*Publication{}
+	for _, doc := range docs {
+		if doc.IsPlaceholder() {
+			continue
+		}
+		// e-readers fetch the file without the catalog's credentials, so they get a signed url
+		href, err := s.storage.Get(ctx, doc.Path)
+		if gcerrors.Code(err) == gcerrors.Unimplemented {
+			href, err = documents.ContentURL(doc.ID), nil
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("id", doc.ID).Error("unable to get path from storage")
+			return errors.Wrap(err, "unable to get path from storage")
+		}
+		publication := &Publication{Document: doc, Acquisition: href, Cover: "/covers/" + doc.ID}
+		for _, id := range doc.Tags {
+			if name, ok := tagNames[id]; ok {
+				publication.Tags = append(publication.Tags, name)
+			}
+		}
+		feed.Publications = append(feed.Publications, publication)
+	}
+	return nil
+}
+
+func (s *opdsService) documents(ctx context.Context) ([]*documents.Document, error) {
+	return s.docService.FindAll(ctx, nil)
+}
+
+func (f *Feed) setPage(page int, total int) {
+	if page < 1 {
+		page = 1
+	}
+	f.Page, f.Total, f.Updated = page, total, time.Now()
+}
+
+// Offset is the position of the first document of the page in the whole listing.
+func (f *Feed) Offset() int {
+	return (f.Page - 1) * PageSize
+}
+
+// pageHref is the link to another page of the feed.
+func (f *Feed) pageHref(page int) string {
+	sep := "?"
+	if strings.Contains(f.Href, "?") {
+		sep = "&"
+	}
+	return f.Href + sep + "page=" + strconv.Itoa(page)
+}
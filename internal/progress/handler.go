@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+func MakeProgressHandler(mr *mux.Router, service ProgressService) http.Handler {
+	h := &progressHandler{
+		service: service,
+	}
+
+	mr.HandleFunc("/books/{id}/progress", h.Find).Methods("GET")
+	mr.HandleFunc("/books/{id}/progress", h.Update).Methods("PUT")
+
+	return mr
+}
+
+type progressHandler struct {
+	service ProgressService
+}
+
+func (h *progressHandler) Find(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	entity, err := h.service.Find(ctx, id)
+	if err == documents.ErrNotFound {
+		common.MakeError(w, http.StatusNotFound, "progress", err.Error(), "find")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "progress", "Server Error", "find")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entity)
+}
+
+func (h *progressHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	b, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	req := Progress{}
+	if err := json.Unmarshal(b, &req); err != nil {
+		logrus.WithError(err).Error("unable to unmarshal progress")
+		common.MakeError(w, http.StatusBadRequest, "progress", "Bad Request", "update")
+		return
+	}
+
+	entity, err := h.service.Update(ctx, id, req)
+	switch err {
+	case nil:
+	case ErrInvalidStatus, ErrInvalidPercent, ErrInvalidLocation:
+		common.MakeError(w, http.StatusBadRequest, "progress", err.Error(), "update")
+		return
+	case documents.ErrNotFound:
+		common.MakeError(w, http.StatusNotFound, "progress", err.Error(), "update")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "progress", "Server Error", "update")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entity)
+}
@@ -0,0 +1,187 @@
+package progress
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusWantToRead Status = "want_to_read"
+	StatusReading    Status = "reading"
+	StatusFinished   Status = "finished"
+	StatusAbandoned  Status = "abandoned"
+)
+
+var statuses = map[Status]bool{StatusWantToRead: true, StatusReading: true, StatusFinished: true, StatusAbandoned: true}
+
+var (
+	ErrNotFound        = errors.New("no reading progress")
+	ErrInvalidStatus   = errors.New("invalid status")
+	ErrInvalidPercent  = errors.New("percentage must be between 0 and 100")
+	ErrInvalidLocation = errors.New("invalid location")
+)
+
+// Progress is how far through a document the reader is. Location is a page number for page
+// based formats and an EPUB CFI for EPUBs.
+type Progress struct {
+	DocumentID string     `json:"document_id"`
+	Location   string     `json:"location"`
+	Percentage float64    `json:"percentage"`
+	Status     Status     `json:"status"`
+	Started    *time.Time `json:"started"`
+	Finished   *time.Time `json:"finished"`
+	Updated    *time.Time `json:"updated"`
+}
+
+type ProgressService interface {
+	FindAll(ctx context.Context) ([]*Progress, error)
+	Find(ctx context.Context, documentID string) (*Progress, error)
+	Update(ctx context.Context, documentID string, progress Progress) (*Progress, error)
+}
+
+// ProgressRepository methods are prefixed so a single database type can also implement the document repository.
+type ProgressRepository interface {
+	FindAllProgress(ctx context.Context) ([]*Progress, error)
+	FindProgress(ctx context.Context, documentID string) (*Progress, error)
+	UpsertProgress(ctx context.Context, progress Progress) error
+}
+
+type progressService struct {
+	repo       ProgressRepository
+	docService documents.DocumentService
+}
+
+func NewProgressService(repo ProgressRepository, docService documents.DocumentService) ProgressService {
+	return &progressService{
+		repo:       repo,
+		docService: docService,
+	}
+}
+
+// FindAll returns the progress of every document that has been started or shelved.
+func (s *progressService) FindAll(ctx context.Context) ([]*Progress, error) {
+	entities, err := s.repo.FindAllProgress(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch progress from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return entities, nil
+}
+
+// Find returns the progress of a document, a document that hasn't been started has empty progress.
+func (s *progressService) Find(ctx context.Context, documentID string) (*Progress, error) {
+	if _, err := s.document(ctx, documentID); err != nil {
+		return nil, err
+	}
+	progress, err := s.repo.FindProgress(ctx, documentID)
+	if err == ErrNotFound {
+		return &Progress{DocumentID: documentID}, nil
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", documentID).Error("unable to fetch progress from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return progress, nil
+}
+
+// Update replaces the progress of a document, a request without a location keeps the last one.
+// Without a status one is worked out from the percentage, and start and finish dates the client
+// leaves out follow the status.
+func (s *progressService) Update(ctx context.Context, documentID string, progress Progress) (*Progress, error) {
+	doc, err := s.document(ctx, documentID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.FindProgress(ctx, documentID)
+	if err == ErrNotFound {
+		existing, err = &Progress{}, nil
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", documentID).Error("unable to fetch progress from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+
+	progress.DocumentID = documentID
+	progress.Location = strings.TrimSpace(progress.Location)
+	if progress.Location == "" && progress.Percentage == 0 && progress.Status != StatusWantToRead {
+		// only the status changed, keep the place in the book
+		progress.Location, progress.Percentage = existing.Location, existing.Percentage
+	}
+	if progress.Location != "" && !doc.ValidLocation(progress.Location) {
+		return nil, ErrInvalidLocation
+	}
+	if progress.Percentage == 0 {
+		progress.Percentage = pagePercentage(doc, progress.Location)
+	}
+	if progress.Percentage < 0 || progress.Percentage > 100 {
+		return nil, ErrInvalidPercent
+	}
+	if progress.Status == "" {
+		progress.Status = StatusReading
+		if progress.Percentage >= 100 {
+			progress.Status = StatusFinished
+		}
+	}
+	if !statuses[progress.Status] {
+		return nil, ErrInvalidStatus
+	}
+
+	now := time.Now()
+	finishedGiven := progress.Finished != nil
+	if progress.Started == nil {
+		progress.Started = existing.Started
+	}
+	if progress.Finished == nil {
+		progress.Finished = existing.Finished
+	}
+	switch progress.Status {
+	case StatusWantToRead:
+		progress.Started, progress.Finished = nil, nil
+	case StatusReading:
+		if progress.Started == nil {
+			progress.Started = &now
+		}
+		// reading again after finishing
+		progress.Finished = nil
+	case StatusFinished:
+		if progress.Started == nil {
+			progress.Started = &now
+		}
+		if !finishedGiven && (progress.Finished == nil || existing.Status != StatusFinished) {
+			progress.Finished = &now
+		}
+		progress.Percentage = 100
+	case StatusAbandoned:
+		progress.Finished = nil
+	}
+	progress.Updated = &now
+
+	if err := s.repo.UpsertProgress(ctx, progress); err != nil {
+		logrus.WithError(err).WithField("id", documentID).Error("unable to save progress")
+		return nil, errors.Wrap(err, "unable to save progress")
+	}
+	return &progress, nil
+}
+
+func (s *progressService) document(ctx context.Context, id string) (*documents.Document, error) {
+	doc, err := s.docService.FindByID(ctx, id)
+	if errors.Cause(err) == documents.ErrNotFound {
+		return nil, documents.ErrNotFound
+	}
+	return doc, err
+}
+
+// pagePercentage works out how far through a document a page is, zero when it can't tell.
+func pagePercentage(doc *documents.Document, location string) float64 {
+	page := documents.LocationPage(location)
+	if doc.Format == documents.FormatEpub || doc.PageCount == 0 {
+		return 0
+	}
+	return float64(page) * 100 / float64(doc.PageCount)
+}
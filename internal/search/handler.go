@@ -0,0 +1,57 @@
+package search
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"net/http"
+	"strconv"
+)
+
+func MakeSearchHandler(mr *mux.Router, service SearchService) http.Handler {
+	h := &searchHandler{
+		service: service,
+	}
+
+	mr.HandleFunc("/search", h.Search).Methods("GET")
+
+	return mr
+}
+
+type searchHandler struct {
+	service SearchService
+}
+
+func (h *searchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	query := Query{
+		Text: q.Get("q"),
+	}
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			common.MakeError(w, http.StatusBadRequest, "search", "Invalid limit", "search")
+			return
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil {
+			common.MakeError(w, http.StatusBadRequest, "search", "Invalid offset", "search")
+			return
+		}
+	}
+
+	page, err := h.service.Search(ctx, query)
+
+	if err == ErrEmptyQuery {
+		common.MakeError(w, http.StatusBadRequest, "search", err.Error(), "search")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "search", "Server Error", "search")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, page)
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"github.com/holmes89/book-organizer/internal/documents"
+	"math"
+	"sort"
+	"strings"
+)
+
+// MatchThreshold is the lowest score a document can match a book with, matches within
+// ambiguityMargin of the next best document are left for the user to resolve.
+const (
+	MatchThreshold  = 0.6
+	ambiguityMargin = 0.1
+	maxCandidates   = 3
+)
+
+// MatchCandidate is a document that could be the book being matched.
+type MatchCandidate struct {
+	DocumentID string  `json:"document_id"`
+	Title      string  `json:"title"`
+	Score      float64 `json:"score"`
+}
+
+// MatchDocument scores every document against a book by the words their titles and
+// authors share. The best document is only returned when it is a clear match, otherwise the
+// closest documents are returned as candidates.
+func MatchDocument(title string, author string, docs []*documents.Document) (*documents.Document, float64, []*MatchCandidate) {
+	var candidates []*MatchCandidate
+	byID := map[string]*documents.Document{}
+	for _, doc := range docs {
+		// rounded so scores in the report read cleanly
+		score := math.Round(matchScore(title, author, doc)*100) / 100
+		if score == 0 {
+			continue
+		}
+		byID[doc.ID] = doc
+		candidates = append(candidates, &MatchCandidate{DocumentID: doc.ID, Title: documentTitle(doc), Score: score})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+	if len(candidates) == 0 || candidates[0].Score < MatchThreshold {
+		return nil, 0, candidates
+	}
+	if len(candidates) > 1 && candidates[0].Score-candidates[1].Score < ambiguityMargin {
+		return nil, 0, candidates
+	}
+	return byID[candidates[0].DocumentID], candidates[0].Score, nil
+}
+
+// matchScore is how alike a book and a document are from 0 to 1. Subtitles are often left off
+// one or the other so the better of the full and main title is used, authors count for a fifth
+// when both sides have them.
+func matchScore(title string, author string, doc *documents.Document) float64 {
+	best := 0.0
+	for _, docTitle := range []string{doc.Title, doc.DisplayName} {
+		if docTitle == "" {
+			continue
+		}
+		for _, pair := range [][2]string{{title, docTitle}, {mainTitle(title), mainTitle(docTitle)}} {
+			if score := wordOverlap(pair[0], pair[1]); score > best {
+				best = score
+			}
+		}
+	}
+	if best == 0 || author == "" || len(doc.Authors) == 0 {
+		return best
+	}
+	return 0.8*best + 0.2*wordOverlap(author, strings.Join(doc.Authors, " "))
+}
+
+func mainTitle(title string) string {
+	if i := strings.IndexAny(title, ":("); i > 0 {
+		return title[:i]
+	}
+	return title
+}
+
+var titleStopWords = map[string]bool{"the": true, "a": true, "an": true, "and": true, "of": true}
+
+// wordOverlap is the dice coefficient of the words in two strings.
+func wordOverlap(a string, b string) float64 {
+	words := func(s string) map[string]bool {
+		set := map[string]bool{}
+		for _, term := range Terms(s) {
+			if !titleStopWords[term] {
+				set[term] = true
+			}
+		}
+		return set
+	}
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range wa {
+		if wb[w] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(wa)+len(wb))
+}
+
+func documentTitle(doc *documents.Document) string {
+	if doc.Title != "" {
+		return doc.Title
+	}
+	return doc.DisplayName
+}
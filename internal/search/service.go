@@ -0,0 +1,120 @@
+package search
+
+import (
+	"context"
+	"github.com/holmes89/book-organizer/internal/documents"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+var (
+	ErrEmptyQuery = errors.New("search query required")
+)
+
+// Hit is a ranked match returned by a repository, Snippet is escaped HTML marking matching
+// terms with <mark>.
+type Hit struct {
+	ID      string
+	Rank    float64
+	Snippet string
+}
+
+type Result struct {
+	Document *documents.Document `json:"document"`
+	Rank     float64             `json:"rank"`
+	Snippet  string              `json:"snippet"`
+}
+
+type ResultPage struct {
+	Items  []*Result `json:"items"`
+	Total  int       `json:"total"`
+	Limit  int       `json:"limit"`
+	Offset int       `json:"offset"`
+}
+
+type Query struct {
+	Text   string
+	Limit  int
+	Offset int
+}
+
+type SearchService interface {
+	Search(ctx context.Context, query Query) (*ResultPage, error)
+}
+
+type SearchRepository interface {
+	// SearchDocuments returns the page of hits ordered by rank and the total number of matches.
+	SearchDocuments(ctx context.Context, query Query) ([]Hit, int, error)
+}
+
+type searchService struct {
+	repo    SearchRepository
+	docRepo documents.DocumentRepository
+}
+
+func NewSearchService(repo SearchRepository, docRepo documents.DocumentRepository) SearchService {
+	return &searchService{
+		repo:    repo,
+		docRepo: docRepo,
+	}
+}
+
+func (s *searchService) Search(ctx context.Context, query Query) (*ResultPage, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if len(Terms(query.Text)) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	if query.Limit <= 0 {
+		query.Limit = documents.DefaultPageSize
+	}
+	if query.Limit > documents.MaxPageSize {
+		query.Limit = documents.MaxPageSize
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	hits, total, err := s.repo.SearchDocuments(ctx, query)
+	if err != nil {
+		logrus.WithError(err).WithField("query", query.Text).Error("unable to search repository")
+		return nil, errors.Wrap(err, "unable to search repository")
+	}
+
+	page := &ResultPage{
+		Items:  []*Result{},
+		Total:  total,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+	}
+	if len(hits) == 0 {
+		return page, nil
+	}
+
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	docs, err := s.docRepo.FindAll(ctx, map[string]interface{}{"documents.id": ids})
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch search results from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	byID := make(map[string]*documents.Document, len(docs))
+	for _, doc := range docs {
+		byID[doc.ID] = doc
+	}
+
+	for _, hit := range hits {
+		doc, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		page.Items = append(page.Items, &Result{
+			Document: doc,
+			Rank:     hit.Rank,
+			Snippet:  hit.Snippet,
+		})
+	}
+	return page, nil
+}
@@ -0,0 +1,96 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Backends put these around matching terms when they build a snippet, rather than markup, so
+// the document text can be escaped before MarkSnippet swaps them for <mark> tags.
+const (
+	MatchStart = "\ue000"
+	MatchEnd   = "\ue001"
+)
+
+var snippetMarks = strings.NewReplacer(MatchStart, "<mark>", MatchEnd, "</mark>")
+
+// Terms splits a query into the lower cased words every backend matches on.
+func Terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// MarkSnippet escapes a snippet built with MatchStart and MatchEnd for use as HTML and marks the
+// matching terms with <mark>.
+func MarkSnippet(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(snippet))
+}
+
+// Highlight returns an escaped excerpt of text around the first matching term with every term
+// wrapped in <mark>, for backends without their own snippet support.
+func Highlight(text string, terms []string, width int) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// lower casing changed byte offsets, highlight the lower cased text instead
+		text = lower
+	}
+	first := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	start := first - width/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + width
+	if end > len(text) {
+		end = len(text)
+	}
+	// stay on rune boundaries
+	for start > 0 && !utf8Start(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8Start(text[end]) {
+		end++
+	}
+
+	excerpt := text[start:end]
+	lowerExcerpt := lower[start:end]
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	for i := 0; i < len(excerpt); {
+		matched := ""
+		for _, term := range terms {
+			if strings.HasPrefix(lowerExcerpt[i:], term) && len(term) > len(matched) {
+				matched = term
+			}
+		}
+		if matched == "" {
+			b.WriteByte(excerpt[i])
+			i++
+			continue
+		}
+		b.WriteString(MatchStart)
+		b.WriteString(excerpt[i : i+len(matched)])
+		b.WriteString(MatchEnd)
+		i += len(matched)
+	}
+	if end < len(text) {
+		b.WriteString("...")
+	}
+	return MarkSnippet(b.String())
+}
+
+func utf8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
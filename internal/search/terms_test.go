@@ -0,0 +1,58 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	got := Terms("The Left-Hand of DARKNESS, 1969!")
+	want := []string{"the", "left", "hand", "of", "darkness", "1969"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMarkSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"plain", "a " + MatchStart + "dragon" + MatchEnd + " sleeps", "a <mark>dragon</mark> sleeps"},
+		{"markup in text", "<script>alert(1)</script> " + MatchStart + "dragon" + MatchEnd, "&lt;script&gt;alert(1)&lt;/script&gt; <mark>dragon</mark>"},
+		{"markup in match", MatchStart + "<b>" + MatchEnd, "<mark>&lt;b&gt;</mark>"},
+		{"entities", `Tom & "Jerry"`, "Tom &amp; &#34;Jerry&#34;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MarkSnippet(tt.snippet); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		width int
+		want  string
+	}{
+		{"no match", "a wizard of earthsea", []string{"dragon"}, 40, ""},
+		{"whole text", "a wizard of earthsea", []string{"wizard"}, 40, "a <mark>wizard</mark> of earthsea"},
+		{"longest term wins", "earthsea", []string{"earth", "earthsea"}, 40, "<mark>earthsea</mark>"},
+		{"excerpt", "one two three four five six seven", []string{"four"}, 10, "...hree <mark>four</mark> ..."},
+		{"escapes text", `<img src=x onerror=alert(1)> the dragon`, []string{"dragon"}, 80, "&lt;img src=x onerror=alert(1)&gt; the <mark>dragon</mark>"},
+		{"escapes match", "a <dragon> appears", []string{"dragon"}, 80, "a &lt;<mark>dragon</mark>&gt; appears"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.text, tt.terms, tt.width); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
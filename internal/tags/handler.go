@@ -0,0 +1,252 @@
+package tags
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+func MakeTagHandler(mr *mux.Router, service TagService) http.Handler {
+	r := mr.PathPrefix("/tags").Subrouter()
+
+	h := &tagHandler{
+		service: service,
+	}
+
+	r.HandleFunc("/", h.FindAll).Methods("GET")
+	r.HandleFunc("/", h.Create).Methods("POST")
+	r.HandleFunc("/{id}", h.FindByID).Methods("GET")
+	r.HandleFunc("/{id}", h.Rename).Methods("PATCH")
+	r.HandleFunc("/{id}", h.Delete).Methods("DELETE")
+
+	mr.HandleFunc("/documents/{id}/tags", h.FindByResource).Methods("GET")
+	mr.HandleFunc("/documents/{id}/tags", h.Attach).Methods("POST")
+	mr.HandleFunc("/documents/{id}/tags/{tagID}", h.Detach).Methods("DELETE")
+
+	return r
+}
+
+type tagHandler struct {
+	service TagService
+}
+
+func (h *tagHandler) FindAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	entities, err := h.service.FindAll(ctx)
+
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "tag", "Server Error", "findall")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entities)
+}
+
+func (h *tagHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	b, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	tag := &Tag{}
+	if err := json.Unmarshal(b, tag); err != nil {
+		logrus.WithError(err).Error("unable to unmarshal tag")
+		common.MakeError(w, http.StatusBadRequest, "tag", "Bad Request", "create")
+		return
+	}
+
+	err := h.service.Create(ctx, tag)
+	if err == ErrInvalidName {
+		common.MakeError(w, http.StatusBadRequest, "tag", err.Error(), "create")
+		return
+	}
+	if err == ErrNameTaken {
+		common.MakeError(w, http.StatusConflict, "tag", err.Error(), "create")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "tag", "Server Error", "create")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	common.EncodeResponse(r.Context(), w, tag)
+}
+
+func (h *tagHandler) FindByID(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	id, ok := vars["id"]
+
+	if !ok {
+		common.MakeError(w, http.StatusBadRequest, "tag", "Missing Id", "findbyid")
+		return
+	}
+
+	entity, err := h.service.FindByID(ctx, id)
+
+	if err == ErrNotFound {
+		common.MakeError(w, http.StatusNotFound, "tag", "Not Found", "findbyid")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "tag", "Server Error", "findbyid")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entity)
+}
+
+func (h *tagHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	b, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	req := Tag{}
+	if err := json.Unmarshal(b, &req); err != nil {
+		logrus.WithError(err).Error("unable to unmarshal tag")
+		common.MakeError(w, http.StatusBadRequest, "tag", "Bad Request", "rename")
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id, ok := vars["id"]
+
+	if !ok {
+		common.MakeError(w, http.StatusBadRequest, "tag", "Missing Id", "rename")
+		return
+	}
+
+	entity, err := h.service.Rename(ctx, id, req.Name)
+
+	switch err {
+	case nil:
+	case ErrInvalidName:
+		common.MakeError(w, http.StatusBadRequest, "tag", err.Error(), "rename")
+		return
+	case ErrNotFound:
+		common.MakeError(w, http.StatusNotFound, "tag", "Not Found", "rename")
+		return
+	case ErrNameTaken:
+		common.MakeError(w, http.StatusConflict, "tag", err.Error(), "rename")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "tag", "Server Error", "rename")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entity)
+}
+
+func (h *tagHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	id, ok := vars["id"]
+
+	if !ok {
+		common.MakeError(w, http.StatusBadRequest, "tag", "Missing Id", "delete")
+		return
+	}
+
+	err := h.service.Delete(ctx, id)
+	if err == ErrNotFound {
+		common.MakeError(w, http.StatusNotFound, "tag", "Not Found", "delete")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "tag", "Server Error", "delete")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, map[string]string{"status": "success"})
+}
+
+func (h *tagHandler) FindByResource(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	id, ok := vars["id"]
+
+	if !ok {
+		common.MakeError(w, http.StatusBadRequest, "tag", "Missing Id", "findbyresource")
+		return
+	}
+
+	entities, err := h.service.FindByResource(ctx, id)
+
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "tag", "Server Error", "findbyresource")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entities)
+}
+
+func (h *tagHandler) Attach(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	b, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	tag := &Tag{}
+	if err := json.Unmarshal(b, tag); err != nil {
+		logrus.WithError(err).Error("unable to unmarshal tag")
+		common.MakeError(w, http.StatusBadRequest, "tag", "Bad Request", "attach")
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	id, ok := vars["id"]
+
+	if !ok {
+		common.MakeError(w, http.StatusBadRequest, "tag", "Missing Id", "attach")
+		return
+	}
+
+	err := h.service.Attach(ctx, id, tag)
+
+	switch err {
+	case nil:
+	case ErrInvalidName:
+		common.MakeError(w, http.StatusBadRequest, "tag", err.Error(), "attach")
+		return
+	case ErrNotFound, ErrResourceNotFound:
+		common.MakeError(w, http.StatusNotFound, "tag", "Not Found", "attach")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "tag", "Server Error", "attach")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	common.EncodeResponse(r.Context(), w, tag)
+}
+
+func (h *tagHandler) Detach(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	id, ok := vars["id"]
+	tagID, tagOk := vars["tagID"]
+
+	if !ok || !tagOk {
+		common.MakeError(w, http.StatusBadRequest, "tag", "Missing Id", "detach")
+		return
+	}
+
+	if err := h.service.Detach(ctx, id, tagID); err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "tag", "Server Error", "detach")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, map[string]string{"status": "success"})
+}
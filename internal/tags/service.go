@@ -0,0 +1,208 @@
+package tags
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidName = errors.New("tag name required")
+	ErrNotFound    = errors.New("tag not found")
+	ErrNameTaken   = errors.New("tag name already taken")
+	// ErrResourceNotFound is returned when tagging something that doesn't exist or belongs to someone else.
+	ErrResourceNotFound = errors.New("resource not found")
+)
+
+type Tag struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	UserID  string    `json:"user_id"` // owner, names are unique per user and tags only visible to them
+}
+
+type TagService interface {
+	FindAll(ctx context.Context) ([]*Tag, error)
+	FindByID(ctx context.Context, id string) (*Tag, error)
+	Create(ctx context.Context, tag *Tag) error
+	Rename(ctx context.Context, id string, name string) (*Tag, error)
+	Delete(ctx context.Context, id string) error
+	FindByResource(ctx context.Context, resourceID string) ([]*Tag, error)
+	Attach(ctx context.Context, resourceID string, tag *Tag) error
+	Detach(ctx context.Context, resourceID string, tagID string) error
+}
+
+// TagRepository methods are prefixed so a single database type can also implement the document repository.
+// Tags are scoped to the user of the context like documents.
+type TagRepository interface {
+	FindAllTags(ctx context.Context) ([]*Tag, error)
+	FindTagByID(ctx context.Context, id string) (*Tag, error)
+	FindTagByName(ctx context.Context, name string) (*Tag, error)
+	InsertTag(ctx context.Context, tag *Tag) error
+	UpdateTag(ctx context.Context, tag Tag) (Tag, error)
+	DeleteTag(ctx context.Context, id string) error
+	FindTagsByResource(ctx context.Context, resourceID string) ([]*Tag, error)
+	TagResource(ctx context.Context, tagID string, resourceID string) error
+	UntagResource(ctx context.Context, tagID string, resourceID string) error
+}
+
+type tagService struct {
+	repo TagRepository
+}
+
+func NewTagService(repo TagRepository) TagService {
+	return &tagService{
+		repo: repo,
+	}
+}
+
+func (s *tagService) FindAll(ctx context.Context) ([]*Tag, error) {
+	entities, err := s.repo.FindAllTags(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch tags from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return entities, nil
+}
+
+func (s *tagService) FindByID(ctx context.Context, id string) (*Tag, error) {
+	entity, err := s.repo.FindTagByID(ctx, id)
+	if err == ErrNotFound {
+		return nil, err
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to fetch tag from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return entity, nil
+}
+
+func (s *tagService) Create(ctx context.Context, tag *Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return ErrInvalidName
+	}
+	if err := s.checkName(ctx, tag.Name, ""); err != nil {
+		return err
+	}
+
+	tag.ID = uuid.New().String()
+	tag.Created = time.Now()
+	tag.UserID = common.UserID(ctx)
+
+	if err := s.repo.InsertTag(ctx, tag); err != nil {
+		logrus.WithError(err).Error("unable to save tag to repo")
+		return errors.Wrap(err, "failed to store data in repo")
+	}
+	return nil
+}
+
+func (s *tagService) Rename(ctx context.Context, id string, name string) (*Tag, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrInvalidName
+	}
+
+	entity, err := s.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkName(ctx, name, id); err != nil {
+		return nil, err
+	}
+	entity.Name = name
+
+	updated, err := s.repo.UpdateTag(ctx, *entity)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to rename tag")
+		return nil, errors.Wrap(err, "unable to rename tag")
+	}
+	return &updated, nil
+}
+
+// checkName returns ErrNameTaken when the user has a tag other than exclude by the name, names
+// ignore case.
+func (s *tagService) checkName(ctx context.Context, name string, exclude string) error {
+	existing, err := s.repo.FindTagByName(ctx, name)
+	switch {
+	case err == ErrNotFound:
+		return nil
+	case err != nil:
+		logrus.WithError(err).WithField("name", name).Error("unable to fetch tag by name")
+		return errors.Wrap(err, "unable to fetch from repository")
+	case existing.ID != exclude:
+		return ErrNameTaken
+	}
+	return nil
+}
+
+func (s *tagService) Delete(ctx context.Context, id string) error {
+	err := s.repo.DeleteTag(ctx, id)
+	if err == ErrNotFound {
+		return err
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to delete tag")
+		return errors.Wrap(err, "unable to delete tag")
+	}
+	return nil
+}
+
+func (s *tagService) FindByResource(ctx context.Context, resourceID string) ([]*Tag, error) {
+	entities, err := s.repo.FindTagsByResource(ctx, resourceID)
+	if err != nil {
+		logrus.WithError(err).WithField("resource", resourceID).Error("unable to fetch tags for resource")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return entities, nil
+}
+
+// Attach tags a resource with an existing tag by id, or by name creating the tag if it is new.
+func (s *tagService) Attach(ctx context.Context, resourceID string, tag *Tag) error {
+	if tag.ID == "" {
+		name := strings.TrimSpace(tag.Name)
+		if name == "" {
+			return ErrInvalidName
+		}
+		existing, err := s.repo.FindTagByName(ctx, name)
+		switch {
+		case err == ErrNotFound:
+			if err := s.Create(ctx, tag); err != nil {
+				return err
+			}
+		case err != nil:
+			logrus.WithError(err).WithField("name", name).Error("unable to fetch tag by name")
+			return errors.Wrap(err, "unable to fetch from repository")
+		default:
+			*tag = *existing
+		}
+	} else {
+		existing, err := s.FindByID(ctx, tag.ID)
+		if err != nil {
+			return err
+		}
+		*tag = *existing
+	}
+
+	err := s.repo.TagResource(ctx, tag.ID, resourceID)
+	if err == ErrResourceNotFound {
+		return err
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"tag": tag.ID, "resource": resourceID}).Error("unable to tag resource")
+		return errors.Wrap(err, "unable to tag resource")
+	}
+	return nil
+}
+
+func (s *tagService) Detach(ctx context.Context, resourceID string, tagID string) error {
+	if err := s.repo.UntagResource(ctx, tagID, resourceID); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"tag": tagID, "resource": resourceID}).Error("unable to untag resource")
+		return errors.Wrap(err, "unable to untag resource")
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package users
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+func MakeUserHandler(mr *mux.Router, service UserService) http.Handler {
+	r := mr.PathPrefix("/users").Subrouter()
+
+	h := &userHandler{
+		service: service,
+	}
+
+	mr.HandleFunc("/auth/login", h.Login).Methods("POST")
+
+	r.HandleFunc("/me", h.Me).Methods("GET")
+	r.HandleFunc("/me/password", h.ChangePassword).Methods("PUT")
+	r.HandleFunc("/", h.FindAll).Methods("GET")
+	r.HandleFunc("/", h.Create).Methods("POST")
+
+	return r
+}
+
+type userHandler struct {
+	service UserService
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Admin    bool   `json:"admin"`
+}
+
+type passwordChange struct {
+	Current  string `json:"current_password"`
+	Password string `json:"password"`
+}
+
+func (h *userHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	b, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	creds := credentials{}
+	if err := json.Unmarshal(b, &creds); err != nil {
+		logrus.WithError(err).Error("unable to unmarshal credentials")
+		common.MakeError(w, http.StatusBadRequest, "user", "Bad Request", "login")
+		return
+	}
+
+	token, err := h.service.Login(ctx, creds.Username, creds.Password)
+	if err == ErrInvalidCredentials {
+		common.MakeError(w, http.StatusUnauthorized, "user", err.Error(), "login")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "user", "Server Error", "login")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, token)
+}
+
+func (h *userHandler) Me(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	entity, err := h.service.FindByID(ctx, common.UserID(ctx))
+	if err == ErrNotFound {
+		common.MakeError(w, http.StatusNotFound, "user", "Not Found", "me")
+		return
+	}
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "user", "Server Error", "me")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entity)
+}
+
+func (h *userHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	b, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	change := passwordChange{}
+	if err := json.Unmarshal(b, &change); err != nil {
+		logrus.WithError(err).Error("unable to unmarshal password")
+		common.MakeError(w, http.StatusBadRequest, "user", "Bad Request", "changepassword")
+		return
+	}
+
+	err := h.service.ChangePassword(ctx, common.UserID(ctx), change.Current, change.Password)
+	switch err {
+	case nil:
+	case ErrWeakPassword:
+		common.MakeError(w, http.StatusBadRequest, "user", err.Error(), "changepassword")
+		return
+	case ErrInvalidCredentials:
+		common.MakeError(w, http.StatusForbidden, "user", "current password is incorrect", "changepassword")
+		return
+	case ErrNotFound:
+		common.MakeError(w, http.StatusNotFound, "user", "Not Found", "changepassword")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "user", "Server Error", "changepassword")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FindAll lists every account, only admins can see them.
+func (h *userHandler) FindAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !common.IsAdmin(ctx) {
+		common.MakeError(w, http.StatusForbidden, "user", "Forbidden", "findall")
+		return
+	}
+
+	entities, err := h.service.FindAll(ctx)
+	if err != nil {
+		common.MakeError(w, http.StatusInternalServerError, "user", "Server Error", "findall")
+		return
+	}
+
+	common.EncodeResponse(r.Context(), w, entities)
+}
+
+// Create adds an account, only admins can add them.
+func (h *userHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !common.IsAdmin(ctx) {
+		common.MakeError(w, http.StatusForbidden, "user", "Forbidden", "create")
+		return
+	}
+
+	b, _ := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	creds := credentials{}
+	if err := json.Unmarshal(b, &creds); err != nil {
+		logrus.WithError(err).Error("unable to unmarshal user")
+		common.MakeError(w, http.StatusBadRequest, "user", "Bad Request", "create")
+		return
+	}
+
+	user := &User{Username: creds.Username, Admin: creds.Admin}
+	err := h.service.Create(ctx, user, creds.Password)
+	switch err {
+	case nil:
+	case ErrInvalidUsername, ErrWeakPassword:
+		common.MakeError(w, http.StatusBadRequest, "user", err.Error(), "create")
+		return
+	case ErrUsernameTaken:
+		common.MakeError(w, http.StatusConflict, "user", err.Error(), "create")
+		return
+	default:
+		common.MakeError(w, http.StatusInternalServerError, "user", "Server Error", "create")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	common.EncodeResponse(r.Context(), w, user)
+}
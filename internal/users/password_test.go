@@ -0,0 +1,71 @@
+package users
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// TestPBKDF2 checks the key derivation against the PBKDF2-HMAC-SHA256 vectors of RFC 7914 section 11.
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+			"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+			"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			want, _ := hex.DecodeString(tt.want)
+			got := pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, len(want))
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("got %x, want %s", got, tt.want)
+			}
+			// shorter keys are a prefix of the full one
+			if short := pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, 20); hex.EncodeToString(short) != tt.want[:40] {
+				t.Errorf("got %x, want %s", short, tt.want[:40])
+			}
+		})
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(hash, passwordScheme+"$600000$") {
+		t.Errorf("hash %q doesn't record the scheme and work factor", hash)
+	}
+	if other, _ := hashPassword("correct horse"); other == hash {
+		t.Error("hashing twice gave the same salt")
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"match", hash, "correct horse", true},
+		{"wrong password", hash, "correct horsE", false},
+		{"empty password", hash, "", false},
+		{"fewer iterations", strings.Replace(hash, "$600000$", "$1$", 1), "correct horse", false},
+		{"unknown scheme", strings.Replace(hash, passwordScheme, "bcrypt", 1), "correct horse", false},
+		{"bad iterations", strings.Replace(hash, "$600000$", "$x$", 1), "correct horse", false},
+		{"missing parts", passwordScheme + "$600000$", "correct horse", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkPassword(tt.hash, tt.password); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/holmes89/book-organizer/internal/common"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/fx"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinPasswordLength is the shortest password an account can have.
+const MinPasswordLength = 8
+
+// credentialTTL is how long a verified password is remembered, e-readers send basic auth with
+// every request and hashing it each time would make browsing slow.
+const credentialTTL = 10 * time.Minute
+
+var (
+	ErrNotFound           = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrInvalidUsername    = errors.New("username required")
+	ErrWeakPassword       = errors.New("password must be at least 8 characters")
+	ErrUsernameTaken      = errors.New("username already taken")
+)
+
+type User struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Admin        bool      `json:"admin"`
+	Created      time.Time `json:"created"`
+}
+
+// Token is issued on login, it is sent as a bearer token or as the token parameter of the OPDS
+// catalog.
+type Token struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+	User    *User     `json:"user"`
+}
+
+type UserService interface {
+	Login(ctx context.Context, username string, password string) (*Token, error)
+	// Authenticate checks a username and password without issuing a token.
+	Authenticate(ctx context.Context, username string, password string) (*User, error)
+	// Verify returns the user a token was issued to.
+	Verify(ctx context.Context, token string) (*User, error)
+	FindAll(ctx context.Context) ([]*User, error)
+	FindByID(ctx context.Context, id string) (*User, error)
+	Create(ctx context.Context, user *User, password string) error
+	ChangePassword(ctx context.Context, id string, current string, password string) error
+}
+
+// UserRepository methods are prefixed so a single database type can also implement the document repository.
+type UserRepository interface {
+	FindAllUsers(ctx context.Context) ([]*User, error)
+	FindUserByID(ctx context.Context, id string) (*User, error)
+	// FindUserByUsername ignores case, usernames are unique regardless of it.
+	FindUserByUsername(ctx context.Context, username string) (*User, error)
+	InsertUser(ctx context.Context, user *User) error
+	UpdateUserPassword(ctx context.Context, id string, passwordHash string) error
+	// AdoptDocuments gives documents and tags without an owner, such as those added before
+	// accounts existed, to the user and returns how many documents there were.
+	AdoptDocuments(ctx context.Context, userID string) (int, error)
+}
+
+type userService struct {
+	repo   UserRepository
+	config common.AuthConfig
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]time.Time // passwords checked recently, by hash and password
+}
+
+func NewUserService(lc fx.Lifecycle, repo UserRepository, config common.AuthConfig) UserService {
+	s := &userService{
+		repo:     repo,
+		config:   config,
+		verified: map[[sha256.Size]byte]time.Time{},
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.bootstrap(ctx)
+			return nil
+		},
+	})
+	return s
+}
+
+// bootstrap creates the admin account on first start and gives it the documents that were
+// added before there were accounts.
+func (s *userService) bootstrap(ctx context.Context) {
+	all, err := s.repo.FindAllUsers(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch users")
+		return
+	}
+	if len(all) == 0 {
+		if s.config.AdminUsername == "" || s.config.AdminPassword == "" {
+			logrus.Warn("no user accounts, set ADMIN_USERNAME and ADMIN_PASSWORD to create one")
+			return
+		}
+		admin := &User{Username: s.config.AdminUsername, Admin: true}
+		if err := s.Create(ctx, admin, s.config.AdminPassword); err != nil {
+			logrus.WithError(err).Error("unable to create admin account")
+			return
+		}
+		logrus.WithField("username", admin.Username).Info("admin account created")
+		all = append(all, admin)
+	}
+
+	var owner *User
+	for _, user := range all {
+		if user.Admin && (owner == nil || user.Created.Before(owner.Created)) {
+			owner = user
+		}
+	}
+	if owner == nil {
+		return
+	}
+	adopted, err := s.repo.AdoptDocuments(ctx, owner.ID)
+	if err != nil {
+		logrus.WithError(err).Error("unable to assign documents without an owner")
+		return
+	}
+	if adopted > 0 {
+		logrus.WithFields(logrus.Fields{"username": owner.Username, "documents": adopted}).Info("documents without an owner assigned")
+	}
+}
+
+func (s *userService) Login(ctx context.Context, username string, password string) (*Token, error) {
+	user, err := s.Authenticate(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(s.config.TokenTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   user.ID,
+		"name":  user.Username,
+		"admin": user.Admin,
+		"ver":   credentialVersion(user.PasswordHash),
+		"iat":   time.Now().Unix(),
+		"exp":   expires.Unix(),
+	})
+	signed, err := token.SignedString([]byte(s.config.Secret))
+	if err != nil {
+		logrus.WithError(err).Error("unable to sign token")
+		return nil, errors.Wrap(err, "unable to sign token")
+	}
+	return &Token{Token: signed, Expires: expires, User: user}, nil
+}
+
+func (s *userService) Authenticate(ctx context.Context, username string, password string) (*User, error) {
+	user, err := s.repo.FindUserByUsername(ctx, strings.TrimSpace(username))
+	if err == ErrNotFound {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch user")
+		return nil, errors.Wrap(err, "unable to fetch user")
+	}
+	if !s.checkPassword(user.PasswordHash, password) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// checkPassword remembers passwords that matched for a while. Entries are keyed by the stored
+// hash as well so a changed password no longer matches them.
+func (s *userService) checkPassword(hash string, password string) bool {
+	key := credentialKey(hash, password)
+	now := time.Now()
+
+	s.mu.Lock()
+	for k, expires := range s.verified {
+		if now.After(expires) {
+			delete(s.verified, k)
+		}
+	}
+	_, ok := s.verified[key]
+	s.mu.Unlock()
+	if ok {
+		return true
+	}
+
+	if !checkPassword(hash, password) {
+		return false
+	}
+	s.mu.Lock()
+	s.verified[key] = now.Add(credentialTTL)
+	s.mu.Unlock()
+	return true
+}
+
+func (s *userService) Verify(ctx context.Context, tokenString string) (*User, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(s.config.Secret), nil
+	})
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	id, _ := claims["sub"].(string)
+	if id == "" {
+		return nil, ErrInvalidToken
+	}
+	// the account may have been removed or changed since the token was issued
+	user, err := s.repo.FindUserByID(ctx, id)
+	if err == ErrNotFound {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch user")
+		return nil, errors.Wrap(err, "unable to fetch user")
+	}
+	// tokens issued before the password was last changed are revoked with it
+	if version, _ := claims["ver"].(string); version != credentialVersion(user.PasswordHash) {
+		return nil, ErrInvalidToken
+	}
+	return user, nil
+}
+
+// credentialVersion identifies the password of an account without revealing it, the hash is
+// salted anew on every change so tokens carrying the version stop matching.
+func credentialVersion(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:8])
+}
+
+func credentialKey(hash string, password string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(hash + "\x00" + password))
+}
+
+func (s *userService) FindAll(ctx context.Context) ([]*User, error) {
+	entities, err := s.repo.FindAllUsers(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("unable to fetch users from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return entities, nil
+}
+
+func (s *userService) FindByID(ctx context.Context, id string) (*User, error) {
+	entity, err := s.repo.FindUserByID(ctx, id)
+	if err == ErrNotFound {
+		return nil, err
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to fetch user from repository")
+		return nil, errors.Wrap(err, "unable to fetch from repository")
+	}
+	return entity, nil
+}
+
+func (s *userService) Create(ctx context.Context, user *User, password string) error {
+	user.Username = strings.TrimSpace(user.Username)
+	if user.Username == "" {
+		return ErrInvalidUsername
+	}
+	if len(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	_, err := s.repo.FindUserByUsername(ctx, user.Username)
+	switch {
+	case err == nil:
+		return ErrUsernameTaken
+	case err != ErrNotFound:
+		logrus.WithError(err).Error("unable to check username")
+		return errors.Wrap(err, "unable to check username")
+	}
+
+	if user.PasswordHash, err = hashPassword(password); err != nil {
+		return err
+	}
+	user.ID = uuid.New().String()
+	user.Created = time.Now()
+	if err := s.repo.InsertUser(ctx, user); err != nil {
+		logrus.WithError(err).Error("unable to save user")
+		return errors.Wrap(err, "unable to save user")
+	}
+	return nil
+}
+
+// ChangePassword replaces the password of an account once the current one is confirmed, tokens
+// issued and basic auth passwords remembered until then no longer work.
+func (s *userService) ChangePassword(ctx context.Context, id string, current string, password string) error {
+	user, err := s.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !checkPassword(user.PasswordHash, current) {
+		return ErrInvalidCredentials
+	}
+	if len(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdateUserPassword(ctx, id, hash); err != nil {
+		logrus.WithError(err).WithField("id", id).Error("unable to update password")
+		return errors.Wrap(err, "unable to update password")
+	}
+	s.mu.Lock()
+	delete(s.verified, credentialKey(user.PasswordHash, current))
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,212 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/holmes89/book-organizer/internal/common"
+	"strings"
+	"testing"
+	"time"
+)
+
+// userRepository keeps accounts in a map, the database package can't be imported from here.
+type userRepository map[string]*User
+
+func (r userRepository) FindAllUsers(ctx context.Context) ([]*User, error) {
+	results := []*User{}
+	for _, user := range r {
+		u := *user
+		results = append(results, &u)
+	}
+	return results, nil
+}
+
+func (r userRepository) FindUserByID(ctx context.Context, id string) (*User, error) {
+	user, ok := r[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+func (r userRepository) FindUserByUsername(ctx context.Context, username string) (*User, error) {
+	for _, user := range r {
+		if strings.EqualFold(user.Username, username) {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r userRepository) InsertUser(ctx context.Context, user *User) error {
+	u := *user
+	r[user.ID] = &u
+	return nil
+}
+
+func (r userRepository) UpdateUserPassword(ctx context.Context, id string, passwordHash string) error {
+	user, ok := r[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.PasswordHash = passwordHash
+	return nil
+}
+
+func (r userRepository) AdoptDocuments(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+func newTestService(t *testing.T, ttl time.Duration) (*userService, *User) {
+	s := &userService{
+		repo:     userRepository{},
+		config:   common.AuthConfig{Secret: "s3cret", TokenTTL: ttl},
+		verified: map[[sha256.Size]byte]time.Time{},
+	}
+	user := &User{Username: "Reader"}
+	if err := s.Create(context.Background(), user, "correct horse"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return s, user
+}
+
+func TestLogin(t *testing.T) {
+	s, user := newTestService(t, time.Hour)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{"valid", "Reader", "correct horse", nil},
+		{"username ignores case and spaces", " reader ", "correct horse", nil},
+		{"wrong password", "Reader", "wrong horse", ErrInvalidCredentials},
+		{"unknown user", "writer", "correct horse", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := s.Login(ctx, tt.username, tt.password)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if token.User.ID != user.ID {
+				t.Errorf("token for %q, want %q", token.User.ID, user.ID)
+			}
+			if until := time.Until(token.Expires); until <= 0 || until > time.Hour {
+				t.Errorf("token expires in %s, want within an hour", until)
+			}
+			verified, err := s.Verify(ctx, token.Token)
+			if err != nil {
+				t.Fatalf("unable to verify token: %v", err)
+			}
+			if verified.ID != user.ID {
+				t.Errorf("verified %q, want %q", verified.ID, user.ID)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s, user := newTestService(t, time.Hour)
+	ctx := context.Background()
+
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		signed, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("unable to sign token: %v", err)
+		}
+		return signed
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+	secret := []byte("s3cret")
+	version := credentialVersion(user.PasswordHash)
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": user.ID, "ver": version, "exp": expires}), nil},
+		{"other secret", sign(jwt.SigningMethodHS256, []byte("guess"), jwt.MapClaims{"sub": user.ID, "ver": version, "exp": expires}), ErrInvalidToken},
+		{"expired", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": user.ID, "ver": version, "exp": time.Now().Add(-time.Minute).Unix()}), ErrInvalidToken},
+		{"unsigned", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"sub": user.ID, "ver": version, "exp": expires}), ErrInvalidToken},
+		{"no subject", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"ver": version, "exp": expires}), ErrInvalidToken},
+		{"no version", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": user.ID, "exp": expires}), ErrInvalidToken},
+		{"old password", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": user.ID, "ver": credentialVersion("old"), "exp": expires}), ErrInvalidToken},
+		{"removed account", sign(jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "gone", "ver": version, "exp": expires}), ErrInvalidToken},
+		{"garbage", "not.a.token", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Verify(ctx, tt.token)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err == nil && got.ID != user.ID {
+				t.Errorf("verified %q, want %q", got.ID, user.ID)
+			}
+		})
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	s, _ := newTestService(t, -time.Minute)
+	ctx := context.Background()
+
+	token, err := s.Login(ctx, "Reader", "correct horse")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.Verify(ctx, token.Token); err != ErrInvalidToken {
+		t.Errorf("got error %v for an expired token, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s, user := newTestService(t, time.Hour)
+	ctx := context.Background()
+
+	old, err := s.Login(ctx, "Reader", "correct horse")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// remembered by the basic auth cache
+	if _, err := s.Authenticate(ctx, "Reader", "correct horse"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.ChangePassword(ctx, user.ID, "wrong horse", "battery staple"); err != ErrInvalidCredentials {
+		t.Fatalf("got error %v with the wrong current password, want %v", err, ErrInvalidCredentials)
+	}
+	if err := s.ChangePassword(ctx, user.ID, "correct horse", "short"); err != ErrWeakPassword {
+		t.Fatalf("got error %v for a short password, want %v", err, ErrWeakPassword)
+	}
+	if err := s.ChangePassword(ctx, user.ID, "correct horse", "battery staple"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := s.Verify(ctx, old.Token); err != ErrInvalidToken {
+		t.Errorf("got error %v for a token issued before the change, want %v", err, ErrInvalidToken)
+	}
+	if _, err := s.Authenticate(ctx, "Reader", "correct horse"); err != ErrInvalidCredentials {
+		t.Errorf("got error %v for the old password, want %v", err, ErrInvalidCredentials)
+	}
+	if len(s.verified) != 0 {
+		t.Errorf("%d passwords still remembered", len(s.verified))
+	}
+	token, err := s.Login(ctx, "Reader", "battery staple")
+	if err != nil {
+		t.Fatalf("unable to log in with the new password: %v", err)
+	}
+	if _, err := s.Verify(ctx, token.Token); err != nil {
+		t.Errorf("unable to verify new token: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS annotations(
+    id uuid PRIMARY KEY,
+    document_id uuid NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL,
+    start_location TEXT NOT NULL,
+    end_location TEXT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    color VARCHAR(16) NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    created timestamp NOT NULL DEFAULT current_timestamp,
+    updated timestamp NULL DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS annotations_document_id ON annotations(document_id);
@@ -0,0 +1,3 @@
+ALTER TABLE documents DROP COLUMN IF EXISTS series;
+ALTER TABLE documents DROP COLUMN IF EXISTS series_index;
+ALTER TABLE documents DROP COLUMN IF EXISTS rating;
@@ -0,0 +1,3 @@
+ALTER TABLE documents ADD COLUMN series VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN series_index double precision NOT NULL DEFAULT 0;
+ALTER TABLE documents ADD COLUMN rating double precision NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE scans DROP COLUMN IF EXISTS user_id;
+DROP INDEX IF EXISTS documents_user_id;
+ALTER TABLE documents DROP COLUMN IF EXISTS user_id;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS users(
+    id uuid PRIMARY KEY,
+    username VARCHAR(64) NOT NULL,
+    password_hash TEXT NOT NULL,
+    admin BOOLEAN NOT NULL DEFAULT false,
+    created timestamp NOT NULL DEFAULT current_timestamp
+);
+CREATE UNIQUE INDEX IF NOT EXISTS users_username ON users(lower(username));
+-- documents added before accounts existed are given to the first admin on start
+ALTER TABLE documents ADD COLUMN user_id uuid NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS documents_user_id ON documents(user_id);
+ALTER TABLE scans ADD COLUMN user_id VARCHAR(36) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS jobs_finished;
+ALTER TABLE jobs DROP COLUMN IF EXISTS locked_until;
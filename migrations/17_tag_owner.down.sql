@@ -0,0 +1,3 @@
+-- names may repeat across users by now so the unique constraint on them isn't restored
+DROP INDEX IF EXISTS tags_user_name;
+ALTER TABLE tags DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,22 @@
+-- tag names are unique per user instead of across every library
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS user_id uuid NULL DEFAULT NULL;
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+-- a tag on documents of several users is copied for each of them, tags left without an owner
+-- are given to the first admin on start like documents
+INSERT INTO tags(id, name, created, user_id)
+    SELECT gen_random_uuid(), tags.name, tags.created, documents.user_id
+    FROM tags
+    JOIN tagged_resources ON tagged_resources.id = tags.id
+    JOIN documents ON documents.id = tagged_resources.resource_id
+    WHERE tags.user_id IS NULL AND documents.user_id IS NOT NULL
+    GROUP BY tags.id, tags.name, tags.created, documents.user_id;
+UPDATE tagged_resources SET id = (
+    SELECT copy.id FROM tags copy, tags original, documents
+    WHERE original.id = tagged_resources.id AND documents.id = tagged_resources.resource_id
+        AND copy.user_id = documents.user_id AND copy.name = original.name)
+WHERE id IN (SELECT id FROM tags WHERE user_id IS NULL)
+    AND resource_id IN (SELECT id FROM documents WHERE user_id IS NOT NULL);
+DELETE FROM tags
+WHERE user_id IS NULL AND id NOT IN (SELECT id FROM tagged_resources)
+    AND name IN (SELECT name FROM tags WHERE user_id IS NOT NULL);
+CREATE UNIQUE INDEX IF NOT EXISTS tags_user_name ON tags(user_id, lower(name));
@@ -0,0 +1,2 @@
+-- only sqlite stores job times as text, kept so both databases are at the same version
+SELECT 1;
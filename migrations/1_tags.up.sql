@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS tags(
+    id uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created timestamp NOT NULL DEFAULT current_timestamp
+);
+CREATE TABLE IF NOT EXISTS tagged_resources(
+    id uuid NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    resource_id uuid NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    PRIMARY KEY (id, resource_id)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS document_search(
+    id uuid PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+    content TEXT NOT NULL DEFAULT '',
+    search tsvector NOT NULL
+);
+CREATE INDEX IF NOT EXISTS document_search_idx ON document_search USING GIN (search);
+INSERT INTO document_search(id, search)
+SELECT d.id,
+    setweight(to_tsvector('english', d.display_name), 'A') ||
+    setweight(to_tsvector('english', d.name), 'B') ||
+    setweight(to_tsvector('english', COALESCE(d.description, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE((SELECT string_agg(t.name, ' ') FROM tags t JOIN tagged_resources tr ON t.id = tr.id WHERE tr.resource_id = d.id), '')), 'B')
+FROM documents d
+ON CONFLICT DO NOTHING;
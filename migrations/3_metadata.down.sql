@@ -0,0 +1,7 @@
+ALTER TABLE documents
+    DROP COLUMN IF EXISTS title,
+    DROP COLUMN IF EXISTS authors,
+    DROP COLUMN IF EXISTS publisher,
+    DROP COLUMN IF EXISTS language,
+    DROP COLUMN IF EXISTS isbn,
+    DROP COLUMN IF EXISTS page_count;
@@ -0,0 +1,7 @@
+ALTER TABLE documents
+    ADD COLUMN title VARCHAR(1024) NOT NULL DEFAULT '',
+    ADD COLUMN authors VARCHAR(1024) NOT NULL DEFAULT '',
+    ADD COLUMN publisher VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN language VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN isbn VARCHAR(13) NOT NULL DEFAULT '',
+    ADD COLUMN page_count INTEGER NOT NULL DEFAULT 0;
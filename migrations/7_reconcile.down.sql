@@ -0,0 +1,13 @@
+ALTER TABLE scans
+    DROP COLUMN IF EXISTS prune,
+    DROP COLUMN IF EXISTS dry_run,
+    DROP COLUMN IF EXISTS found,
+    DROP COLUMN IF EXISTS moved,
+    DROP COLUMN IF EXISTS missing,
+    DROP COLUMN IF EXISTS pruned,
+    DROP COLUMN IF EXISTS changes;
+DROP INDEX IF EXISTS documents_hash;
+ALTER TABLE documents
+    DROP COLUMN IF EXISTS size,
+    DROP COLUMN IF EXISTS hash,
+    DROP COLUMN IF EXISTS missing_since;
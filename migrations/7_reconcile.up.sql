@@ -0,0 +1,13 @@
+ALTER TABLE documents
+    ADD COLUMN size BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN hash VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN missing_since timestamp NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS documents_hash ON documents(hash);
+ALTER TABLE scans
+    ADD COLUMN prune BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN dry_run BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN found INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN moved INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN missing INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN pruned INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN changes TEXT NOT NULL DEFAULT '[]';
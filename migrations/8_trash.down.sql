@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS documents_deleted;
+ALTER TABLE documents DROP COLUMN IF EXISTS deleted;
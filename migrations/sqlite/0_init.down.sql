@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tagged_resources;
+DROP TABLE IF EXISTS documents;
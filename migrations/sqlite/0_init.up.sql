@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS documents(
+    id VARCHAR(36) PRIMARY KEY,
+    description VARCHAR(1024),
+    display_name VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(255) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    created timestamp NOT NULL DEFAULT current_timestamp,
+    updated timestamp NULL DEFAULT NULL
+);
+CREATE TABLE IF NOT EXISTS tagged_resources(
+    id VARCHAR(36) NOT NULL,
+    resource_id VARCHAR(36) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    PRIMARY KEY (id, resource_id)
+);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS annotations;
+DROP TABLE IF EXISTS document_search;
+CREATE VIRTUAL TABLE IF NOT EXISTS document_search USING fts4(id, display_name, name, description, tags, content, notindexed=id, tokenize=unicode61);
+INSERT INTO document_search(id, display_name, name, description, tags, content)
+SELECT d.id, d.display_name, d.name, COALESCE(d.description, ''),
+    COALESCE((SELECT group_concat(t.name, ' ') FROM tags t JOIN tagged_resources tr ON t.id = tr.id WHERE tr.resource_id = d.id), ''),
+    COALESCE(c.content, '')
+FROM documents d LEFT JOIN document_content c ON c.id = d.id;
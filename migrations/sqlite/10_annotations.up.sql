@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS annotations(
+    id VARCHAR(36) PRIMARY KEY,
+    document_id VARCHAR(36) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL,
+    start_location TEXT NOT NULL,
+    end_location TEXT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    color VARCHAR(16) NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    created timestamp NOT NULL DEFAULT current_timestamp,
+    updated timestamp NULL DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS annotations_document_id ON annotations(document_id);
+-- fts4 tables can't be altered, the index is rebuilt with a column for annotation text
+DROP TABLE IF EXISTS document_search;
+CREATE VIRTUAL TABLE IF NOT EXISTS document_search USING fts4(id, display_name, name, description, tags, content, annotations, notindexed=id, tokenize=unicode61);
+INSERT INTO document_search(id, display_name, name, description, tags, content, annotations)
+SELECT d.id, d.display_name, d.name, COALESCE(d.description, ''),
+    COALESCE((SELECT group_concat(t.name, ' ') FROM tags t JOIN tagged_resources tr ON t.id = tr.id WHERE tr.resource_id = d.id), ''),
+    COALESCE(c.content, ''),
+    ''
+FROM documents d LEFT JOIN document_content c ON c.id = d.id;
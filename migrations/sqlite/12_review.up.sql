@@ -0,0 +1 @@
+ALTER TABLE documents ADD COLUMN review TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- the bundled sqlite can't drop columns, user_id is left in place and ignored by older code
+DROP INDEX IF EXISTS documents_user_id;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS users(
+    id VARCHAR(36) PRIMARY KEY,
+    username VARCHAR(64) NOT NULL UNIQUE COLLATE NOCASE,
+    password_hash TEXT NOT NULL,
+    admin INTEGER NOT NULL DEFAULT 0,
+    created timestamp NOT NULL DEFAULT current_timestamp
+);
+-- documents added before accounts existed are given to the first admin on start
+ALTER TABLE documents ADD COLUMN user_id VARCHAR(36) NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS documents_user_id ON documents(user_id);
+ALTER TABLE scans ADD COLUMN user_id VARCHAR(36) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- the bundled sqlite can't drop columns, locked_until is left in place and ignored by older code
+DROP INDEX IF EXISTS jobs_finished;
@@ -0,0 +1,4 @@
+ALTER TABLE jobs ADD COLUMN locked_until timestamp NULL DEFAULT NULL;
+-- jobs left running by older versions have no lease, expire it so the next claim picks them up
+UPDATE jobs SET locked_until = current_timestamp WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS jobs_finished ON jobs(status, updated);
@@ -0,0 +1 @@
+ALTER TABLE jobs ADD COLUMN user_id VARCHAR(36) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- the bundled sqlite can't drop columns, user_id is left in place and ignored by older code
+SELECT 1;
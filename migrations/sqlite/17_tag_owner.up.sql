@@ -0,0 +1,31 @@
+-- tag names are unique per user instead of across every library, the bundled sqlite can't drop
+-- the unique constraint on name so the table is rebuilt
+CREATE TABLE tags_owned(
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created timestamp NOT NULL DEFAULT current_timestamp,
+    user_id VARCHAR(36) NULL DEFAULT NULL
+);
+INSERT INTO tags_owned(id, name, created) SELECT id, name, created FROM tags;
+DROP TABLE tags;
+ALTER TABLE tags_owned RENAME TO tags;
+-- a tag on documents of several users is copied for each of them, tags left without an owner
+-- are given to the first admin on start like documents
+INSERT INTO tags(id, name, created, user_id)
+    SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(6))),
+        tags.name, tags.created, documents.user_id
+    FROM tags
+    JOIN tagged_resources ON tagged_resources.id = tags.id
+    JOIN documents ON documents.id = tagged_resources.resource_id
+    WHERE tags.user_id IS NULL AND documents.user_id IS NOT NULL
+    GROUP BY tags.id, documents.user_id;
+UPDATE tagged_resources SET id = (
+    SELECT copy.id FROM tags copy, tags original, documents
+    WHERE original.id = tagged_resources.id AND documents.id = tagged_resources.resource_id
+        AND copy.user_id = documents.user_id AND copy.name = original.name)
+WHERE id IN (SELECT id FROM tags WHERE user_id IS NULL)
+    AND resource_id IN (SELECT id FROM documents WHERE user_id IS NOT NULL);
+DELETE FROM tags
+WHERE user_id IS NULL AND id NOT IN (SELECT id FROM tagged_resources)
+    AND name IN (SELECT name FROM tags WHERE user_id IS NOT NULL);
+CREATE UNIQUE INDEX IF NOT EXISTS tags_user_name ON tags(user_id, name COLLATE NOCASE);
@@ -0,0 +1,2 @@
+-- the rewritten times are still read by older code
+SELECT 1;
@@ -0,0 +1,7 @@
+-- job times were written in the zone of the server with a trimmed fraction, which doesn't order
+-- as text, they are now written in UTC with milliseconds like strftime
+UPDATE jobs SET
+    run_at = strftime('%Y-%m-%d %H:%M:%f', run_at),
+    created = strftime('%Y-%m-%d %H:%M:%f', created),
+    updated = strftime('%Y-%m-%d %H:%M:%f', updated),
+    locked_until = strftime('%Y-%m-%d %H:%M:%f', locked_until);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS tags(
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created timestamp NOT NULL DEFAULT current_timestamp
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS document_search;
+DROP TABLE IF EXISTS document_content;
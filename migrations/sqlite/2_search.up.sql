@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS document_content(
+    id VARCHAR(36) PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+    content TEXT NOT NULL DEFAULT ''
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS document_search USING fts4(id, display_name, name, description, tags, content, notindexed=id, tokenize=unicode61);
+INSERT INTO document_search(id, display_name, name, description, tags, content)
+SELECT d.id, d.display_name, d.name, COALESCE(d.description, ''),
+    COALESCE((SELECT group_concat(t.name, ' ') FROM tags t JOIN tagged_resources tr ON t.id = tr.id WHERE tr.resource_id = d.id), ''),
+    ''
+FROM documents d;
@@ -0,0 +1,3 @@
+-- the bundled sqlite can't drop columns and rebuilding documents would cascade to its
+-- references, the metadata columns are left in place and ignored by older code
+SELECT 1;
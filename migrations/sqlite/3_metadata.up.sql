@@ -0,0 +1,6 @@
+ALTER TABLE documents ADD COLUMN title VARCHAR(1024) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN authors VARCHAR(1024) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN publisher VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN language VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN isbn VARCHAR(13) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN page_count INTEGER NOT NULL DEFAULT 0;
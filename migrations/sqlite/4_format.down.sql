@@ -0,0 +1,2 @@
+-- the bundled sqlite can't drop columns, see 3_metadata.down.sql
+SELECT 1;
@@ -0,0 +1,10 @@
+ALTER TABLE documents ADD COLUMN format VARCHAR(16) NOT NULL DEFAULT '';
+UPDATE documents SET format = CASE
+    WHEN lower(path) LIKE '%.pdf' THEN 'pdf'
+    WHEN lower(path) LIKE '%.epub' THEN 'epub'
+    WHEN lower(path) LIKE '%.mobi' OR lower(path) LIKE '%.azw' THEN 'mobi'
+    WHEN lower(path) LIKE '%.azw3' THEN 'azw3'
+    WHEN lower(path) LIKE '%.cbz' THEN 'cbz'
+    WHEN lower(path) LIKE '%.cbr' THEN 'cbr'
+    ELSE ''
+END;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS jobs(
+    id VARCHAR(36) PRIMARY KEY,
+    type VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    run_at timestamp NOT NULL DEFAULT current_timestamp,
+    created timestamp NOT NULL DEFAULT current_timestamp,
+    updated timestamp NULL DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_queue ON jobs(status, run_at);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS scans(
+    id VARCHAR(36) PRIMARY KEY,
+    job_id VARCHAR(36) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL,
+    seen INTEGER NOT NULL DEFAULT 0,
+    imported INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    errors TEXT NOT NULL DEFAULT '[]',
+    error TEXT NOT NULL DEFAULT '',
+    cancel_requested INTEGER NOT NULL DEFAULT 0,
+    created timestamp NOT NULL DEFAULT current_timestamp,
+    started timestamp NULL DEFAULT NULL,
+    finished timestamp NULL DEFAULT NULL
+);
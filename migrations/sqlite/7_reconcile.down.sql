@@ -0,0 +1,2 @@
+-- the bundled sqlite can't drop columns, the new columns are left in place and ignored by older code
+DROP INDEX IF EXISTS documents_hash;
@@ -0,0 +1,11 @@
+ALTER TABLE documents ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE documents ADD COLUMN hash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN missing_since timestamp NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS documents_hash ON documents(hash);
+ALTER TABLE scans ADD COLUMN prune INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scans ADD COLUMN dry_run INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scans ADD COLUMN found INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scans ADD COLUMN moved INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scans ADD COLUMN missing INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scans ADD COLUMN pruned INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scans ADD COLUMN changes TEXT NOT NULL DEFAULT '[]';
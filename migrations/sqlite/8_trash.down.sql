@@ -0,0 +1,2 @@
+-- the bundled sqlite can't drop columns, deleted is left in place and ignored by older code
+DROP INDEX IF EXISTS documents_deleted;
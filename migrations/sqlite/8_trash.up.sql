@@ -0,0 +1,2 @@
+ALTER TABLE documents ADD COLUMN deleted timestamp NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS documents_deleted ON documents(deleted);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS reading_progress(
+    document_id VARCHAR(36) PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+    location TEXT NOT NULL DEFAULT '',
+    percentage REAL NOT NULL DEFAULT 0,
+    status VARCHAR(16) NOT NULL,
+    started timestamp NULL DEFAULT NULL,
+    finished timestamp NULL DEFAULT NULL,
+    updated timestamp NULL DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS reading_progress_status ON reading_progress(status);